@@ -19,6 +19,7 @@ import (
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	gatewayclient "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
 	"syscall"
 )
 
@@ -27,6 +28,7 @@ var (
 	debug         = flag.Bool("debug", false, "log debug messages")
 	monitor       = flag.String("monitor", "", "host monitor URL (required)")
 	token         = flag.String("token", "", "host monitor token (required)")
+	id            = flag.String("id", "", "agent ID (default: the ID of the cluster)")
 	promAddr      = flag.String("prom", ":9090", "Prometheus metrics port")
 	configuration = flag.String("configuration", "", "configuration file")
 )
@@ -34,7 +36,7 @@ var (
 func main() {
 	flag.Parse()
 
-	var cfg agent.Configuration
+	cfg := agent.DefaultConfiguration
 	if *configuration != "" {
 		var err error
 		if cfg, err = agent.LoadFromFile(*configuration); err != nil {
@@ -47,6 +49,9 @@ func main() {
 	if *token != "" {
 		cfg.Token = *token
 	}
+	if *id != "" {
+		cfg.ID = *id
+	}
 
 	var opts slog.HandlerOptions
 	if *debug {
@@ -54,11 +59,17 @@ func main() {
 	}
 	l := slog.New(slog.NewJSONHandler(os.Stderr, &opts))
 
-	c, err := kubernetes.NewForConfig(getConfigOrDie(l))
+	restConfig := getConfigOrDie(l)
+	c, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		l.Error("failed to connect to cluster", "err", err)
 		return
 	}
+	gc, err := gatewayclient.NewForConfig(restConfig)
+	if err != nil {
+		l.Error("failed to create gateway api client", "err", err)
+		return
+	}
 
 	http.Handle("/metrics", promhttp.Handler())
 	go func() {
@@ -74,15 +85,15 @@ func main() {
 	httpClient := http.Client{
 		Transport: roundtripper.New(roundtripper.WithRequestMetrics(httpMetrics)),
 	}
-	a, err := agent.New(c, &httpClient, cfg, agentMetrics, l)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	a, err := agent.New(ctx, c, gc, &httpClient, cfg, agentMetrics, l)
 	if err != nil {
 		l.Error("failed to start agent", "err", err)
 		return
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
-
 	l.Info("starting uptime agent", "version", version)
 	a.Run(ctx)
 	l.Info("uptime agent stopped")
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"github.com/clambin/go-common/http/metrics"
 	"github.com/clambin/go-common/http/middleware"
 	"github.com/clambin/go-common/http/roundtripper"
 	"github.com/clambin/uptime/internal/monitor"
+	"github.com/clambin/uptime/internal/monitor/hostcheckers"
+	"github.com/clambin/uptime/internal/monitor/maintenance"
 	monitorMetrics "github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/clambin/uptime/internal/monitor/notifier"
+	"github.com/clambin/uptime/internal/monitor/status"
+	"github.com/clambin/uptime/internal/monitor/store"
 	"github.com/clambin/uptime/pkg/auth"
 	"github.com/clambin/uptime/pkg/logger"
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,14 +22,36 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 )
 
 var (
-	version  = "change-me"
-	debug    = flag.Bool("debug", false, "Log debugging information")
-	token    = flag.String("token", "", "Authorization token")
-	addr     = flag.String("addr", ":8080", "Listener port")
-	promAddr = flag.String("prom", ":9090", "Prometheus metrics port")
+	version     = "change-me"
+	debug       = flag.Bool("debug", false, "Log debugging information")
+	token       = flag.String("token", "", "Authorization token")
+	addr        = flag.String("addr", ":8080", "Listener port")
+	promAddr    = flag.String("prom", ":9090", "Prometheus metrics port")
+	storePath   = flag.String("store", "", "File to persist targets and their owners in. The uptime history and incidents of targets are not persisted: they start over when the monitor restarts (default: targets are not persisted)")
+	leaseTTL    = flag.Duration("lease-ttl", monitor.DefaultLeaseTTL, "Remove targets that are not registered again within this time (0: targets never expire)")
+	insecure    = flag.Bool("insecure", false, "Skip TLS certificate verification (verification errors are still reported)")
+	workers     = flag.Int("workers", hostcheckers.DefaultWorkers, "Maximum number of concurrent checks")
+	maxPerHost  = flag.Int("max-per-host", hostcheckers.DefaultMaxInFlightPerHost, "Maximum number of concurrent checks of the same host (0: no limit)")
+	startJitter = flag.Duration("start-jitter", monitor.DefaultStartJitter, "Spread the first check of new targets over up to this time")
+	slo         = flag.Float64("slo", hostcheckers.DefaultSLO, "Target uptime ratio of targets that do not set their own SLO")
+	windows     = flag.String("maintenance", "", "YAML file with maintenance windows (default: no maintenance windows)")
+	webhook     = flag.String("webhook", "", "URL to post notifications to when targets go down or up (default: no notifications)")
+	webhookTmpl = flag.String("webhook-template", "", "File with the template of the webhook payload (default: the event as JSON)")
+	smtpAddr    = flag.String("smtp-addr", "", "host:port of the SMTP server to email notifications through (default: no emails)")
+	smtpFrom    = flag.String("smtp-from", "uptime@localhost", "Sender of notification emails")
+	smtpTo      = flag.String("smtp-to", "", "Comma-separated list of recipients of notification emails")
+	smtpUser    = flag.String("smtp-username", "", "SMTP username (default: no authentication)")
+	smtpPass    = flag.String("smtp-password", "", "SMTP password")
+	smtpTLS     = flag.Bool("smtp-require-tls", false, "Fail to send emails if the SMTP server does not support STARTTLS")
+	smtpSubject = flag.String("smtp-subject", "", "Template of the subject of notification emails (default: "+notifier.DefaultSubject+")")
+	smtpBody    = flag.String("smtp-body", "", "File with the template of the body of notification emails")
+	certExpiry  = flag.Int("cert-expiry-days", 14, "Notify certificates that expire within this number of days (0: disabled)")
+	statusPage  = flag.String("status-page", "", "YAML file configuring the public status page, served on /status without authentication. The page only shows the targets that match one of its groups. Its uptime and incidents cover the time since the monitor started (default: no status page)")
+	metadata    = flag.String("metadata", "", "Comma-separated list of kubernetes labels and annotations, forwarded by the agents, to add to the info metric")
 
 	clientMetricBuckets = prometheus.DefBuckets
 )
@@ -48,25 +77,96 @@ func main() {
 	}()
 
 	serverMetrics := metrics.NewRequestSummaryMetrics("uptime", "monitor_server", nil)
-	monMetrics := monitorMetrics.NewHostMetrics("uptime", "monitor_target", nil)
+	if *slo <= 0 || *slo >= 1 {
+		l.Error("invalid slo: must be between 0 and 1", "slo", *slo)
+		os.Exit(1)
+	}
+
+	var metadataKeys []string
+	if *metadata != "" {
+		metadataKeys = strings.Split(*metadata, ",")
+	}
+	if err := monitorMetrics.ValidateMetadataKeys(metadataKeys); err != nil {
+		l.Error("invalid metadata", "err", err)
+		os.Exit(1)
+	}
+	monMetrics := monitorMetrics.NewHostMetricsWithMetadata("uptime", "monitor_target", nil, metadataKeys)
 	httpClientMetrics := monitorMetrics.NewHTTPMetrics("uptime", "monitor_target", nil, clientMetricBuckets...)
 	prometheus.MustRegister(httpClientMetrics, serverMetrics, monMetrics)
 
-	h := monitor.New(
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: *insecure}
+
+	var targetStore hostcheckers.TargetStore
+	if *storePath != "" {
+		targetStore = store.NewFile(*storePath)
+	}
+
+	options := []monitor.Option{
+		monitor.WithWorkers(*workers),
+		monitor.WithMaxInFlightPerHost(*maxPerHost),
+		monitor.WithStartJitter(*startJitter),
+		monitor.WithSLO(*slo),
+	}
+	if *windows != "" {
+		w, err := maintenance.LoadFromFile(*windows)
+		if err != nil {
+			l.Error("invalid maintenance windows", "err", err)
+			os.Exit(1)
+		}
+		options = append(options, monitor.WithMaintenance(w))
+	}
+
+	notifiers, err := newNotifiers()
+	if err != nil {
+		l.Error("invalid notifications", "err", err)
+		os.Exit(1)
+	}
+	if len(notifiers) > 0 {
+		alerter := notifier.NewAlerter(l, notifiers...)
+		alerter.CertificateExpiryDays = *certExpiry
+		go alerter.Run(context.Background())
+		options = append(options, monitor.WithAlerter(alerter))
+	}
+
+	mon := monitor.New(
 		monMetrics,
 		&http.Client{
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse
 			},
-			Transport: roundtripper.New(roundtripper.WithRequestMetrics(httpClientMetrics)),
-			Timeout:   monitor.DefaultClientTimeout,
+			Transport: roundtripper.New(
+				roundtripper.WithRequestMetrics(httpClientMetrics),
+				roundtripper.WithRoundTripper(transport),
+			),
+			Timeout: monitor.DefaultClientTimeout,
 		},
+		targetStore,
+		l,
+		options...,
 	)
+	if *leaseTTL > 0 {
+		go mon.ExpireLeases(context.Background(), *leaseTTL, l)
+	}
+
+	var h http.Handler = mon
 
 	if *token != "" {
 		h = auth.Authenticate(*token)(h)
 	}
 
+	if *statusPage != "" {
+		cfg, err := status.LoadConfigFromFile(*statusPage)
+		if err != nil {
+			l.Error("invalid status page configuration", "err", err)
+			os.Exit(1)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("GET /status", mon.StatusPage(cfg))
+		mux.Handle("/", h)
+		h = mux
+	}
+
 	s := http.Server{
 		Addr: *addr,
 		Handler: middleware.WithRequestMetrics(serverMetrics)(
@@ -82,3 +182,45 @@ func main() {
 	}
 	l.Info("uptime monitor stopped")
 }
+
+func newNotifiers() ([]notifier.Notifier, error) {
+	var notifiers []notifier.Notifier
+	if *webhook != "" {
+		payload, err := readTemplate(*webhookTmpl)
+		if err != nil {
+			return nil, err
+		}
+		w, err := notifier.NewWebhook(*webhook, payload)
+		if err != nil {
+			return nil, err
+		}
+		w.HTTPClient = &http.Client{Timeout: monitor.DefaultClientTimeout}
+		notifiers = append(notifiers, w)
+	}
+	if *smtpAddr != "" {
+		body, err := readTemplate(*smtpBody)
+		if err != nil {
+			return nil, err
+		}
+		var to []string
+		if *smtpTo != "" {
+			to = strings.Split(*smtpTo, ",")
+		}
+		s, err := notifier.NewSMTP(*smtpAddr, *smtpFrom, to, *smtpSubject, body)
+		if err != nil {
+			return nil, err
+		}
+		s.Username, s.Password, s.RequireTLS = *smtpUser, *smtpPass, *smtpTLS
+		notifiers = append(notifiers, s)
+	}
+	return notifiers, nil
+}
+
+// readTemplate returns the content of the template file at path, or an empty string if path is empty.
+func readTemplate(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(path)
+	return string(content), err
+}
@@ -7,34 +7,80 @@ import (
 	"github.com/clambin/uptime/internal/agent/informer"
 	v1 "k8s.io/api/core/v1"
 	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"log/slog"
 	"net/http"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayclient "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
 	"time"
 )
 
 type Agent struct {
-	ingressInformer *informer.Informer
+	gatewayInformer *informer.Informer
+	informers       []*informer.Informer
 	filter          filter
 	reSender        reSender
 	sender          sender
 }
 
-func New(c *kubernetes.Clientset, httpClient *http.Client, cfg Configuration, metrics *Metrics, logger *slog.Logger) (*Agent, error) {
-	g := cache.NewListWatchFromClient(c.NetworkingV1().RESTClient(), "ingresses", v1.NamespaceAll, fields.Everything())
-	return NewWithListWatcher(g, httpClient, cfg, metrics, logger)
+// ListerWatchers holds the ListerWatcher for each supported resource type. Resource types without a ListerWatcher
+// are not watched. HTTPRoutes require Gateways to determine the scheme of the route's hosts.
+type ListerWatchers struct {
+	Ingresses  cache.ListerWatcher
+	HTTPRoutes cache.ListerWatcher
+	Gateways   cache.ListerWatcher
+	Services   cache.ListerWatcher
+}
+
+// New creates an Agent for the cluster of the provided clients. If the configuration has no ID, the agent uses the
+// cluster's ID, so agents in different clusters don't overwrite each other's targets.
+func New(ctx context.Context, c kubernetes.Interface, gc gatewayclient.Interface, httpClient *http.Client, cfg Configuration, metrics *Metrics, logger *slog.Logger) (*Agent, error) {
+	if cfg.ID == "" {
+		var err error
+		if cfg.ID, err = ClusterID(ctx, c); err != nil {
+			return nil, fmt.Errorf("cluster id: %w", err)
+		}
+	}
+	var lw ListerWatchers
+	if cfg.Sources.Ingresses {
+		lw.Ingresses = cache.NewListWatchFromClient(c.NetworkingV1().RESTClient(), "ingresses", v1.NamespaceAll, fields.Everything())
+	}
+	if cfg.Sources.HTTPRoutes {
+		lw.HTTPRoutes = cache.NewListWatchFromClient(gc.GatewayV1().RESTClient(), "httproutes", v1.NamespaceAll, fields.Everything())
+		lw.Gateways = cache.NewListWatchFromClient(gc.GatewayV1().RESTClient(), "gateways", v1.NamespaceAll, fields.Everything())
+	}
+	if cfg.Sources.Services {
+		lw.Services = cache.NewListWatchFromClient(c.CoreV1().RESTClient(), "services", v1.NamespaceAll, fields.Everything())
+	}
+	return NewWithListWatchers(lw, httpClient, cfg, metrics, logger)
 }
 
 const (
 	resyncPeriod = 5 * time.Minute
 )
 
-func NewWithListWatcher(lw cache.ListerWatcher, httpClient *http.Client, cfg Configuration, metrics *Metrics, logger *slog.Logger) (*Agent, error) {
+// ClusterID returns an ID that is unique for the cluster: the UID of its kube-system namespace.
+func ClusterID(ctx context.Context, c kubernetes.Interface) (string, error) {
+	ns, err := c.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return string(ns.UID), nil
+}
+
+func NewWithListWatchers(lw ListerWatchers, httpClient *http.Client, cfg Configuration, metrics *Metrics, logger *slog.Logger) (*Agent, error) {
 	if cfg.Monitor == "" {
 		return nil, errors.New("missing monitor URL")
 	}
+	if cfg.ID == "" {
+		return nil, errors.New("missing id")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("configuration: %w", err)
+	}
 
 	if httpClient == nil {
 		httpClient = http.DefaultClient
@@ -44,35 +90,86 @@ func NewWithListWatcher(lw cache.ListerWatcher, httpClient *http.Client, cfg Con
 	reSenderIn := make(chan event)
 	senderIn := make(chan event)
 
-	i, err := informer.New(lw, resyncPeriod, new(netv1.Ingress), &ingressWatcher{
-		out:     filterIn,
-		metrics: metrics,
-		logger:  logger.With("component", "informer"),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("informer: %w", err)
+	s := sender{
+		in:            senderIn,
+		configuration: cfg,
+		httpClient:    httpClient,
+		backoff:       defaultBackoffPolicy,
+		metrics:       metrics,
+		logger:        logger.With("component", "sender"),
 	}
-
-	return &Agent{
-		ingressInformer: i,
+	a := Agent{
 		filter: filter{
 			in:            filterIn,
 			out:           reSenderIn,
 			configuration: cfg,
+			metrics:       metrics,
 			logger:        logger.With("component", "filter"),
 		},
 		reSender: reSender{
-			in:     reSenderIn,
-			out:    senderIn,
-			events: make(map[string]event),
-		},
-		sender: sender{
-			in:            senderIn,
-			configuration: cfg,
-			httpClient:    httpClient,
-			logger:        logger.With("component", "sender"),
+			in:         reSenderIn,
+			out:        senderIn,
+			events:     make(map[string]event),
+			reconciler: s.reconcile,
 		},
-	}, nil
+		sender: s,
+	}
+
+	if lw.Ingresses != nil {
+		i, err := informer.New(lw.Ingresses, resyncPeriod, new(netv1.Ingress), &watcher{
+			out:       filterIn,
+			newEvent:  func(t eventType, obj any) event { return newIngressEvent(t, obj.(*netv1.Ingress)) },
+			selectors: cfg.Selectors,
+			metrics:   metrics,
+			logger:    logger.With("component", "informer", "kind", ingressKind),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ingress informer: %w", err)
+		}
+		a.informers = append(a.informers, i)
+	}
+
+	if lw.HTTPRoutes != nil {
+		var gateways cache.Store
+		l := logger.With("component", "informer", "kind", httpRouteKind)
+		w := watcher{
+			out:       filterIn,
+			newEvent:  func(t eventType, obj any) event { return newHTTPRouteEvent(t, obj.(*gatewayv1.HTTPRoute), gateways, l) },
+			selectors: cfg.Selectors,
+			metrics:   metrics,
+			logger:    l,
+		}
+		i, err := informer.New(lw.HTTPRoutes, resyncPeriod, new(gatewayv1.HTTPRoute), &w)
+		if err != nil {
+			return nil, fmt.Errorf("httproute informer: %w", err)
+		}
+		a.informers = append(a.informers, i)
+		if lw.Gateways != nil {
+			// a change to a gateway changes the targets of its routes
+			gw := gatewayWatcher{watcher: w, routes: i.GetStore(), logger: l}
+			if a.gatewayInformer, err = informer.New(lw.Gateways, resyncPeriod, new(gatewayv1.Gateway), &gw); err != nil {
+				return nil, fmt.Errorf("gateway informer: %w", err)
+			}
+			gateways = a.gatewayInformer.GetStore()
+			gw.gateways = gateways
+		}
+	}
+
+	if lw.Services != nil {
+		i, err := informer.New(lw.Services, resyncPeriod, new(v1.Service), &watcher{
+			out:       filterIn,
+			newEvent:  func(t eventType, obj any) event { return newServiceEvent(t, obj.(*v1.Service)) },
+			selectors: cfg.Selectors,
+			metrics:   metrics,
+			logger:    logger.With("component", "informer", "kind", serviceKind),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("service informer: %w", err)
+		}
+		a.informers = append(a.informers, i)
+	}
+
+	return &a, nil
 }
 
 const senderCount = 5
@@ -84,7 +181,15 @@ func (a *Agent) Run(ctx context.Context) {
 	}
 	go a.reSender.Run(ctx, reSendInterval)
 	go a.filter.Run(ctx)
-	go a.ingressInformer.Run()
-	defer a.ingressInformer.Cancel()
+	if a.gatewayInformer != nil {
+		// routes need their parent gateways to determine the scheme of their hosts
+		go a.gatewayInformer.Run()
+		defer a.gatewayInformer.Cancel()
+		cache.WaitForCacheSync(ctx.Done(), a.gatewayInformer.SharedInformer.HasSynced)
+	}
+	for _, i := range a.informers {
+		go i.Run()
+		defer i.Cancel()
+	}
 	<-ctx.Done()
 }
@@ -5,8 +5,10 @@ import (
 	"github.com/clambin/uptime/internal/monitor/handlers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	netv1 "k8s.io/api/networking/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 	fcache "k8s.io/client-go/tools/cache/testing"
 	"log/slog"
 	"net/http"
@@ -48,14 +50,18 @@ func TestAgent_Run(t *testing.T) {
 
 	cfg := DefaultConfiguration
 	cfg.Monitor = s.URL
+	cfg.ID = "test"
 
 	f := fcache.NewFakeControllerSource()
 	m := NewMetrics("", "", nil)
 
-	_, err := NewWithListWatcher(f, nil, Configuration{}, m, l)
+	_, err := NewWithListWatchers(ListerWatchers{Ingresses: f}, nil, Configuration{}, m, l)
 	assert.Error(t, err)
 
-	a, err := NewWithListWatcher(f, nil, cfg, m, l)
+	_, err = NewWithListWatchers(ListerWatchers{Ingresses: f}, nil, Configuration{Monitor: s.URL}, m, l)
+	assert.Error(t, err)
+
+	a, err := NewWithListWatchers(ListerWatchers{Ingresses: f}, nil, cfg, m, l)
 	require.NoError(t, err)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -71,6 +77,108 @@ func TestAgent_Run(t *testing.T) {
 	}, 5*time.Second, time.Second)
 }
 
+func TestAgent_Run_HTTPRoutes(t *testing.T) {
+	h := server{hosts: make(map[string]bool)}
+	s := httptest.NewServer(&h)
+	defer s.Close()
+
+	cfg := DefaultConfiguration
+	cfg.Monitor = s.URL
+	cfg.ID = "test"
+
+	routes := fcache.NewFakeControllerSource()
+	gateways := fcache.NewFakeControllerSource()
+	gateways.Add(&validGateway)
+
+	a, err := NewWithListWatchers(ListerWatchers{HTTPRoutes: routes, Gateways: gateways}, nil, cfg, NewMetrics("", "", nil), slog.Default())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+
+	routes.Add(&validHTTPRoute)
+	assert.Eventually(t, func() bool {
+		up, ok := h.getHost("route.example.com")
+		return ok && up
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// a gateway that switches to plain http changes the targets of its routes
+	httpGateway := validGateway.DeepCopy()
+	httpGateway.Spec.Listeners = httpGateway.Spec.Listeners[:1]
+	gateways.Modify(httpGateway)
+	assert.Eventually(t, func() bool {
+		up, ok := h.getHost("http://route.example.com")
+		return ok && up
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		up, ok := h.getHost("route.example.com")
+		return ok && !up
+	}, 5*time.Second, 100*time.Millisecond)
+
+	routes.Delete(&validHTTPRoute)
+	assert.Eventually(t, func() bool {
+		up, ok := h.getHost("http://route.example.com")
+		return ok && !up
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestAgent_Run_Services(t *testing.T) {
+	h := server{hosts: make(map[string]bool)}
+	s := httptest.NewServer(&h)
+	defer s.Close()
+
+	cfg := DefaultConfiguration
+	cfg.Monitor = s.URL
+	cfg.ID = "test"
+
+	services := fcache.NewFakeControllerSource()
+	a, err := NewWithListWatchers(ListerWatchers{Services: services}, nil, cfg, NewMetrics("", "", nil), slog.Default())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+
+	ignored := validService.DeepCopy()
+	ignored.Name = "ignored"
+	ignored.Annotations = nil
+	ignored.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "192.168.0.11"}}
+	services.Add(ignored)
+	services.Add(&validService)
+
+	assert.Eventually(t, func() bool {
+		up, ok := h.getHost("192.168.0.10:1883")
+		return ok && up
+	}, 5*time.Second, 100*time.Millisecond)
+	_, ok := h.getHost("192.168.0.11:1883")
+	assert.False(t, ok)
+}
+
+func TestNew_DefaultID(t *testing.T) {
+	clusterA := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: v1.NamespaceSystem, UID: "cluster-a"}})
+	clusterB := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: v1.NamespaceSystem, UID: "cluster-b"}})
+
+	cfg := DefaultConfiguration
+	cfg.Monitor = "http://localhost:8080"
+
+	a, err := New(context.Background(), clusterA, nil, nil, cfg, NewMetrics("", "", nil), slog.Default())
+	require.NoError(t, err)
+	b, err := New(context.Background(), clusterB, nil, nil, cfg, NewMetrics("", "", nil), slog.Default())
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-a", a.sender.configuration.ID)
+	assert.Equal(t, "cluster-b", b.sender.configuration.ID)
+
+	cfg.ID = "production"
+	a, err = New(context.Background(), clusterA, nil, nil, cfg, NewMetrics("", "", nil), slog.Default())
+	require.NoError(t, err)
+	assert.Equal(t, "production", a.sender.configuration.ID)
+
+	cfg.ID = ""
+	_, err = New(context.Background(), fake.NewSimpleClientset(), nil, nil, cfg, NewMetrics("", "", nil), slog.Default())
+	assert.Error(t, err)
+}
+
 func BenchmarkAgent(b *testing.B) {
 	filterIn := make(chan event)
 	resenderIn := make(chan event)
@@ -78,9 +186,10 @@ func BenchmarkAgent(b *testing.B) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	w := ingressWatcher{
-		out:    filterIn,
-		logger: slog.Default(),
+	w := watcher{
+		out:      filterIn,
+		newEvent: func(t eventType, obj any) event { return newIngressEvent(t, obj.(*netv1.Ingress)) },
+		logger:   slog.Default(),
 	}
 	f := filter{
 		in:  filterIn,
@@ -122,7 +231,7 @@ func (s *server) getHost(target string) (bool, bool) {
 
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	req, err := handlers.ParseRequest(r)
-	if err != nil {
+	if err != nil || r.URL.Query().Get("agent") == "" {
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
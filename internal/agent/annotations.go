@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Annotations allow application teams to override the check settings of an ingress. Settings are applied in order
+// of precedence: ingress annotations first, then the host's entry in the configuration's hosts section and finally
+// the configuration's global section.
+const (
+	annotationPrefix           = "uptime.clambin.github.io/"
+	intervalAnnotation         = annotationPrefix + "interval"
+	methodAnnotation           = annotationPrefix + "method"
+	validStatusCodesAnnotation = annotationPrefix + "valid-status-codes"
+	skipAnnotation             = annotationPrefix + "skip"
+	pathAnnotation             = annotationPrefix + "path"
+	monitorAnnotation          = annotationPrefix + "monitor"
+	hostAnnotation             = annotationPrefix + "host"
+	failureThresholdAnnotation = annotationPrefix + "failure-threshold"
+	successThresholdAnnotation = annotationPrefix + "success-threshold"
+)
+
+// ingressOverrides holds the check settings configured through the annotations of an ingress.
+type ingressOverrides struct {
+	skip     *bool
+	endpoint EndpointConfiguration
+}
+
+type annotationError struct {
+	annotation string
+	err        error
+}
+
+func (e *annotationError) Error() string {
+	return "invalid annotation " + e.annotation + ": " + e.err.Error()
+}
+
+func (e *annotationError) Unwrap() error {
+	return e.err
+}
+
+// parseAnnotations returns the overrides configured in the annotations. Invalid annotations are ignored and
+// reported in the returned errors.
+func parseAnnotations(annotations map[string]string) (ingressOverrides, []*annotationError) {
+	var overrides ingressOverrides
+	var errs []*annotationError
+	for annotation, value := range annotations {
+		if !strings.HasPrefix(annotation, annotationPrefix) {
+			continue
+		}
+		if err := overrides.set(annotation, strings.TrimSpace(value)); err != nil {
+			errs = append(errs, &annotationError{annotation: annotation, err: err})
+		}
+	}
+	return overrides, errs
+}
+
+func (o *ingressOverrides) set(annotation, value string) error {
+	switch annotation {
+	case intervalAnnotation:
+		interval, err := time.ParseDuration(value)
+		if err == nil && interval <= 0 {
+			err = fmt.Errorf("interval must be positive: %s", value)
+		}
+		if err != nil {
+			return err
+		}
+		o.endpoint.Interval = interval
+	case methodAnnotation:
+		method := strings.ToUpper(value)
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions:
+		default:
+			return fmt.Errorf("unsupported method: %s", value)
+		}
+		o.endpoint.Method = method
+	case validStatusCodesAnnotation:
+		codes, err := parseStatusCodes(value)
+		if err != nil {
+			return err
+		}
+		o.endpoint.ValidStatusCodes = codes
+	case skipAnnotation:
+		skip, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		o.skip = &skip
+	case pathAnnotation:
+		if !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("path must start with '/': %s", value)
+		}
+		o.endpoint.Path = value
+	case monitorAnnotation:
+		// used by the default selectors to select services
+		if _, err := strconv.ParseBool(value); err != nil {
+			return err
+		}
+	case hostAnnotation:
+		// used to determine the address of a service's targets
+		if value == "" {
+			return errors.New("host cannot be empty")
+		}
+	case failureThresholdAnnotation:
+		threshold, err := parseThreshold(value)
+		if err != nil {
+			return err
+		}
+		o.endpoint.FailureThreshold = threshold
+	case successThresholdAnnotation:
+		threshold, err := parseThreshold(value)
+		if err != nil {
+			return err
+		}
+		o.endpoint.SuccessThreshold = threshold
+	default:
+		return errors.New("unknown annotation")
+	}
+	return nil
+}
+
+func parseStatusCodes(value string) ([]int, error) {
+	var codes []int
+	for _, entry := range splitList(value) {
+		code, err := strconv.Atoi(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q: %w", entry, err)
+		}
+		if code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q", entry)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func parseThreshold(value string) (int, error) {
+	threshold, err := strconv.Atoi(value)
+	if err == nil && threshold < 1 {
+		err = fmt.Errorf("threshold must be at least 1: %s", value)
+	}
+	return threshold, err
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	skip := true
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        ingressOverrides
+		wantErrs    []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:        "other annotations are ignored",
+			annotations: map[string]string{traefikEndpointAnnotation: traefikExternalEndpoint},
+		},
+		{
+			name: "valid",
+			annotations: map[string]string{
+				intervalAnnotation:         "1m",
+				methodAnnotation:           "head",
+				validStatusCodesAnnotation: "200, 401",
+				skipAnnotation:             "true",
+				pathAnnotation:             "/healthz",
+				monitorAnnotation:          "true",
+				hostAnnotation:             "mqtt.example.com",
+				failureThresholdAnnotation: "3",
+				successThresholdAnnotation: "2",
+			},
+			want: ingressOverrides{
+				skip: &skip,
+				endpoint: EndpointConfiguration{
+					Interval:         time.Minute,
+					Method:           http.MethodHead,
+					ValidStatusCodes: []int{http.StatusOK, http.StatusUnauthorized},
+					Path:             "/healthz",
+					FailureThreshold: 3,
+					SuccessThreshold: 2,
+				},
+			},
+		},
+		{
+			name: "invalid",
+			annotations: map[string]string{
+				intervalAnnotation:         "-1m",
+				methodAnnotation:           "DELETE",
+				validStatusCodesAnnotation: "200,abc",
+				skipAnnotation:             "maybe",
+				pathAnnotation:             "healthz",
+				monitorAnnotation:          "yes please",
+				hostAnnotation:             "",
+				failureThresholdAnnotation: "0",
+				successThresholdAnnotation: "many",
+				annotationPrefix + "foo":   "bar",
+			},
+			wantErrs: []string{intervalAnnotation, methodAnnotation, validStatusCodesAnnotation, skipAnnotation, pathAnnotation, monitorAnnotation, hostAnnotation, failureThresholdAnnotation, successThresholdAnnotation, annotationPrefix + "foo"},
+		},
+		{
+			name: "partially valid",
+			annotations: map[string]string{
+				intervalAnnotation:         "1m",
+				validStatusCodesAnnotation: "999",
+			},
+			want:     ingressOverrides{endpoint: EndpointConfiguration{Interval: time.Minute}},
+			wantErrs: []string{validStatusCodesAnnotation},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			overrides, errs := parseAnnotations(tt.annotations)
+			assert.Equal(t, tt.want, overrides)
+			annotations := make([]string, len(errs))
+			for i := range errs {
+				annotations[i] = errs[i].annotation
+			}
+			assert.ElementsMatch(t, tt.wantErrs, annotations)
+		})
+	}
+}
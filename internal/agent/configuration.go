@@ -1,31 +1,166 @@
 package agent
 
 import (
+	"errors"
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"io"
+	"k8s.io/apimachinery/pkg/labels"
+	"maps"
 	"net/http"
 	"os"
+	"regexp"
 	"time"
 )
 
 type Configuration struct {
 	Monitor string
 	Token   string
-	Global  EndpointConfiguration            `yaml:"global,omitempty"`
-	Hosts   map[string]EndpointConfiguration `yaml:"hosts,omitempty"`
+	// ID identifies the agent to the monitor. Agents that post to the same monitor need a different ID. If ID is
+	// empty, the agent uses the ID of its cluster (see ClusterID).
+	ID        string                           `yaml:"id"`
+	Sources   Sources                          `yaml:"sources"`
+	Selectors Selectors                        `yaml:"selectors,omitempty"`
+	Global    EndpointConfiguration            `yaml:"global,omitempty"`
+	Hosts     map[string]EndpointConfiguration `yaml:"hosts,omitempty"`
+	Metadata  Metadata                         `yaml:"metadata,omitempty"`
+}
+
+// Metadata lists the kubernetes labels and annotations that are forwarded to the monitor, in addition to the kind,
+// namespace and name of the resource. Only list the ones that are needed, to keep the monitor's metrics small.
+type Metadata struct {
+	Labels      []string `yaml:"labels,omitempty"`
+	Annotations []string `yaml:"annotations,omitempty"`
 }
 
 type EndpointConfiguration struct {
-	Skip             bool          `yaml:"skip,omitempty"`
-	Interval         time.Duration `yaml:"interval,omitempty"`
-	Method           string        `yaml:"method,omitempty"`
-	ValidStatusCodes []int         `yaml:"valid-status-codes,omitempty"`
+	Skip             bool              `yaml:"skip,omitempty"`
+	Interval         time.Duration     `yaml:"interval,omitempty"`
+	Method           string            `yaml:"method,omitempty"`
+	ValidStatusCodes []int             `yaml:"valid-status-codes,omitempty"`
+	Path             string            `yaml:"path,omitempty"`
+	Headers          map[string]string `yaml:"headers,omitempty"`
+	Body             string            `yaml:"body,omitempty"`
+	HostHeader       string            `yaml:"host-header,omitempty"`
+	UserAgent        string            `yaml:"user-agent,omitempty"`
+	FailureThreshold int               `yaml:"failure-threshold,omitempty"`
+	SuccessThreshold int               `yaml:"success-threshold,omitempty"`
+	SLO              float64           `yaml:"slo,omitempty"`
+}
+
+// validate returns an error if the configuration holds an invalid setting.
+func (e EndpointConfiguration) validate() error {
+	if e.SLO < 0 || e.SLO >= 1 {
+		return fmt.Errorf("invalid slo %v: must be between 0 and 1", e.SLO)
+	}
+	return nil
+}
+
+// override returns the configuration with any settings in other replacing the ones in e.
+func (e EndpointConfiguration) override(other EndpointConfiguration) EndpointConfiguration {
+	if other.Method != "" {
+		e.Method = other.Method
+	}
+	if other.Interval != 0 {
+		e.Interval = other.Interval
+	}
+	if other.ValidStatusCodes != nil {
+		e.ValidStatusCodes = other.ValidStatusCodes
+	}
+	if other.Path != "" {
+		e.Path = other.Path
+	}
+	if len(other.Headers) > 0 {
+		headers := make(map[string]string, len(e.Headers)+len(other.Headers))
+		maps.Copy(headers, e.Headers)
+		maps.Copy(headers, other.Headers)
+		e.Headers = headers
+	}
+	if other.Body != "" {
+		e.Body = other.Body
+	}
+	if other.HostHeader != "" {
+		e.HostHeader = other.HostHeader
+	}
+	if other.UserAgent != "" {
+		e.UserAgent = other.UserAgent
+	}
+	if other.FailureThreshold != 0 {
+		e.FailureThreshold = other.FailureThreshold
+	}
+	if other.SuccessThreshold != 0 {
+		e.SuccessThreshold = other.SuccessThreshold
+	}
+	if other.SLO != 0 {
+		e.SLO = other.SLO
+	}
+	return e
+}
+
+// endpoint returns the configuration of host: the global configuration, overridden by the configuration of the host
+// and then by the overrides of the resource that exposes the host.
+func (c Configuration) endpoint(host string, overrides EndpointConfiguration) EndpointConfiguration {
+	ep := c.Global
+	if custom, ok := c.Hosts[host]; ok {
+		ep = ep.override(custom)
+	}
+	return ep.override(overrides)
+}
+
+// Sources determine which resource types are watched.
+type Sources struct {
+	Ingresses  bool `yaml:"ingresses"`
+	HTTPRoutes bool `yaml:"httproutes"`
+	Services   bool `yaml:"services"`
 }
 
+// Selectors determine which ingresses are monitored. An ingress is selected if it matches any of the Include selectors
+// (or Include is empty) and does not match any of the Exclude selectors.
+type Selectors struct {
+	Include []Selector `yaml:"include,omitempty"`
+	Exclude []Selector `yaml:"exclude,omitempty"`
+}
+
+// Selector matches a resource if all its configured criteria match. Kind limits the selector to one resource type
+// (ingress, httproute or service). For HTTPRoutes, IngressClass matches the GatewayClass of the route's parent Gateway.
+type Selector struct {
+	Kind         string              `yaml:"kind,omitempty"`
+	Annotation   *AnnotationSelector `yaml:"annotation,omitempty"`
+	Labels       string              `yaml:"labels,omitempty"`
+	IngressClass string              `yaml:"ingress-class,omitempty"`
+}
+
+// AnnotationSelector matches the value of an annotation. If no Value, Regex or Entrypoint is set, the annotation only
+// needs to be present. Entrypoint matches if the annotation holds a comma-separated list that contains the entrypoint.
+type AnnotationSelector struct {
+	Name       string `yaml:"name"`
+	Value      string `yaml:"value,omitempty"`
+	Regex      string `yaml:"regex,omitempty"`
+	Entrypoint string `yaml:"entrypoint,omitempty"`
+	// regex is the compiled Regex, set when the configuration is validated.
+	regex *regexp.Regexp
+}
+
+const (
+	traefikEndpointAnnotation = "traefik.ingress.kubernetes.io/router.entrypoints"
+	traefikExternalEndpoint   = "websecure"
+)
+
 var (
 	DefaultConfiguration = Configuration{
-		Global: DefaultGlobalConfiguration,
+		Sources:   DefaultSources,
+		Selectors: DefaultSelectors,
+		Global:    DefaultGlobalConfiguration,
+	}
+	DefaultSources = Sources{
+		Ingresses: true,
+	}
+	DefaultSelectors = Selectors{
+		Include: []Selector{
+			{Kind: ingressKind, Annotation: &AnnotationSelector{Name: traefikEndpointAnnotation, Value: traefikExternalEndpoint}},
+			{Kind: httpRouteKind},
+			{Kind: serviceKind, Annotation: &AnnotationSelector{Name: monitorAnnotation, Value: "true"}},
+		},
 	}
 	DefaultGlobalConfiguration = EndpointConfiguration{
 		Interval:         5 * time.Minute,
@@ -36,8 +171,10 @@ var (
 
 func Load(r io.Reader) (Configuration, error) {
 	configuration := DefaultConfiguration
-	err := yaml.NewDecoder(r).Decode(&configuration)
-	return configuration, err
+	if err := yaml.NewDecoder(r).Decode(&configuration); err != nil {
+		return configuration, err
+	}
+	return configuration, configuration.Validate()
 }
 
 func LoadFromFile(filename string) (Configuration, error) {
@@ -48,3 +185,51 @@ func LoadFromFile(filename string) (Configuration, error) {
 	defer func() { _ = f.Close() }()
 	return Load(f)
 }
+
+func (c Configuration) Validate() error {
+	for host, ep := range c.Hosts {
+		if err := ep.validate(); err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+	}
+	if err := c.Global.validate(); err != nil {
+		return fmt.Errorf("global: %w", err)
+	}
+	return c.Selectors.validate()
+}
+
+func (s Selectors) validate() error {
+	for _, selector := range append(s.Include, s.Exclude...) {
+		if err := selector.validate(); err != nil {
+			return fmt.Errorf("selector: %w", err)
+		}
+	}
+	return nil
+}
+
+// validate returns an error if the selector is invalid. It compiles the regex of the annotation selector, so events
+// don't need to compile it again.
+func (s Selector) validate() error {
+	switch s.Kind {
+	case "", ingressKind, httpRouteKind, serviceKind:
+	default:
+		return fmt.Errorf("invalid kind: %s", s.Kind)
+	}
+	if s.Annotation != nil {
+		if s.Annotation.Name == "" {
+			return errors.New("annotation: missing name")
+		}
+		if s.Annotation.Regex != "" {
+			var err error
+			if s.Annotation.regex, err = regexp.Compile(s.Annotation.Regex); err != nil {
+				return fmt.Errorf("annotation: invalid regex: %w", err)
+			}
+		}
+	}
+	if s.Labels != "" {
+		if _, err := labels.Parse(s.Labels); err != nil {
+			return fmt.Errorf("labels: %w", err)
+		}
+	}
+	return nil
+}
@@ -23,17 +23,23 @@ func TestConfiguration(t *testing.T) {
 		{
 			name: "global",
 			input: Configuration{
-				Monitor: "http://localhost:8080",
-				Token:   "1234",
-				Global:  DefaultGlobalConfiguration,
+				Monitor:   "http://localhost:8080",
+				Token:     "1234",
+				Sources:   DefaultSources,
+				Selectors: DefaultSelectors,
+				Global:    DefaultGlobalConfiguration,
 			},
 		},
 		{
 			name: "hosts",
 			input: Configuration{
-				Monitor: "http://localhost:8080",
-				Token:   "1234",
-				Global:  DefaultGlobalConfiguration,
+				Monitor:   "http://localhost:8080",
+				Token:     "1234",
+				ID:        "production",
+				Metadata:  Metadata{Labels: []string{"team"}, Annotations: []string{"owner"}},
+				Sources:   DefaultSources,
+				Selectors: DefaultSelectors,
+				Global:    DefaultGlobalConfiguration,
 				Hosts: map[string]EndpointConfiguration{
 					"http://localhost:8080": {
 						Interval:         5 * time.Minute,
@@ -43,7 +49,34 @@ func TestConfiguration(t *testing.T) {
 					"http://localhost:9090": {
 						Skip: true,
 					},
+					"http://localhost:9091": {
+						Method:     http.MethodPost,
+						Headers:    map[string]string{"Accept": "application/json"},
+						Body:       `{"ping":true}`,
+						HostHeader: "www.example.com",
+						UserAgent:  "uptime",
+					},
+				},
+			},
+		},
+		{
+			name: "selectors",
+			input: Configuration{
+				Monitor: "http://localhost:8080",
+				Token:   "1234",
+				ID:      "production",
+				Sources: Sources{Ingresses: true, HTTPRoutes: true},
+				Selectors: Selectors{
+					Include: []Selector{
+						{Annotation: &AnnotationSelector{Name: traefikEndpointAnnotation, Entrypoint: traefikExternalEndpoint}},
+						{IngressClass: "nginx"},
+					},
+					Exclude: []Selector{
+						{Labels: "visibility=internal"},
+						{Annotation: &AnnotationSelector{Name: "haproxy.org/whitelist", Regex: "^10\\."}},
+					},
 				},
+				Global: DefaultGlobalConfiguration,
 			},
 		},
 	}
@@ -63,6 +96,8 @@ func TestConfiguration(t *testing.T) {
 
 			read, err := LoadFromFile(fp)
 			require.NoError(t, err)
+			// validating compiles the selectors' regexes, as loading does
+			require.NoError(t, tt.input.Validate())
 			assert.Equal(t, tt.input, read)
 		})
 	}
@@ -76,9 +111,81 @@ token: "1234"
 	require.NoError(t, err)
 
 	want := Configuration{
-		Monitor: "http://localhost:8080",
-		Token:   "1234",
-		Global:  DefaultGlobalConfiguration,
+		Monitor:   "http://localhost:8080",
+		Token:     "1234",
+		Sources:   DefaultSources,
+		Selectors: DefaultSelectors,
+		Global:    DefaultGlobalConfiguration,
 	}
 	assert.Equal(t, want, read)
 }
+
+func TestConfiguration_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "default",
+			input:   `monitor: http://localhost:8080`,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "empty id",
+			input:   `id: ""`,
+			wantErr: assert.NoError,
+		},
+		{
+			name: "invalid slo",
+			input: `hosts:
+  example.com:
+    slo: 1.5
+`,
+			wantErr: assert.Error,
+		},
+		{
+			name: "missing annotation name",
+			input: `selectors:
+  include:
+    - annotation:
+        value: websecure
+`,
+			wantErr: assert.Error,
+		},
+		{
+			name: "invalid regex",
+			input: `selectors:
+  exclude:
+    - annotation:
+        name: foo
+        regex: "["
+`,
+			wantErr: assert.Error,
+		},
+		{
+			name: "invalid kind",
+			input: `selectors:
+  include:
+    - kind: pod
+`,
+			wantErr: assert.Error,
+		},
+		{
+			name: "invalid labels",
+			input: `selectors:
+  include:
+    - labels: "foo in ("
+`,
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Load(bytes.NewBufferString(tt.input))
+			tt.wantErr(t, err)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package agent
 
 import (
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
 	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"log/slog"
 )
 
@@ -12,37 +15,95 @@ const (
 	deleteEvent eventType = "DELETE"
 )
 
+const (
+	ingressKind   = "ingress"
+	httpRouteKind = "httproute"
+	serviceKind   = "service"
+)
+
 var _ slog.LogValuer = event{}
 
+// event records a change to a kubernetes resource (an Ingress, an HTTPRoute or a Service) that exposes one or more
+// hosts. probeType determines how the monitor checks the hosts. For an update that keeps the hosts of the resource,
+// previous holds the event of the resource before the update.
 type event struct {
-	eventType eventType
-	ingress   *netv1.Ingress
+	eventType    eventType
+	kind         string
+	object       metav1.Object
+	targets      []string
+	class        string
+	probeType    string
+	skippedHosts set.Set[string]
+	overrides    ingressOverrides
+	previous     *event
+}
+
+func newIngressEvent(t eventType, ingress *netv1.Ingress) event {
+	ev := event{
+		eventType: t,
+		kind:      ingressKind,
+		object:    ingress,
+		probeType: handlers.ProbeHTTP,
+		targets:   make([]string, len(ingress.Spec.Rules)),
+	}
+	for i := range ingress.Spec.Rules {
+		ev.targets[i] = ingress.Spec.Rules[i].Host
+	}
+	if ingress.Spec.IngressClassName != nil {
+		ev.class = *ingress.Spec.IngressClassName
+	}
+	return ev
+}
+
+func (e event) key() string {
+	return e.kind + ":" + e.namespace() + ":" + e.name()
 }
 
 func (e event) name() string {
-	return e.ingress.Name
+	return e.object.GetName()
 }
 
 func (e event) namespace() string {
-	return e.ingress.Namespace
+	return e.object.GetNamespace()
+}
+
+func (e event) annotation(annotation string) (string, bool) {
+	v, ok := e.object.GetAnnotations()[annotation]
+	return v, ok
+}
+
+func (e event) annotations() map[string]string {
+	return e.object.GetAnnotations()
 }
 
-func (e event) hasAnnotation(annotation, value string) bool {
-	v, ok := e.ingress.Annotations[annotation]
-	return ok && v == value
+func (e event) labels() map[string]string {
+	return e.object.GetLabels()
+}
+
+func (e event) ingressClass() string {
+	return e.class
 }
 
 func (e event) targetHosts() []string {
-	targets := make([]string, len(e.ingress.Spec.Rules))
-	for i := range e.ingress.Spec.Rules {
-		targets[i] = e.ingress.Spec.Rules[i].Host
+	return e.targets
+}
+
+// hosts returns the target hosts of the resource that are not on the skip list.
+func (e event) hosts() []string {
+	targets := e.targetHosts()
+	hosts := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if !e.skippedHosts.Contains(target) {
+			hosts = append(hosts, target)
+		}
 	}
-	return targets
+	return hosts
 }
 
 func (e event) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.String("type", string(e.eventType)),
+		slog.String("kind", e.kind),
 		slog.String("name", e.name()),
 		slog.String("namespace", e.namespace()),
 	)
@@ -1 +1,23 @@
 package agent
+
+import (
+	"github.com/clambin/go-common/set"
+	"github.com/stretchr/testify/assert"
+	netv1 "k8s.io/api/networking/v1"
+	"testing"
+)
+
+func TestEvent_hosts(t *testing.T) {
+	ingress := netv1.Ingress{
+		Spec: netv1.IngressSpec{
+			Rules: []netv1.IngressRule{{Host: "example.com"}, {Host: "admin.example.com"}},
+		},
+	}
+
+	ev := newIngressEvent(addEvent, &ingress)
+	assert.Equal(t, []string{"example.com", "admin.example.com"}, ev.hosts())
+
+	ev.skippedHosts = set.New("admin.example.com")
+	assert.Equal(t, []string{"example.com"}, ev.hosts())
+	assert.Equal(t, []string{"example.com", "admin.example.com"}, ev.targetHosts())
+}
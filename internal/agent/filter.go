@@ -2,13 +2,19 @@ package agent
 
 import (
 	"context"
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"k8s.io/apimachinery/pkg/labels"
 	"log/slog"
+	"slices"
+	"strings"
 )
 
 type filter struct {
 	in            <-chan event
 	out           chan<- event
 	configuration Configuration
+	metrics       *Metrics
 	logger        *slog.Logger
 }
 
@@ -16,7 +22,10 @@ func (f *filter) Run(ctx context.Context) {
 	for {
 		select {
 		case ev := <-f.in:
-			if f.shouldForward(ev) {
+			if deleted, ok := f.unregistered(ev); ok {
+				f.out <- deleted
+			}
+			if ev, ok := f.apply(ev); ok {
 				f.out <- ev
 			}
 		case <-ctx.Done():
@@ -25,35 +34,138 @@ func (f *filter) Run(ctx context.Context) {
 	}
 }
 
-const (
-	traefikEndpointAnnotation = "traefik.ingress.kubernetes.io/router.entrypoints"
-	traefikExternalEndpoint   = "websecure"
-)
+// apply determines if the event should be forwarded and marks any hosts on the skip list, so the sender only
+// registers (and deletes) the remaining hosts.
+func (f *filter) apply(ev event) (event, bool) {
+	if !f.configuration.Selectors.selects(ev) {
+		f.logger.Debug("ingress skipped: not selected", "event", ev)
+		return ev, false
+	}
+	var errs []*annotationError
+	ev.overrides, errs = parseAnnotations(ev.annotations())
+	for _, err := range errs {
+		f.logger.Warn("ingress has invalid annotation. ignoring", "event", ev, "err", err)
+		if f.metrics != nil {
+			f.metrics.ObserveInvalidAnnotation(ev, err.annotation)
+		}
+	}
+	ev.skippedHosts = f.skippedHosts(ev)
+	ev.previous = nil
+	if len(ev.hosts()) == 0 {
+		f.logger.Debug("ingress skipped: all hosts on skip list", "event", ev)
+		return ev, false
+	}
+	if len(ev.skippedHosts) > 0 {
+		f.logger.Debug("hosts skipped: host on skip list", "event", ev, "hosts", ev.skippedHosts.ListOrdered())
+	}
+	return ev, true
+}
+
+// unregistered returns a delete event for the hosts that an update put on the skip list, or whose target changed
+// (e.g. because the path annotation changed), so the sender deletes their previous targets and the reSender no longer
+// reconciles them.
+func (f *filter) unregistered(ev event) (event, bool) {
+	if ev.previous == nil || !f.configuration.Selectors.selects(*ev.previous) {
+		return event{}, false
+	}
+	current := f.withSkippedHosts(ev)
+	deleted := f.withSkippedHosts(*ev.previous)
+	deleted.eventType = deleteEvent
+	deleted.previous = nil
+	previouslySkipped := deleted.skippedHosts
+	deleted.skippedHosts = set.New[string]()
+	for _, host := range deleted.targetHosts() {
+		if previouslySkipped.Contains(host) || (!current.skippedHosts.Contains(host) && f.target(current, host) == f.target(deleted, host)) {
+			deleted.skippedHosts.Add(host)
+		}
+	}
+	if len(deleted.hosts()) == 0 {
+		return event{}, false
+	}
+	f.logger.Debug("deleting previous targets", "event", deleted, "hosts", deleted.hosts())
+	return deleted, true
+}
+
+// target returns the target that the sender registers for the host of the event. The monitor identifies targets by
+// their target.
+func (f *filter) target(ev event, host string) string {
+	if ev.probeType == handlers.ProbeTCP {
+		return host
+	}
+	return host + f.configuration.endpoint(host, ev.overrides.endpoint).Path
+}
+
+// withSkippedHosts marks the hosts on the skip list. Invalid annotations are reported by apply.
+func (f *filter) withSkippedHosts(ev event) event {
+	ev.overrides, _ = parseAnnotations(ev.annotations())
+	ev.skippedHosts = f.skippedHosts(ev)
+	return ev
+}
+
+// skippedHosts returns the hosts that should not be monitored. The skip annotation of the ingress takes precedence
+// over the hosts' skip configuration.
+func (f *filter) skippedHosts(ev event) set.Set[string] {
+	skipped := set.New[string]()
+	for _, host := range ev.targetHosts() {
+		skip := f.configuration.Hosts[host].Skip
+		if ev.overrides.skip != nil {
+			skip = *ev.overrides.skip
+		}
+		if skip {
+			skipped.Add(host)
+		}
+	}
+	return skipped
+}
+
+func (s Selectors) selects(ev event) bool {
+	included := len(s.Include) == 0 || slices.ContainsFunc(s.Include, func(selector Selector) bool { return selector.matches(ev) })
+	excluded := slices.ContainsFunc(s.Exclude, func(selector Selector) bool { return selector.matches(ev) })
+	return included && !excluded
+}
 
-func (f *filter) shouldForward(ev event) bool {
-	if !f.hasAnnotations(ev) {
-		f.logger.Debug("ingress skipped: missing annotations", "event", ev)
+func (s Selector) matches(ev event) bool {
+	if s.Kind != "" && s.Kind != ev.kind {
 		return false
 	}
-	if f.skip(ev) {
-		f.logger.Debug("ingress skipped: host on skip list", "event", ev)
+	if s.Annotation != nil && !s.Annotation.matches(ev) {
+		return false
+	}
+	if s.Labels != "" {
+		// selectors are validated when the configuration is loaded
+		selector, err := labels.Parse(s.Labels)
+		if err != nil || !selector.Matches(labels.Set(ev.labels())) {
+			return false
+		}
+	}
+	if s.IngressClass != "" && s.IngressClass != ev.ingressClass() {
 		return false
 	}
 	return true
 }
 
-func (f *filter) hasAnnotations(ev event) bool {
-	// TODO: make this configurable
-	return ev.hasAnnotation(traefikEndpointAnnotation, traefikExternalEndpoint)
+func (s AnnotationSelector) matches(ev event) bool {
+	value, ok := ev.annotation(s.Name)
+	if !ok {
+		return false
+	}
+	if s.Value != "" && value != s.Value {
+		return false
+	}
+	// the regex is compiled when the configuration is validated
+	if s.Regex != "" && (s.regex == nil || !s.regex.MatchString(value)) {
+		return false
+	}
+	if s.Entrypoint != "" && !slices.Contains(splitList(value), s.Entrypoint) {
+		return false
+	}
+	return true
 }
 
-func (f *filter) skip(ev event) bool {
-	// TODO: if any of the hosts are on the skip list, we skip the entire ingress. make it more granular?
-	for _, host := range ev.targetHosts() {
-		cfg, ok := f.configuration.Hosts[host]
-		if ok && cfg.Skip {
-			return true
-		}
+func splitList(value string) []string {
+	entries := strings.Split(value, ",")
+	for i := range entries {
+		entries[i] = strings.TrimSpace(entries[i])
 	}
-	return false
+	return entries
 }
@@ -1,67 +1,353 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	netv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"log/slog"
 	"testing"
+	"time"
 )
 
 func TestFilter_Run(t *testing.T) {
 	in := make(chan event)
 	out := make(chan event, 1)
 	f := filter{
-		in:  in,
-		out: out,
+		in:     in,
+		out:    out,
+		logger: slog.Default(),
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go f.Run(ctx)
 
-	evIn := event{eventType: addEvent, ingress: &validIngress}
-	in <- evIn
-	assert.Equal(t, evIn, <-out)
+	in <- newIngressEvent(addEvent, &validIngress)
+	evOut := <-out
+	assert.Equal(t, addEvent, evOut.eventType)
+	assert.Equal(t, &validIngress, evOut.object)
 }
 
-func TestFilter_shouldForward(t *testing.T) {
+func TestFilter_apply(t *testing.T) {
+	multiHostIngress := netv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        "multi",
+			Namespace:   "foo",
+			Annotations: map[string]string{traefikEndpointAnnotation: traefikExternalEndpoint},
+		},
+		Spec: netv1.IngressSpec{
+			Rules: []netv1.IngressRule{{Host: "example.com"}, {Host: "admin.example.com"}},
+		},
+	}
+
 	tests := []struct {
-		name   string
-		config Configuration
-		event  event
-		want   assert.BoolAssertionFunc
+		name      string
+		config    Configuration
+		event     event
+		want      assert.BoolAssertionFunc
+		wantHosts []string
 	}{
 		{
-			name:   "pass",
-			config: DefaultConfiguration,
-			event:  event{eventType: addEvent, ingress: &validIngress},
-			want:   assert.True,
+			name:      "pass",
+			config:    DefaultConfiguration,
+			event:     newIngressEvent(addEvent, &validIngress),
+			want:      assert.True,
+			wantHosts: []string{"example.com"},
 		},
 		{
 			name:   "no annotations",
 			config: DefaultConfiguration,
-			event:  event{eventType: addEvent, ingress: &invalidIngress},
+			event:  newIngressEvent(addEvent, &invalidIngress),
 			want:   assert.False,
 		},
 		{
-			name:   "no skip",
-			config: Configuration{Hosts: map[string]EndpointConfiguration{"foo.com": DefaultGlobalConfiguration}},
-			event:  event{eventType: addEvent, ingress: &validIngress},
-			want:   assert.True,
+			name:      "no skip",
+			config:    Configuration{Hosts: map[string]EndpointConfiguration{"foo.com": DefaultGlobalConfiguration}},
+			event:     newIngressEvent(addEvent, &validIngress),
+			want:      assert.True,
+			wantHosts: []string{"example.com"},
 		},
 		{
 			name:   "skip",
 			config: Configuration{Hosts: map[string]EndpointConfiguration{"example.com": {Skip: true}}},
-			event:  event{eventType: addEvent, ingress: &validIngress},
+			event:  newIngressEvent(addEvent, &validIngress),
+			want:   assert.False,
+		},
+		{
+			name:      "skip one host",
+			config:    Configuration{Hosts: map[string]EndpointConfiguration{"admin.example.com": {Skip: true}}},
+			event:     newIngressEvent(addEvent, &multiHostIngress),
+			want:      assert.True,
+			wantHosts: []string{"example.com"},
+		},
+		{
+			name:      "skip one host on delete",
+			config:    Configuration{Hosts: map[string]EndpointConfiguration{"admin.example.com": {Skip: true}}},
+			event:     newIngressEvent(deleteEvent, &multiHostIngress),
+			want:      assert.True,
+			wantHosts: []string{"example.com"},
+		},
+		{
+			name:   "skip annotation",
+			config: DefaultConfiguration,
+			event:  newIngressEvent(addEvent, withAnnotations(&multiHostIngress, map[string]string{skipAnnotation: "true"})),
 			want:   assert.False,
 		},
+		{
+			name:      "skip annotation overrides hosts configuration",
+			config:    Configuration{Hosts: map[string]EndpointConfiguration{"admin.example.com": {Skip: true}}},
+			event:     newIngressEvent(addEvent, withAnnotations(&multiHostIngress, map[string]string{skipAnnotation: "false"})),
+			want:      assert.True,
+			wantHosts: []string{"example.com", "admin.example.com"},
+		},
+		{
+			name:      "invalid annotations are ignored",
+			config:    DefaultConfiguration,
+			event:     newIngressEvent(addEvent, withAnnotations(&multiHostIngress, map[string]string{skipAnnotation: "maybe"})),
+			want:      assert.True,
+			wantHosts: []string{"example.com", "admin.example.com"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			f := filter{configuration: tt.config, logger: slog.Default()}
-			tt.want(t, f.shouldForward(tt.event))
+			ev, ok := f.apply(tt.event)
+			tt.want(t, ok)
+			if ok {
+				assert.Equal(t, tt.wantHosts, ev.hosts())
+			}
+		})
+	}
+}
+
+func TestFilter_apply_InvalidAnnotations(t *testing.T) {
+	ingress := withAnnotations(&validIngress, map[string]string{intervalAnnotation: "never"})
+	m := NewMetrics("", "", nil)
+	f := filter{configuration: DefaultConfiguration, metrics: m, logger: slog.Default()}
+
+	_, ok := f.apply(newIngressEvent(addEvent, ingress))
+	assert.True(t, ok)
+	assert.NoError(t, testutil.CollectAndCompare(m, bytes.NewBufferString(`
+# HELP invalid_annotations_count number of invalid uptime annotations found on ingresses
+# TYPE invalid_annotations_count counter
+invalid_annotations_count{annotation="uptime.clambin.github.io/interval",name="valid",namespace="foo"} 1
+`), "invalid_annotations_count"))
+}
+
+// withAnnotations returns a copy of the ingress with the additional annotations.
+func withAnnotations(ingress *netv1.Ingress, annotations map[string]string) *netv1.Ingress {
+	ingress = ingress.DeepCopy()
+	for key, value := range annotations {
+		ingress.Annotations[key] = value
+	}
+	return ingress
+}
+
+func TestSelectors_selects(t *testing.T) {
+	nginx := "nginx"
+	ingress := netv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "ingress",
+			Namespace: "foo",
+			Labels:    map[string]string{"app": "foo", "visibility": "public"},
+			Annotations: map[string]string{
+				traefikEndpointAnnotation:  "web, websecure",
+				"haproxy.org/whitelist":    "10.0.0.0/8",
+				"example.com/monitor-this": "",
+			},
+		},
+		Spec: netv1.IngressSpec{
+			IngressClassName: &nginx,
+			Rules:            []netv1.IngressRule{{Host: "example.com"}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		selectors Selectors
+		want      assert.BoolAssertionFunc
+	}{
+		{
+			name: "empty",
+			want: assert.True,
+		},
+		{
+			name:      "exact annotation: mismatch",
+			selectors: DefaultSelectors,
+			want:      assert.False,
+		},
+		{
+			name:      "annotation present",
+			selectors: Selectors{Include: []Selector{{Annotation: &AnnotationSelector{Name: "example.com/monitor-this"}}}},
+			want:      assert.True,
+		},
+		{
+			name:      "annotation missing",
+			selectors: Selectors{Include: []Selector{{Annotation: &AnnotationSelector{Name: "example.com/missing"}}}},
+			want:      assert.False,
+		},
+		{
+			name:      "annotation regex",
+			selectors: Selectors{Include: []Selector{{Annotation: &AnnotationSelector{Name: "haproxy.org/whitelist", Regex: `^10\.`}}}},
+			want:      assert.True,
+		},
+		{
+			name:      "annotation regex: mismatch",
+			selectors: Selectors{Include: []Selector{{Annotation: &AnnotationSelector{Name: "haproxy.org/whitelist", Regex: `^192\.`}}}},
+			want:      assert.False,
+		},
+		{
+			name:      "entrypoint",
+			selectors: Selectors{Include: []Selector{{Annotation: &AnnotationSelector{Name: traefikEndpointAnnotation, Entrypoint: traefikExternalEndpoint}}}},
+			want:      assert.True,
+		},
+		{
+			name:      "entrypoint: mismatch",
+			selectors: Selectors{Include: []Selector{{Annotation: &AnnotationSelector{Name: traefikEndpointAnnotation, Entrypoint: "internal"}}}},
+			want:      assert.False,
+		},
+		{
+			name:      "labels",
+			selectors: Selectors{Include: []Selector{{Labels: "app=foo,visibility!=internal"}}},
+			want:      assert.True,
+		},
+		{
+			name:      "labels: mismatch",
+			selectors: Selectors{Include: []Selector{{Labels: "app in (bar,snafu)"}}},
+			want:      assert.False,
+		},
+		{
+			name:      "ingress class",
+			selectors: Selectors{Include: []Selector{{IngressClass: "nginx"}}},
+			want:      assert.True,
+		},
+		{
+			name:      "ingress class: mismatch",
+			selectors: Selectors{Include: []Selector{{IngressClass: "traefik"}}},
+			want:      assert.False,
+		},
+		{
+			name:      "all criteria must match",
+			selectors: Selectors{Include: []Selector{{IngressClass: "nginx", Labels: "app=bar"}}},
+			want:      assert.False,
+		},
+		{
+			name:      "any include must match",
+			selectors: Selectors{Include: []Selector{{IngressClass: "traefik"}, {Labels: "app=foo"}}},
+			want:      assert.True,
+		},
+		{
+			name: "exclude",
+			selectors: Selectors{
+				Include: []Selector{{IngressClass: "nginx"}},
+				Exclude: []Selector{{Labels: "visibility=public"}},
+			},
+			want: assert.False,
+		},
+		{
+			name:      "exclude only",
+			selectors: Selectors{Exclude: []Selector{{Labels: "visibility=internal"}}},
+			want:      assert.True,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.NoError(t, tt.selectors.validate())
+			tt.want(t, tt.selectors.selects(newIngressEvent(addEvent, &ingress)))
+		})
+	}
+}
+
+func TestFilter_Run_SkipOnUpdate(t *testing.T) {
+	multiHostIngress := withAnnotations(&validIngress, nil)
+	multiHostIngress.Spec.Rules = append(multiHostIngress.Spec.Rules, netv1.IngressRule{Host: "admin.example.com"})
+
+	type wantEvent struct {
+		eventType eventType
+		hosts     []string
+	}
+	tests := []struct {
+		name   string
+		config Configuration
+		old    *netv1.Ingress
+		new    *netv1.Ingress
+		want   []wantEvent
+	}{
+		{
+			name:   "skip all hosts",
+			config: DefaultConfiguration,
+			old:    multiHostIngress,
+			new:    withAnnotations(multiHostIngress, map[string]string{skipAnnotation: "true"}),
+			want:   []wantEvent{{deleteEvent, []string{"example.com", "admin.example.com"}}},
+		},
+		{
+			name:   "skip one host",
+			config: Configuration{Selectors: DefaultSelectors, Hosts: map[string]EndpointConfiguration{"admin.example.com": {Skip: true}}},
+			old:    withAnnotations(multiHostIngress, map[string]string{skipAnnotation: "false"}),
+			new:    multiHostIngress,
+			want: []wantEvent{
+				{deleteEvent, []string{"admin.example.com"}},
+				{addEvent, []string{"example.com"}},
+			},
+		},
+		{
+			name:   "unskip",
+			config: DefaultConfiguration,
+			old:    withAnnotations(multiHostIngress, map[string]string{skipAnnotation: "true"}),
+			new:    multiHostIngress,
+			want:   []wantEvent{{addEvent, []string{"example.com", "admin.example.com"}}},
+		},
+		{
+			name:   "path",
+			config: DefaultConfiguration,
+			old:    withAnnotations(multiHostIngress, map[string]string{pathAnnotation: "/healthz"}),
+			new:    withAnnotations(multiHostIngress, map[string]string{pathAnnotation: "/readyz"}),
+			want: []wantEvent{
+				{deleteEvent, []string{"example.com", "admin.example.com"}},
+				{addEvent, []string{"example.com", "admin.example.com"}},
+			},
+		},
+		{
+			name:   "other annotation",
+			config: DefaultConfiguration,
+			old:    multiHostIngress,
+			new:    withAnnotations(multiHostIngress, map[string]string{intervalAnnotation: "1m"}),
+			want:   []wantEvent{{addEvent, []string{"example.com", "admin.example.com"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			in := make(chan event, 2)
+			out := make(chan event, 2)
+			w := watcher{
+				out:       in,
+				newEvent:  func(t eventType, obj any) event { return newIngressEvent(t, obj.(*netv1.Ingress)) },
+				selectors: tt.config.Selectors,
+				logger:    slog.Default(),
+			}
+			f := filter{in: in, out: out, configuration: tt.config, logger: slog.Default()}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go f.Run(ctx)
+
+			w.OnUpdate(tt.old, tt.new)
+			for _, want := range tt.want {
+				ev := <-out
+				assert.Equal(t, want.eventType, ev.eventType)
+				assert.Equal(t, want.hosts, ev.hosts())
+				assert.Nil(t, ev.previous)
+			}
+			assert.Never(t, func() bool { return len(out) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
 		})
 	}
 }
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"k8s.io/client-go/tools/cache"
+	"log/slog"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"strings"
+)
+
+// newHTTPRouteEvent creates an event for an HTTPRoute. The listeners of the route's parent Gateways determine the
+// scheme of the targets: hosts are checked over plain http only if none of the matching listeners use HTTPS.
+// If the route does not specify any hostnames, the (non-wildcard) hostnames of the listeners are used instead.
+func newHTTPRouteEvent(t eventType, route *gatewayv1.HTTPRoute, gateways gatewayGetter, logger *slog.Logger) event {
+	ev := event{
+		eventType: t,
+		kind:      httpRouteKind,
+		object:    route,
+		probeType: handlers.ProbeHTTP,
+	}
+
+	var listeners []gatewayv1.Listener
+	for _, parent := range route.Spec.ParentRefs {
+		gateway, ok := getParentGateway(route.Namespace, parent, gateways, logger)
+		if !ok {
+			continue
+		}
+		if ev.class == "" {
+			ev.class = string(gateway.Spec.GatewayClassName)
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			if listenerMatches(listener, parent) {
+				listeners = append(listeners, listener)
+			}
+		}
+	}
+
+	hostnames := make([]string, 0, len(route.Spec.Hostnames))
+	for _, hostname := range route.Spec.Hostnames {
+		hostnames = append(hostnames, string(hostname))
+	}
+	if len(hostnames) == 0 {
+		for _, listener := range listeners {
+			if listener.Hostname != nil && !strings.HasPrefix(string(*listener.Hostname), "*") {
+				hostnames = append(hostnames, string(*listener.Hostname))
+			}
+		}
+	}
+
+	var prefix string
+	if len(listeners) > 0 && !hasHTTPSListener(listeners) {
+		prefix = "http://"
+	}
+	ev.targets = make([]string, len(hostnames))
+	for i := range hostnames {
+		ev.targets[i] = prefix + hostnames[i]
+	}
+	return ev
+}
+
+// gatewayGetter looks up a Gateway by its namespace/name key. cache.Store implements gatewayGetter.
+type gatewayGetter interface {
+	GetByKey(key string) (any, bool, error)
+}
+
+func getParentGateway(namespace string, parent gatewayv1.ParentReference, gateways gatewayGetter, logger *slog.Logger) (*gatewayv1.Gateway, bool) {
+	if gateways == nil {
+		return nil, false
+	}
+	key, ok := parentGatewayKey(namespace, parent)
+	if !ok {
+		return nil, false
+	}
+	obj, ok, err := gateways.GetByKey(key)
+	if err != nil || !ok {
+		logger.Debug("parent gateway not found", "key", key, "err", err)
+		return nil, false
+	}
+	gateway, ok := obj.(*gatewayv1.Gateway)
+	return gateway, ok
+}
+
+// parentGatewayKey returns the namespace/name key of the parent Gateway of a route in namespace. It returns false if
+// the parent is not a Gateway.
+func parentGatewayKey(namespace string, parent gatewayv1.ParentReference) (string, bool) {
+	if (parent.Group != nil && *parent.Group != gatewayv1.GroupName) || (parent.Kind != nil && *parent.Kind != "Gateway") {
+		return "", false
+	}
+	if parent.Namespace != nil {
+		namespace = string(*parent.Namespace)
+	}
+	return namespace + "/" + string(parent.Name), true
+}
+
+func listenerMatches(listener gatewayv1.Listener, parent gatewayv1.ParentReference) bool {
+	if parent.SectionName != nil && *parent.SectionName != listener.Name {
+		return false
+	}
+	if parent.Port != nil && *parent.Port != listener.Port {
+		return false
+	}
+	return true
+}
+
+func hasHTTPSListener(listeners []gatewayv1.Listener) bool {
+	for _, listener := range listeners {
+		if listener.Protocol == gatewayv1.HTTPSProtocolType {
+			return true
+		}
+	}
+	return false
+}
+
+// gatewayWatcher re-sends the events of the HTTPRoutes of a Gateway when the Gateway is added, changed or deleted, as
+// the Gateway determines the class, the scheme and the fallback hostnames of the route's targets. routes and gateways
+// are the stores of the HTTPRoute and Gateway informers.
+type gatewayWatcher struct {
+	watcher  watcher
+	routes   cache.Store
+	gateways cache.Store
+	logger   *slog.Logger
+}
+
+func (g gatewayWatcher) OnAdd(obj any, _ bool) {
+	gateway := obj.(*gatewayv1.Gateway)
+	g.update(gateway, nil, gateway)
+}
+
+func (g gatewayWatcher) OnUpdate(oldObj, newObj any) {
+	gateway := newObj.(*gatewayv1.Gateway)
+	g.update(gateway, oldObj.(*gatewayv1.Gateway), gateway)
+}
+
+func (g gatewayWatcher) OnDelete(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if gateway, ok := obj.(*gatewayv1.Gateway); ok {
+		g.update(gateway, gateway, nil)
+	}
+}
+
+// update sends the events of the routes of gateway, as it changed from oldGateway to newGateway. A nil Gateway did
+// not, or no longer, exist.
+func (g gatewayWatcher) update(gateway, oldGateway, newGateway *gatewayv1.Gateway) {
+	key := gateway.Namespace + "/" + gateway.Name
+	for _, obj := range g.routes.List() {
+		route := obj.(*gatewayv1.HTTPRoute)
+		if !hasParentGateway(route, key) {
+			continue
+		}
+		g.watcher.update(
+			newHTTPRouteEvent(deleteEvent, route, gatewayOverride{gateways: g.gateways, key: key, gateway: oldGateway}, g.logger),
+			newHTTPRouteEvent(addEvent, route, gatewayOverride{gateways: g.gateways, key: key, gateway: newGateway}, g.logger),
+		)
+	}
+}
+
+func hasParentGateway(route *gatewayv1.HTTPRoute, key string) bool {
+	for _, parent := range route.Spec.ParentRefs {
+		if parentKey, ok := parentGatewayKey(route.Namespace, parent); ok && parentKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+// gatewayOverride looks up Gateways in gateways, except for the Gateway with the given key, which is replaced by
+// gateway (or is not found, if gateway is nil).
+type gatewayOverride struct {
+	gateways gatewayGetter
+	key      string
+	gateway  *gatewayv1.Gateway
+}
+
+func (g gatewayOverride) GetByKey(key string) (any, bool, error) {
+	if key == g.key {
+		return g.gateway, g.gateway != nil, nil
+	}
+	if g.gateways == nil {
+		return nil, false, nil
+	}
+	return g.gateways.GetByKey(key)
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"log/slog"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"testing"
+)
+
+var (
+	validGateway = gatewayv1.Gateway{
+		ObjectMeta: v1.ObjectMeta{Name: "gateway", Namespace: "infra"},
+		Spec: gatewayv1.GatewaySpec{
+			GatewayClassName: "cilium",
+			Listeners: []gatewayv1.Listener{
+				{Name: "http", Port: 80, Protocol: gatewayv1.HTTPProtocolType},
+				{Name: "https", Port: 443, Protocol: gatewayv1.HTTPSProtocolType, Hostname: ptr[gatewayv1.Hostname]("www.example.com")},
+				{Name: "wildcard", Port: 8443, Protocol: gatewayv1.HTTPSProtocolType, Hostname: ptr[gatewayv1.Hostname]("*.example.com")},
+			},
+		},
+	}
+	validHTTPRoute = gatewayv1.HTTPRoute{
+		ObjectMeta: v1.ObjectMeta{Name: "route", Namespace: "foo"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{{Name: "gateway", Namespace: ptr[gatewayv1.Namespace]("infra")}},
+			},
+			Hostnames: []gatewayv1.Hostname{"route.example.com"},
+		},
+	}
+)
+
+func TestNewHTTPRouteEvent(t *testing.T) {
+	tests := []struct {
+		name        string
+		parent      gatewayv1.ParentReference
+		hostnames   []gatewayv1.Hostname
+		wantTargets []string
+		wantClass   string
+	}{
+		{
+			name:        "https",
+			parent:      validHTTPRoute.Spec.ParentRefs[0],
+			hostnames:   validHTTPRoute.Spec.Hostnames,
+			wantTargets: []string{"route.example.com"},
+			wantClass:   "cilium",
+		},
+		{
+			name:        "http listener",
+			parent:      gatewayv1.ParentReference{Name: "gateway", Namespace: ptr[gatewayv1.Namespace]("infra"), SectionName: ptr[gatewayv1.SectionName]("http")},
+			hostnames:   validHTTPRoute.Spec.Hostnames,
+			wantTargets: []string{"http://route.example.com"},
+			wantClass:   "cilium",
+		},
+		{
+			name:        "http port",
+			parent:      gatewayv1.ParentReference{Name: "gateway", Namespace: ptr[gatewayv1.Namespace]("infra"), Port: ptr[gatewayv1.PortNumber](80)},
+			hostnames:   validHTTPRoute.Spec.Hostnames,
+			wantTargets: []string{"http://route.example.com"},
+			wantClass:   "cilium",
+		},
+		{
+			name:        "listener hostnames",
+			parent:      validHTTPRoute.Spec.ParentRefs[0],
+			wantTargets: []string{"www.example.com"},
+			wantClass:   "cilium",
+		},
+		{
+			name:        "unknown gateway",
+			parent:      gatewayv1.ParentReference{Name: "gateway"},
+			hostnames:   validHTTPRoute.Spec.Hostnames,
+			wantTargets: []string{"route.example.com"},
+		},
+		{
+			name:        "not a gateway",
+			parent:      gatewayv1.ParentReference{Name: "gateway", Namespace: ptr[gatewayv1.Namespace]("infra"), Kind: ptr[gatewayv1.Kind]("Service")},
+			hostnames:   validHTTPRoute.Spec.Hostnames,
+			wantTargets: []string{"route.example.com"},
+		},
+	}
+
+	gateways := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NoError(t, gateways.Add(&validGateway))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			route := validHTTPRoute.DeepCopy()
+			route.Spec.ParentRefs = []gatewayv1.ParentReference{tt.parent}
+			route.Spec.Hostnames = tt.hostnames
+
+			ev := newHTTPRouteEvent(addEvent, route, gateways, slog.Default())
+			assert.Equal(t, httpRouteKind, ev.kind)
+			assert.Equal(t, "route", ev.name())
+			assert.Equal(t, "foo", ev.namespace())
+			assert.Equal(t, tt.wantTargets, ev.targetHosts())
+			assert.Equal(t, tt.wantClass, ev.ingressClass())
+		})
+	}
+}
+
+func TestGatewayWatcher(t *testing.T) {
+	httpGateway := validGateway.DeepCopy()
+	httpGateway.Spec.Listeners = httpGateway.Spec.Listeners[:1]
+	otherRoute := validHTTPRoute.DeepCopy()
+	otherRoute.Name = "other"
+	otherRoute.Spec.ParentRefs = []gatewayv1.ParentReference{{Name: "other", Namespace: ptr[gatewayv1.Namespace]("infra")}}
+
+	routes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NoError(t, routes.Add(&validHTTPRoute))
+	assert.NoError(t, routes.Add(otherRoute))
+	gateways := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	ch := make(chan event, 10)
+	g := gatewayWatcher{
+		watcher:  watcher{out: ch, selectors: DefaultSelectors, logger: slog.Default()},
+		routes:   routes,
+		gateways: gateways,
+		logger:   slog.Default(),
+	}
+	received := func() []string {
+		var events []string
+		for len(ch) > 0 {
+			ev := <-ch
+			assert.Equal(t, "route", ev.name())
+			for _, target := range ev.targetHosts() {
+				events = append(events, string(ev.eventType)+" "+target)
+			}
+		}
+		return events
+	}
+
+	// a gateway created after its routes
+	assert.NoError(t, gateways.Add(httpGateway))
+	g.OnAdd(httpGateway, false)
+	assert.Equal(t, []string{"DELETE route.example.com", "ADD http://route.example.com"}, received())
+
+	// a listener that switches protocol
+	assert.NoError(t, gateways.Update(&validGateway))
+	g.OnUpdate(httpGateway, &validGateway)
+	assert.Equal(t, []string{"DELETE http://route.example.com", "ADD route.example.com"}, received())
+
+	// resync
+	g.OnUpdate(&validGateway, &validGateway)
+	assert.Empty(t, received())
+
+	// deleting the gateway does not change the targets of the route
+	assert.NoError(t, gateways.Delete(&validGateway))
+	g.OnDelete(cache.DeletedFinalStateUnknown{Obj: &validGateway})
+	assert.Empty(t, received())
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
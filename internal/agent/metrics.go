@@ -8,7 +8,12 @@ import (
 var _ prometheus.Collector = Metrics{}
 
 type Metrics struct {
-	IngressEvents *prometheus.CounterVec
+	IngressEvents      *prometheus.CounterVec
+	DeliveredRequests  *prometheus.CounterVec
+	FailedRequests     *prometheus.CounterVec
+	RetriedRequests    *prometheus.CounterVec
+	InvalidAnnotations *prometheus.CounterVec
+	Reconciliations    *prometheus.CounterVec
 }
 
 func NewMetrics(namespace, subsystem string, labels map[string]string) *Metrics {
@@ -19,18 +24,87 @@ func NewMetrics(namespace, subsystem string, labels map[string]string) *Metrics
 			Name:        "ingress_events_count",
 			Help:        "number of ingress events received from kubernetes",
 			ConstLabels: labels,
-		}, []string{"name", "namespace", "type"}),
+		}, []string{"kind", "name", "namespace", "type"}),
+		DeliveredRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "delivered_requests_count",
+			Help:        "number of requests delivered to the monitor",
+			ConstLabels: labels,
+		}, []string{"host", "type"}),
+		FailedRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "failed_requests_count",
+			Help:        "number of requests that could not be delivered to the monitor",
+			ConstLabels: labels,
+		}, []string{"host", "type"}),
+		RetriedRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "retried_requests_count",
+			Help:        "number of retried requests to the monitor",
+			ConstLabels: labels,
+		}, []string{"host", "type"}),
+		InvalidAnnotations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "invalid_annotations_count",
+			Help:        "number of invalid uptime annotations found on ingresses",
+			ConstLabels: labels,
+		}, []string{"name", "namespace", "annotation"}),
+		Reconciliations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "reconciliations_count",
+			Help:        "number of times the targets were reconciled with the monitor",
+			ConstLabels: labels,
+		}, []string{"result"}),
 	}
 }
 
 func (m Metrics) ObserveEvent(ev event) {
-	m.IngressEvents.WithLabelValues(ev.name(), ev.namespace(), strings.ToLower(string(ev.eventType))).Add(1)
+	m.IngressEvents.WithLabelValues(ev.kind, ev.name(), ev.namespace(), strings.ToLower(string(ev.eventType))).Add(1)
+}
+
+func (m Metrics) ObserveDelivery(host string, ev eventType, delivered bool) {
+	counter := m.FailedRequests
+	if delivered {
+		counter = m.DeliveredRequests
+	}
+	counter.WithLabelValues(host, strings.ToLower(string(ev))).Add(1)
+}
+
+func (m Metrics) ObserveRetry(host string, ev eventType) {
+	m.RetriedRequests.WithLabelValues(host, strings.ToLower(string(ev))).Add(1)
+}
+
+func (m Metrics) ObserveInvalidAnnotation(ev event, annotation string) {
+	m.InvalidAnnotations.WithLabelValues(ev.name(), ev.namespace(), annotation).Add(1)
+}
+
+func (m Metrics) ObserveReconcile(success bool) {
+	result := "failed"
+	if success {
+		result = "success"
+	}
+	m.Reconciliations.WithLabelValues(result).Add(1)
 }
 
 func (m Metrics) Describe(ch chan<- *prometheus.Desc) {
 	m.IngressEvents.Describe(ch)
+	m.DeliveredRequests.Describe(ch)
+	m.FailedRequests.Describe(ch)
+	m.RetriedRequests.Describe(ch)
+	m.InvalidAnnotations.Describe(ch)
+	m.Reconciliations.Describe(ch)
 }
 
 func (m Metrics) Collect(ch chan<- prometheus.Metric) {
 	m.IngressEvents.Collect(ch)
+	m.DeliveredRequests.Collect(ch)
+	m.FailedRequests.Collect(ch)
+	m.RetriedRequests.Collect(ch)
+	m.InvalidAnnotations.Collect(ch)
+	m.Reconciliations.Collect(ch)
 }
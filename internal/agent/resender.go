@@ -2,13 +2,18 @@ package agent
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"time"
 )
 
+// reSender forwards events to the sender and keeps track of the current set of events. At every interval, it
+// reconciles the monitor's targets with the full set of targets, so that targets whose delete got lost are removed.
 type reSender struct {
-	in     <-chan event
-	out    chan<- event
-	events map[string]event
+	in         <-chan event
+	out        chan<- event
+	events     map[string]event
+	reconciler func(context.Context, []event)
 }
 
 func (r *reSender) Run(ctx context.Context, interval time.Duration) {
@@ -18,7 +23,7 @@ func (r *reSender) Run(ctx context.Context, interval time.Duration) {
 	for {
 		select {
 		case ev := <-r.in:
-			eventKey := ev.namespace() + ":" + ev.name()
+			eventKey := ev.key()
 			switch ev.eventType {
 			case addEvent:
 				r.events[eventKey] = ev
@@ -27,11 +32,18 @@ func (r *reSender) Run(ctx context.Context, interval time.Duration) {
 			}
 			r.out <- ev
 		case <-ticker.C:
-			for _, ev := range r.events {
-				r.out <- ev
-			}
+			r.reconciler(ctx, r.current())
 		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+func (r *reSender) current() []event {
+	events := make([]event, 0, len(r.events))
+	for _, ev := range r.events {
+		events = append(events, ev)
+	}
+	slices.SortFunc(events, func(a, b event) int { return strings.Compare(a.key(), b.key()) })
+	return events
+}
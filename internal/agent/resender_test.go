@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"testing"
 	"time"
 )
@@ -10,26 +11,54 @@ import (
 func TestReSender_Run(t *testing.T) {
 	in := make(chan event)
 	out := make(chan event)
+	var lock sync.Mutex
+	var reconciled [][]event
 	r := reSender{
 		in:     in,
 		out:    out,
 		events: make(map[string]event),
+		reconciler: func(_ context.Context, events []event) {
+			lock.Lock()
+			defer lock.Unlock()
+			reconciled = append(reconciled, events)
+		},
+	}
+	lastReconciled := func() ([]event, bool) {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(reconciled) == 0 {
+			return nil, false
+		}
+		return reconciled[len(reconciled)-1], true
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go r.Run(ctx, 500*time.Millisecond)
+	go r.Run(ctx, 100*time.Millisecond)
 
-	evIn := event{eventType: addEvent, ingress: &validIngress}
+	evIn := newIngressEvent(addEvent, &validIngress)
 	in <- evIn
 	assert.Equal(t, evIn, <-out)
-	assert.Equal(t, evIn, <-out)
+	assert.Eventually(t, func() bool {
+		events, ok := lastReconciled()
+		return ok && len(events) == 1 && events[0].key() == evIn.key()
+	}, time.Second, 10*time.Millisecond)
 
 	evIn.eventType = deleteEvent
 	in <- evIn
 	assert.Equal(t, evIn, <-out)
+	assert.Eventually(t, func() bool {
+		events, ok := lastReconciled()
+		return ok && len(events) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// events are only resent through reconciliation
 	assert.Never(t, func() bool {
-		<-out
-		return true
-	}, 500*time.Millisecond, 100*time.Millisecond)
+		select {
+		case <-out:
+			return true
+		default:
+			return false
+		}
+	}, 300*time.Millisecond, 10*time.Millisecond)
 }
@@ -1,7 +1,9 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/clambin/go-common/set"
 	"github.com/clambin/uptime/internal/monitor/handlers"
@@ -9,6 +11,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -16,9 +19,46 @@ type sender struct {
 	in            <-chan event
 	configuration Configuration
 	httpClient    *http.Client
+	backoff       backoffPolicy
+	metrics       *Metrics
 	logger        *slog.Logger
 }
 
+type backoffPolicy struct {
+	InitialWait time.Duration
+	MaxWait     time.Duration
+	Factor      float64
+	MaxAttempts int
+}
+
+var defaultBackoffPolicy = backoffPolicy{
+	InitialWait: time.Second,
+	MaxWait:     time.Minute,
+	Factor:      2,
+	MaxAttempts: 10,
+}
+
+func (p backoffPolicy) waiter() retry.Waiter {
+	return &retry.MultiplyingWaiter{InitialWait: p.InitialWait, MaxWait: p.MaxWait, Factor: p.Factor}
+}
+
+type deliveryState int
+
+const (
+	deliveryPending deliveryState = iota
+	deliveryDelivered
+	deliveryFailed
+)
+
+// delivery tracks the state of a single host's request, so that a failing host does not hold up (or abort) the
+// delivery of the other hosts of the same ingress.
+type delivery struct {
+	request  handlers.Request
+	state    deliveryState
+	attempts int
+	err      error
+}
+
 func (s sender) Run(ctx context.Context) {
 	for {
 		select {
@@ -32,21 +72,56 @@ func (s sender) Run(ctx context.Context) {
 
 func (s sender) process(ctx context.Context, ev event) {
 	l := s.logger.With("event", ev)
-	l.Debug("sending request")
-
-	method := getMethod(ev.eventType)
-	for _, request := range s.makeRequests(ev) {
-		waiter := retry.MultiplyingWaiter{InitialWait: time.Second, MaxWait: time.Millisecond, Factor: 2}
-		for {
-			err := s.send(ctx, method, request)
-			if err == nil {
-				return
+	l.Debug("sending requests")
+
+	policy := s.backoff
+	if policy == (backoffPolicy{}) {
+		policy = defaultBackoffPolicy
+	}
+	waiter := policy.waiter()
+
+	requests := s.makeRequests(ev)
+	deliveries := make([]delivery, len(requests))
+	for i := range requests {
+		deliveries[i] = delivery{request: requests[i]}
+	}
+
+	for {
+		var pending int
+		for i := range deliveries {
+			if deliveries[i].state == deliveryPending {
+				s.deliver(ctx, ev.eventType, &deliveries[i], policy.MaxAttempts, l)
 			}
-			l.Warn("request failed. waiting to retry", "err", err)
-			if waiter.Wait(ctx) != nil {
-				return
+			if deliveries[i].state == deliveryPending {
+				pending++
 			}
 		}
+		if pending == 0 || waiter.Wait(ctx) != nil {
+			return
+		}
+	}
+}
+
+func (s sender) deliver(ctx context.Context, ev eventType, d *delivery, maxAttempts int, l *slog.Logger) {
+	if d.attempts > 0 && s.metrics != nil {
+		s.metrics.ObserveRetry(d.request.Target, ev)
+	}
+	d.attempts++
+	d.err = s.send(ctx, getMethod(ev), d.request)
+
+	switch {
+	case d.err == nil:
+		d.state = deliveryDelivered
+		l.Debug("request delivered", "target", d.request.Target, "attempts", d.attempts)
+	case maxAttempts > 0 && d.attempts >= maxAttempts:
+		d.state = deliveryFailed
+		l.Error("request failed. giving up", "target", d.request.Target, "attempts", d.attempts, "err", d.err)
+	default:
+		l.Warn("request failed. waiting to retry", "target", d.request.Target, "attempts", d.attempts, "err", d.err)
+		return
+	}
+	if s.metrics != nil {
+		s.metrics.ObserveDelivery(d.request.Target, ev, d.state == deliveryDelivered)
 	}
 }
 
@@ -62,37 +137,78 @@ func getMethod(ev eventType) string {
 }
 
 func (s sender) makeRequests(ev event) []handlers.Request {
-	targets := ev.targetHosts()
+	targets := ev.hosts()
 	requests := make([]handlers.Request, len(targets))
 	for i := range targets {
-		requests[i] = s.makeRequest(targets[i])
+		requests[i] = s.makeRequest(targets[i], ev.probeType, ev.overrides.endpoint)
+		requests[i].Metadata = s.makeMetadata(ev)
 	}
 	return requests
 }
 
-func (s sender) makeRequest(host string) handlers.Request {
-	ep := s.configuration.Global
-	if custom, ok := s.configuration.Hosts[host]; ok {
-		if custom.Method != "" {
-			ep.Method = custom.Method
+// makeMetadata returns the kind, namespace and name of the resource, and the labels and annotations listed in the
+// configuration. Annotations take precedence over labels with the same key.
+func (s sender) makeMetadata(ev event) map[string]string {
+	metadata := map[string]string{
+		handlers.MetadataKind:      ev.kind,
+		handlers.MetadataNamespace: ev.namespace(),
+		handlers.MetadataName:      ev.name(),
+	}
+	for _, label := range s.configuration.Metadata.Labels {
+		if value, ok := ev.labels()[label]; ok {
+			metadata[label] = value
 		}
-		if custom.Interval != 0 {
-			ep.Interval = custom.Interval
+	}
+	for _, annotation := range s.configuration.Metadata.Annotations {
+		if value, ok := ev.annotation(annotation); ok {
+			metadata[annotation] = value
 		}
-		if custom.ValidStatusCodes != nil {
-			ep.ValidStatusCodes = custom.ValidStatusCodes
+	}
+	return metadata
+}
+
+func (s sender) makeRequest(host string, probeType string, overrides EndpointConfiguration) handlers.Request {
+	ep := s.configuration.endpoint(host, overrides)
+	if probeType == handlers.ProbeTCP {
+		return handlers.Request{
+			Target:           host,
+			Type:             probeType,
+			Interval:         ep.Interval,
+			FailureThreshold: ep.FailureThreshold,
+			SuccessThreshold: ep.SuccessThreshold,
+			SLO:              ep.SLO,
 		}
 	}
 	return handlers.Request{
-		Target:     host,
-		Method:     ep.Method,
-		ValidCodes: set.New(ep.ValidStatusCodes...),
-		Interval:   ep.Interval,
+		Target:           host + ep.Path,
+		Type:             probeType,
+		Method:           ep.Method,
+		ValidCodes:       set.New(ep.ValidStatusCodes...),
+		Interval:         ep.Interval,
+		Headers:          makeHeaders(ep.Headers),
+		Payload:          ep.Body,
+		Host:             ep.HostHeader,
+		UserAgent:        ep.UserAgent,
+		FailureThreshold: ep.FailureThreshold,
+		SuccessThreshold: ep.SuccessThreshold,
+		SLO:              ep.SLO,
+	}
+}
+
+func makeHeaders(headers map[string]string) http.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	h := make(http.Header, len(headers))
+	for name, value := range headers {
+		h.Set(name, value)
 	}
+	return h
 }
 
 func (s sender) send(ctx context.Context, method string, request handlers.Request) error {
-	r, _ := http.NewRequestWithContext(ctx, method, s.configuration.Monitor+"/target?"+request.Encode(), nil)
+	target := s.configuration.Monitor + "/target?" + request.Encode() + "&agent=" + url.QueryEscape(s.configuration.ID)
+	r, _ := http.NewRequestWithContext(ctx, method, target, nil)
 	if s.configuration.Token != "" {
 		r.Header.Set("Authorization", "Bearer "+s.configuration.Token)
 	}
@@ -108,3 +224,54 @@ func (s sender) send(ctx context.Context, method string, request handlers.Reques
 
 	return nil
 }
+
+const reconcileTimeout = 30 * time.Second
+
+// reconcile replaces the agent's targets in the monitor with the targets of the events.
+func (s sender) reconcile(ctx context.Context, events []event) {
+	var requests []handlers.Request
+	for _, ev := range events {
+		requests = append(requests, s.makeRequests(ev)...)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reconcileTimeout)
+	defer cancel()
+	result, err := s.sendReconcile(ctx, handlers.NewReconcileRequest(s.configuration.ID, requests))
+	if s.metrics != nil {
+		s.metrics.ObserveReconcile(err == nil)
+	}
+	if err != nil {
+		s.logger.Warn("failed to reconcile targets", "err", err)
+		return
+	}
+	l := s.logger.With("targets", len(requests), "added", result.Added, "updated", result.Updated, "removed", result.Removed)
+	if result == (handlers.ReconcileResult{}) {
+		l.Debug("targets reconciled")
+		return
+	}
+	l.Info("targets reconciled")
+}
+
+func (s sender) sendReconcile(ctx context.Context, request handlers.ReconcileRequest) (handlers.ReconcileResult, error) {
+	var result handlers.ReconcileResult
+	body, err := json.Marshal(request)
+	if err != nil {
+		return result, err
+	}
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPut, s.configuration.Monitor+"/targets", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if s.configuration.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+s.configuration.Token)
+	}
+	resp, err := s.httpClient.Do(r)
+	if err != nil {
+		return result, err
+	}
+	defer func(Body io.ReadCloser) { _ = Body.Close() }(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("unexpected http status: %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
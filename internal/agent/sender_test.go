@@ -1,13 +1,20 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"github.com/clambin/go-common/set"
 	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	netv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -22,9 +29,10 @@ func TestSender_makeRequests(t *testing.T) {
 		{
 			name:   "global",
 			config: DefaultConfiguration,
-			event:  event{eventType: addEvent, ingress: &validIngress},
+			event:  newIngressEvent(addEvent, &validIngress),
 			want: []handlers.Request{{
 				Target:     "example.com",
+				Type:       handlers.ProbeHTTP,
 				Method:     DefaultGlobalConfiguration.Method,
 				ValidCodes: set.New(DefaultGlobalConfiguration.ValidStatusCodes...),
 				Interval:   DefaultGlobalConfiguration.Interval,
@@ -38,9 +46,10 @@ func TestSender_makeRequests(t *testing.T) {
 					"example.com": {Method: http.MethodHead},
 				},
 			},
-			event: event{eventType: addEvent, ingress: &validIngress},
+			event: newIngressEvent(addEvent, &validIngress),
 			want: []handlers.Request{{
 				Target:     "example.com",
+				Type:       handlers.ProbeHTTP,
 				Method:     http.MethodHead,
 				ValidCodes: set.New(DefaultGlobalConfiguration.ValidStatusCodes...),
 				Interval:   DefaultGlobalConfiguration.Interval,
@@ -54,9 +63,10 @@ func TestSender_makeRequests(t *testing.T) {
 					"example.com": {Interval: time.Minute},
 				},
 			},
-			event: event{eventType: addEvent, ingress: &validIngress},
+			event: newIngressEvent(addEvent, &validIngress),
 			want: []handlers.Request{{
 				Target:     "example.com",
+				Type:       handlers.ProbeHTTP,
 				Method:     DefaultGlobalConfiguration.Method,
 				ValidCodes: set.New(DefaultGlobalConfiguration.ValidStatusCodes...),
 				Interval:   time.Minute,
@@ -70,25 +80,138 @@ func TestSender_makeRequests(t *testing.T) {
 					"example.com": {ValidStatusCodes: []int{http.StatusUnauthorized}},
 				},
 			},
-			event: event{eventType: addEvent, ingress: &validIngress},
+			event: newIngressEvent(addEvent, &validIngress),
 			want: []handlers.Request{{
 				Target:     "example.com",
+				Type:       handlers.ProbeHTTP,
 				Method:     DefaultGlobalConfiguration.Method,
 				ValidCodes: set.New(http.StatusUnauthorized),
 				Interval:   DefaultGlobalConfiguration.Interval,
 			}},
 		},
+		{
+			name: "annotations",
+			config: Configuration{
+				Global: DefaultGlobalConfiguration,
+				Hosts: map[string]EndpointConfiguration{
+					"example.com": {Method: http.MethodHead, Interval: time.Minute, Path: "/health"},
+				},
+			},
+			event: withOverrides(newIngressEvent(addEvent, &validIngress), EndpointConfiguration{Interval: time.Hour, Path: "/healthz", FailureThreshold: 3}),
+			want: []handlers.Request{{
+				Target:           "example.com/healthz",
+				Type:             handlers.ProbeHTTP,
+				Method:           http.MethodHead,
+				ValidCodes:       set.New(DefaultGlobalConfiguration.ValidStatusCodes...),
+				Interval:         time.Hour,
+				FailureThreshold: 3,
+			}},
+		},
+		{
+			name: "request customisation",
+			config: Configuration{
+				Global: EndpointConfiguration{
+					Method:           http.MethodPost,
+					ValidStatusCodes: []int{http.StatusOK},
+					Interval:         time.Minute,
+					Headers:          map[string]string{"accept": "application/json", "X-Env": "prod"},
+					UserAgent:        "uptime/1.0",
+				},
+				Hosts: map[string]EndpointConfiguration{
+					"example.com": {Headers: map[string]string{"X-Env": "test"}, Body: `{"ping":true}`, HostHeader: "www.example.com"},
+				},
+			},
+			event: newIngressEvent(addEvent, &validIngress),
+			want: []handlers.Request{{
+				Target:     "example.com",
+				Type:       handlers.ProbeHTTP,
+				Method:     http.MethodPost,
+				ValidCodes: set.New(http.StatusOK),
+				Interval:   time.Minute,
+				Headers:    http.Header{"Accept": []string{"application/json"}, "X-Env": []string{"test"}},
+				Payload:    `{"ping":true}`,
+				Host:       "www.example.com",
+				UserAgent:  "uptime/1.0",
+			}},
+		},
+		{
+			name: "service",
+			config: Configuration{
+				Global: DefaultGlobalConfiguration,
+				Hosts: map[string]EndpointConfiguration{
+					"192.168.0.10:1883": {Interval: time.Minute},
+				},
+			},
+			event: newServiceEvent(addEvent, &validService),
+			want: []handlers.Request{
+				{Target: "192.168.0.10:1883", Type: handlers.ProbeTCP, Interval: time.Minute},
+				{Target: "lb.example.com:1883", Type: handlers.ProbeTCP, Interval: DefaultGlobalConfiguration.Interval},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			s := sender{configuration: tt.config}
-			assert.Equal(t, tt.want, s.makeRequests(tt.event))
+			requests := s.makeRequests(tt.event)
+			// metadata is covered by TestSender_makeMetadata
+			for i := range requests {
+				requests[i].Metadata = nil
+			}
+			assert.Equal(t, tt.want, requests)
 		})
 	}
 }
 
+func TestSender_makeMetadata(t *testing.T) {
+	ingress := netv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        "bar",
+			Namespace:   "foo",
+			Labels:      map[string]string{"team": "infra", "app.kubernetes.io/name": "bar", "tier": "frontend"},
+			Annotations: map[string]string{"owner": "ops@example.com", "team": "web"},
+		},
+		Spec: netv1.IngressSpec{Rules: []netv1.IngressRule{{Host: "example.com"}}},
+	}
+
+	tests := []struct {
+		name     string
+		metadata Metadata
+		want     map[string]string
+	}{
+		{
+			name: "default",
+			want: map[string]string{"kind": "ingress", "namespace": "foo", "name": "bar"},
+		},
+		{
+			name:     "labels",
+			metadata: Metadata{Labels: []string{"team", "app.kubernetes.io/name", "missing"}},
+			want:     map[string]string{"kind": "ingress", "namespace": "foo", "name": "bar", "team": "infra", "app.kubernetes.io/name": "bar"},
+		},
+		{
+			name:     "annotations override labels",
+			metadata: Metadata{Labels: []string{"team"}, Annotations: []string{"team", "owner"}},
+			want:     map[string]string{"kind": "ingress", "namespace": "foo", "name": "bar", "team": "web", "owner": "ops@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := sender{configuration: Configuration{Global: DefaultGlobalConfiguration, Metadata: tt.metadata}}
+			requests := s.makeRequests(newIngressEvent(addEvent, &ingress))
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.want, requests[0].Metadata)
+		})
+	}
+}
+
+func withOverrides(ev event, overrides EndpointConfiguration) event {
+	ev.overrides.endpoint = overrides
+	return ev
+}
+
 func TestSender_Run(t *testing.T) {
 	h := server{hosts: make(map[string]bool)}
 	s := httptest.NewServer(&h)
@@ -102,6 +225,7 @@ func TestSender_Run(t *testing.T) {
 	}
 	c.configuration.Monitor = s.URL
 	c.configuration.Token = "1234"
+	c.configuration.ID = "cluster"
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -110,13 +234,13 @@ func TestSender_Run(t *testing.T) {
 	_, ok := h.getHost("foo")
 	assert.False(t, ok)
 
-	ch <- event{eventType: addEvent, ingress: &validIngress}
+	ch <- newIngressEvent(addEvent, &validIngress)
 	assert.Eventually(t, func() bool {
 		up, ok := h.getHost("example.com")
 		return up && ok
 	}, time.Second, time.Millisecond)
 
-	ch <- event{eventType: deleteEvent, ingress: &validIngress}
+	ch <- newIngressEvent(deleteEvent, &validIngress)
 	assert.Eventually(t, func() bool {
 		up, ok := h.getHost("example.com")
 		return !up && ok
@@ -124,10 +248,193 @@ func TestSender_Run(t *testing.T) {
 
 	s.Close()
 
-	ch <- event{eventType: addEvent, ingress: &validIngress}
+	ch <- newIngressEvent(addEvent, &validIngress)
 	assert.Never(t, func() bool {
 		up, ok := h.getHost("foo")
 		return up && ok
 	}, time.Second, time.Millisecond)
 
 }
+
+func TestSender_process(t *testing.T) {
+	ingress := netv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{Name: "multi", Namespace: "foo"},
+		Spec: netv1.IngressSpec{
+			Rules: []netv1.IngressRule{{Host: "a.example.com"}, {Host: "b.example.com"}, {Host: "c.example.com"}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		failures    map[string]int
+		wantHosts   []string
+		wantMetrics string
+	}{
+		{
+			name:      "all delivered",
+			wantHosts: []string{"a.example.com", "b.example.com", "c.example.com"},
+			wantMetrics: `
+# HELP delivered_requests_count number of requests delivered to the monitor
+# TYPE delivered_requests_count counter
+delivered_requests_count{host="a.example.com",type="add"} 1
+delivered_requests_count{host="b.example.com",type="add"} 1
+delivered_requests_count{host="c.example.com",type="add"} 1
+`,
+		},
+		{
+			name:      "retried",
+			failures:  map[string]int{"b.example.com": 2},
+			wantHosts: []string{"a.example.com", "b.example.com", "c.example.com"},
+			wantMetrics: `
+# HELP delivered_requests_count number of requests delivered to the monitor
+# TYPE delivered_requests_count counter
+delivered_requests_count{host="a.example.com",type="add"} 1
+delivered_requests_count{host="b.example.com",type="add"} 1
+delivered_requests_count{host="c.example.com",type="add"} 1
+# HELP retried_requests_count number of retried requests to the monitor
+# TYPE retried_requests_count counter
+retried_requests_count{host="b.example.com",type="add"} 2
+`,
+		},
+		{
+			name:      "failed",
+			failures:  map[string]int{"a.example.com": 10},
+			wantHosts: []string{"b.example.com", "c.example.com"},
+			wantMetrics: `
+# HELP delivered_requests_count number of requests delivered to the monitor
+# TYPE delivered_requests_count counter
+delivered_requests_count{host="b.example.com",type="add"} 1
+delivered_requests_count{host="c.example.com",type="add"} 1
+# HELP failed_requests_count number of requests that could not be delivered to the monitor
+# TYPE failed_requests_count counter
+failed_requests_count{host="a.example.com",type="add"} 1
+# HELP retried_requests_count number of retried requests to the monitor
+# TYPE retried_requests_count counter
+retried_requests_count{host="a.example.com",type="add"} 2
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := flakyServer{server: server{hosts: make(map[string]bool)}, failures: tt.failures}
+			ts := httptest.NewServer(&h)
+			defer ts.Close()
+
+			m := NewMetrics("", "", nil)
+			s := sender{
+				configuration: DefaultConfiguration,
+				httpClient:    http.DefaultClient,
+				backoff:       backoffPolicy{InitialWait: time.Millisecond, MaxWait: 10 * time.Millisecond, Factor: 2, MaxAttempts: 3},
+				metrics:       m,
+				logger:        slog.Default(),
+			}
+			s.configuration.Monitor = ts.URL
+			s.configuration.ID = "cluster"
+
+			s.process(context.Background(), newIngressEvent(addEvent, &ingress))
+
+			for _, host := range tt.wantHosts {
+				up, ok := h.getHost(host)
+				assert.True(t, ok && up, host)
+			}
+			assert.Len(t, h.hosts, len(tt.wantHosts))
+			assert.NoError(t, testutil.CollectAndCompare(m, bytes.NewBufferString(tt.wantMetrics), "delivered_requests_count", "failed_requests_count", "retried_requests_count"))
+		})
+	}
+}
+
+// flakyServer rejects the first requests for a host, as configured in failures.
+type flakyServer struct {
+	server
+	failLock sync.Mutex
+	failures map[string]int
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	s.failLock.Lock()
+	fail := s.failures[target] > 0
+	if fail {
+		s.failures[target]--
+	}
+	s.failLock.Unlock()
+	if fail {
+		http.Error(w, "", http.StatusServiceUnavailable)
+		return
+	}
+	s.server.ServeHTTP(w, r)
+}
+
+func TestSender_reconcile(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		wantMetrics string
+	}{
+		{
+			name:   "success",
+			status: http.StatusOK,
+			wantMetrics: `
+# HELP reconciliations_count number of times the targets were reconciled with the monitor
+# TYPE reconciliations_count counter
+reconciliations_count{result="success"} 1
+`,
+		},
+		{
+			name:   "failed",
+			status: http.StatusBadRequest,
+			wantMetrics: `
+# HELP reconciliations_count number of times the targets were reconciled with the monitor
+# TYPE reconciliations_count counter
+reconciliations_count{result="failed"} 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var received handlers.ReconcileRequest
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || r.URL.Path != "/targets" || r.Header.Get("Authorization") != "Bearer 1234" {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if tt.status != http.StatusOK {
+					http.Error(w, "", tt.status)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(handlers.ReconcileResult{Added: len(received.Targets)})
+			}))
+			t.Cleanup(ts.Close)
+
+			m := NewMetrics("", "", nil)
+			s := sender{
+				configuration: DefaultConfiguration,
+				httpClient:    http.DefaultClient,
+				metrics:       m,
+				logger:        slog.Default(),
+			}
+			s.configuration.Monitor = ts.URL
+			s.configuration.Token = "1234"
+			s.configuration.ID = "cluster"
+
+			s.reconcile(context.Background(), []event{newIngressEvent(addEvent, &validIngress)})
+
+			assert.Equal(t, "cluster", received.Agent)
+			require.Len(t, received.Targets, 1)
+			request, err := handlers.DecodeRequest(received.Targets[0])
+			require.NoError(t, err)
+			assert.Equal(t, "example.com", request.Target)
+			assert.NoError(t, testutil.CollectAndCompare(m, bytes.NewBufferString(tt.wantMetrics), "reconciliations_count"))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	corev1 "k8s.io/api/core/v1"
+	"net"
+	"strconv"
+)
+
+// newServiceEvent creates an event for a Service of type LoadBalancer or NodePort. Each TCP port of the service
+// results in a TCP target: LoadBalancer services use the addresses in the service's load balancer status, while
+// NodePort services need the host annotation to determine the address of the targets. The host annotation also
+// overrides the load balancer's addresses. Other services have no targets.
+func newServiceEvent(t eventType, service *corev1.Service) event {
+	ev := event{
+		eventType: t,
+		kind:      serviceKind,
+		object:    service,
+		probeType: handlers.ProbeTCP,
+	}
+
+	var addresses []string
+	if host, ok := service.Annotations[hostAnnotation]; ok && host != "" {
+		addresses = []string{host}
+	} else if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			switch {
+			case ingress.IP != "":
+				addresses = append(addresses, ingress.IP)
+			case ingress.Hostname != "":
+				addresses = append(addresses, ingress.Hostname)
+			}
+		}
+	}
+
+	for _, port := range service.Spec.Ports {
+		if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+		var portNumber int32
+		switch service.Spec.Type {
+		case corev1.ServiceTypeLoadBalancer:
+			portNumber = port.Port
+		case corev1.ServiceTypeNodePort:
+			portNumber = port.NodePort
+		}
+		if portNumber == 0 {
+			continue
+		}
+		for _, address := range addresses {
+			ev.targets = append(ev.targets, net.JoinHostPort(address, strconv.Itoa(int(portNumber))))
+		}
+	}
+	return ev
+}
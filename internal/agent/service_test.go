@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+var validService = corev1.Service{
+	ObjectMeta: v1.ObjectMeta{
+		Name:        "mqtt",
+		Namespace:   "foo",
+		Annotations: map[string]string{monitorAnnotation: "true"},
+	},
+	Spec: corev1.ServiceSpec{
+		Type: corev1.ServiceTypeLoadBalancer,
+		Ports: []corev1.ServicePort{
+			{Name: "mqtt", Protocol: corev1.ProtocolTCP, Port: 1883, NodePort: 31883},
+			{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 53, NodePort: 30053},
+		},
+	},
+	Status: corev1.ServiceStatus{
+		LoadBalancer: corev1.LoadBalancerStatus{
+			Ingress: []corev1.LoadBalancerIngress{{IP: "192.168.0.10"}, {Hostname: "lb.example.com"}},
+		},
+	},
+}
+
+func TestNewServiceEvent(t *testing.T) {
+	tests := []struct {
+		name        string
+		service     func(*corev1.Service)
+		wantTargets []string
+	}{
+		{
+			name:        "load balancer",
+			wantTargets: []string{"192.168.0.10:1883", "lb.example.com:1883"},
+		},
+		{
+			name:    "load balancer without address",
+			service: func(s *corev1.Service) { s.Status.LoadBalancer.Ingress = nil },
+		},
+		{
+			name:        "host annotation",
+			service:     func(s *corev1.Service) { s.Annotations[hostAnnotation] = "mqtt.example.com" },
+			wantTargets: []string{"mqtt.example.com:1883"},
+		},
+		{
+			name:    "node port",
+			service: func(s *corev1.Service) { s.Spec.Type = corev1.ServiceTypeNodePort },
+		},
+		{
+			name: "node port with host annotation",
+			service: func(s *corev1.Service) {
+				s.Spec.Type = corev1.ServiceTypeNodePort
+				s.Annotations[hostAnnotation] = "192.168.0.1"
+			},
+			wantTargets: []string{"192.168.0.1:31883"},
+		},
+		{
+			name:    "cluster ip",
+			service: func(s *corev1.Service) { s.Spec.Type = corev1.ServiceTypeClusterIP },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := validService.DeepCopy()
+			if tt.service != nil {
+				tt.service(service)
+			}
+			ev := newServiceEvent(addEvent, service)
+			assert.Equal(t, serviceKind, ev.kind)
+			assert.Equal(t, handlers.ProbeTCP, ev.probeType)
+			assert.Equal(t, tt.wantTargets, ev.targetHosts())
+		})
+	}
+}
@@ -2,42 +2,78 @@ package agent
 
 import (
 	"github.com/clambin/go-common/set"
-	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/cache"
 	"log/slog"
+	"maps"
 	"strings"
 )
 
-type ingressWatcher struct {
-	out     chan<- event
-	metrics *Metrics
-	logger  *slog.Logger
+// watcher converts the notifications of an informer into events. newEvent creates the event for the informer's
+// resource type. selectors determine if an update adds or removes the resource from the monitored resources.
+type watcher struct {
+	out       chan<- event
+	newEvent  func(eventType, any) event
+	selectors Selectors
+	metrics   *Metrics
+	logger    *slog.Logger
 }
 
-func (w ingressWatcher) OnAdd(ingress any, _ bool) {
-	w.send(event{eventType: addEvent, ingress: ingress.(*netv1.Ingress)})
+func (w watcher) OnAdd(obj any, _ bool) {
+	w.send(w.newEvent(addEvent, obj))
 }
 
-func (w ingressWatcher) OnUpdate(oldIngress, newIngress any) {
-	oldEv := event{eventType: deleteEvent, ingress: oldIngress.(*netv1.Ingress)}
-	newEv := event{eventType: addEvent, ingress: newIngress.(*netv1.Ingress)}
+func (w watcher) OnUpdate(oldObj, newObj any) {
+	w.update(w.newEvent(deleteEvent, oldObj), w.newEvent(addEvent, newObj))
+}
 
+// update sends the events for a resource that changed from oldEv to newEv.
+func (w watcher) update(oldEv, newEv event) {
 	oldHostnames := set.New(oldEv.targetHosts()...)
 	newHostnames := set.New(newEv.targetHosts()...)
+	hostsChanged := strings.Join(oldHostnames.ListOrdered(), ",") != strings.Join(newHostnames.ListOrdered(), ",")
+	oldSelected, newSelected := w.selectors.selects(oldEv), w.selectors.selects(newEv)
 
-	if strings.Join(oldHostnames.ListOrdered(), ",") != strings.Join(newHostnames.ListOrdered(), ",") {
-		w.send(oldEv)
-		w.send(newEv)
+	switch {
+	case oldSelected && newSelected && !hostsChanged:
+		if !maps.Equal(uptimeAnnotations(oldEv), uptimeAnnotations(newEv)) {
+			// hosts haven't changed, so the monitor replaces the existing targets, unless the annotations changed
+			// their target (e.g. their path). The filter uses the previous event to delete the previous targets of
+			// hosts that are now skipped or whose target changed.
+			newEv.previous = &oldEv
+			w.send(newEv)
+		}
+	default:
+		// the resource was added to, or removed from, the selected resources, or its hosts changed
+		if oldSelected {
+			w.send(oldEv)
+		}
+		if newSelected {
+			w.send(newEv)
+		}
 	}
 }
 
-func (w ingressWatcher) OnDelete(ingress any) {
-	w.send(event{eventType: deleteEvent, ingress: ingress.(*netv1.Ingress)})
+func (w watcher) OnDelete(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	w.send(w.newEvent(deleteEvent, obj))
 }
 
-func (w ingressWatcher) send(ev event) {
-	w.logger.Debug("ingress change detected", "event", ev)
+func (w watcher) send(ev event) {
+	w.logger.Debug("resource change detected", "event", ev)
 	w.out <- ev
 	if w.metrics != nil {
 		w.metrics.ObserveEvent(ev)
 	}
 }
+
+func uptimeAnnotations(ev event) map[string]string {
+	annotations := make(map[string]string)
+	for key, value := range ev.annotations() {
+		if strings.HasPrefix(key, annotationPrefix) {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
@@ -4,15 +4,17 @@ import (
 	"github.com/stretchr/testify/assert"
 	netv1 "k8s.io/api/networking/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
 	"log/slog"
 	"testing"
 )
 
 func TestIngressWatcher(t *testing.T) {
 	ch := make(chan event)
-	w := ingressWatcher{
-		out:    ch,
-		logger: slog.Default(),
+	w := watcher{
+		out:      ch,
+		newEvent: func(t eventType, obj any) event { return newIngressEvent(t, obj.(*netv1.Ingress)) },
+		logger:   slog.Default(),
 	}
 
 	go w.OnAdd(&validIngress, true)
@@ -37,4 +39,105 @@ func TestIngressWatcher(t *testing.T) {
 	go w.OnUpdate(&validIngress, &ingress2)
 	assert.Equal(t, deleteEvent, (<-ch).eventType)
 	assert.Equal(t, addEvent, (<-ch).eventType)
+
+	ingress3 := ingress2.DeepCopy()
+	ingress3.Annotations[intervalAnnotation] = "1m"
+	go w.OnUpdate(&ingress2, ingress3)
+	ev = <-ch
+	assert.Equal(t, addEvent, ev.eventType)
+	assert.Equal(t, ingress3, ev.object)
+
+	go w.OnDelete(cache.DeletedFinalStateUnknown{Key: "foo/valid", Obj: ingress3})
+	ev = <-ch
+	assert.Equal(t, deleteEvent, ev.eventType)
+	assert.Equal(t, ingress3, ev.object)
+}
+
+func TestWatcher_OnUpdate(t *testing.T) {
+	withEntrypoint := func(entrypoint string) *netv1.Ingress {
+		ingress := validIngress.DeepCopy()
+		ingress.Annotations[traefikEndpointAnnotation] = entrypoint
+		return ingress
+	}
+	withLabels := func(labels map[string]string) *netv1.Ingress {
+		ingress := validIngress.DeepCopy()
+		ingress.Labels = labels
+		return ingress
+	}
+	labelSelectors := Selectors{Include: []Selector{{Labels: "visibility=public"}}}
+
+	tests := []struct {
+		name      string
+		selectors Selectors
+		old       *netv1.Ingress
+		new       *netv1.Ingress
+		want      []eventType
+	}{
+		{
+			name:      "entrypoint removed",
+			selectors: DefaultSelectors,
+			old:       withEntrypoint(traefikExternalEndpoint),
+			new:       withEntrypoint("web"),
+			want:      []eventType{deleteEvent},
+		},
+		{
+			name:      "entrypoint added",
+			selectors: DefaultSelectors,
+			old:       withEntrypoint("web"),
+			new:       withEntrypoint(traefikExternalEndpoint),
+			want:      []eventType{addEvent},
+		},
+		{
+			name:      "label added",
+			selectors: labelSelectors,
+			old:       withLabels(nil),
+			new:       withLabels(map[string]string{"visibility": "public"}),
+			want:      []eventType{addEvent},
+		},
+		{
+			name:      "label removed",
+			selectors: labelSelectors,
+			old:       withLabels(map[string]string{"visibility": "public"}),
+			new:       withLabels(map[string]string{"visibility": "internal"}),
+			want:      []eventType{deleteEvent},
+		},
+		{
+			name:      "unselected resource changed",
+			selectors: labelSelectors,
+			old:       withLabels(nil),
+			new:       withLabels(map[string]string{"visibility": "internal"}),
+		},
+		{
+			name:      "selected resource: other label changed",
+			selectors: labelSelectors,
+			old:       withLabels(map[string]string{"visibility": "public"}),
+			new:       withLabels(map[string]string{"visibility": "public", "app": "foo"}),
+		},
+		{
+			name:      "resync",
+			selectors: DefaultSelectors,
+			old:       &validIngress,
+			new:       &validIngress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ch := make(chan event, 2)
+			w := watcher{
+				out:       ch,
+				newEvent:  func(t eventType, obj any) event { return newIngressEvent(t, obj.(*netv1.Ingress)) },
+				selectors: tt.selectors,
+				logger:    slog.Default(),
+			}
+			w.OnUpdate(tt.old, tt.new)
+			close(ch)
+			var got []eventType
+			for ev := range ch {
+				got = append(got, ev.eventType)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
 }
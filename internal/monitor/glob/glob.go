@@ -0,0 +1,28 @@
+package glob
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Compile converts a glob pattern to a regular expression. '*' matches any sequence of characters, including '/',
+// and '?' matches a single character. An empty pattern matches everything.
+func Compile(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		pattern = "*"
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
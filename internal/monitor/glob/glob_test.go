@@ -0,0 +1,30 @@
+package glob
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		pattern string
+		target  string
+		want    bool
+	}{
+		{pattern: "", target: "https://example.com", want: true},
+		{pattern: "*", target: "https://example.com/health", want: true},
+		{pattern: "https://example.com", target: "https://example.com", want: true},
+		{pattern: "https://example.com", target: "https://example.com/health"},
+		{pattern: "https://*.example.com/*", target: "https://api.example.com/v1/health", want: true},
+		{pattern: "https://*.example.com/*", target: "https://example.com/"},
+		{pattern: "example.com:?443", target: "example.com:8443", want: true},
+		{pattern: "example.com:?443", target: "example.com:443"},
+		{pattern: "(a+)", target: "aa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.target, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, Compile(tt.pattern).MatchString(tt.target))
+		})
+	}
+}
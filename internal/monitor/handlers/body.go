@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+var _ slog.LogValuer = BodyAssertions{}
+
+// BodyAssertions are checked against the body of an HTTP response. Contains must be a substring of the body and
+// Regex must match the body. JSONPath selects a value from a JSON body (e.g. "status" or "checks.0.status"); if
+// JSONValue is set, the selected value must be equal to it. MaxSize limits the size of the body.
+type BodyAssertions struct {
+	Contains  string `json:"contains,omitempty"`
+	Regex     string `json:"regex,omitempty"`
+	JSONPath  string `json:"json_path,omitempty"`
+	JSONValue string `json:"json_value,omitempty"`
+	MaxSize   int64  `json:"max_size,omitempty"`
+}
+
+func (b BodyAssertions) IsZero() bool {
+	return b == BodyAssertions{}
+}
+
+func (b BodyAssertions) encode(values url.Values) {
+	if b.Contains != "" {
+		values.Set("body_contains", b.Contains)
+	}
+	if b.Regex != "" {
+		values.Set("body_regex", b.Regex)
+	}
+	if b.JSONPath != "" {
+		values.Set("json_path", b.JSONPath)
+	}
+	if b.JSONValue != "" {
+		values.Set("json_value", b.JSONValue)
+	}
+	if b.MaxSize > 0 {
+		values.Set("max_body_size", strconv.FormatInt(b.MaxSize, 10))
+	}
+}
+
+func parseBodyAssertions(values url.Values) (BodyAssertions, error) {
+	b := BodyAssertions{
+		Contains:  values.Get("body_contains"),
+		Regex:     values.Get("body_regex"),
+		JSONPath:  values.Get("json_path"),
+		JSONValue: values.Get("json_value"),
+	}
+	if b.Regex != "" {
+		if _, err := regexp.Compile(b.Regex); err != nil {
+			return BodyAssertions{}, fmt.Errorf("invalid body regex %s: %w", b.Regex, err)
+		}
+	}
+	if b.JSONValue != "" && b.JSONPath == "" {
+		return BodyAssertions{}, fmt.Errorf("json value %s requires a json path", b.JSONValue)
+	}
+	if maxSize := values.Get("max_body_size"); maxSize != "" {
+		var err error
+		if b.MaxSize, err = strconv.ParseInt(maxSize, 10, 64); err != nil || b.MaxSize <= 0 {
+			return BodyAssertions{}, fmt.Errorf("invalid max body size %s", maxSize)
+		}
+	}
+	return b, nil
+}
+
+func (b BodyAssertions) LogValue() slog.Value {
+	var attrs []slog.Attr
+	if b.Contains != "" {
+		attrs = append(attrs, slog.String("contains", b.Contains))
+	}
+	if b.Regex != "" {
+		attrs = append(attrs, slog.String("regex", b.Regex))
+	}
+	if b.JSONPath != "" {
+		attrs = append(attrs, slog.String("jsonPath", b.JSONPath), slog.String("jsonValue", b.JSONValue))
+	}
+	if b.MaxSize > 0 {
+		attrs = append(attrs, slog.Int64("maxSize", b.MaxSize))
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/clambin/uptime/pkg/logger"
+	"net/http"
+	"time"
+)
+
+// MaintenanceWindow is a period during which targets are in maintenance. Targets are still checked, but the checks do
+// not change the state of the target, do not count towards its uptime and do not send notifications.
+//
+// A window is either one-off, from Start to End, or recurring: it starts whenever Schedule, a cron expression
+// (minute, hour, day of month, month, day of week), matches and lasts for Duration. Schedule is evaluated in TimeZone,
+// or UTC if TimeZone is empty.
+type MaintenanceWindow struct {
+	ID string `json:"id" yaml:"id"`
+	// Target is a target, or a glob pattern matching targets (e.g. https://*.example.com/*). An empty target matches
+	// all targets.
+	Target   string        `json:"target,omitempty" yaml:"target,omitempty"`
+	Start    time.Time     `json:"start,omitempty" yaml:"start,omitempty"`
+	End      time.Time     `json:"end,omitempty" yaml:"end,omitempty"`
+	Schedule string        `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Duration time.Duration `json:"-" yaml:"duration,omitempty"`
+	TimeZone string        `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	Reason   string        `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// jsonMaintenanceWindow omits the start and end of recurring windows and encodes the duration as a duration string.
+type jsonMaintenanceWindow struct {
+	maintenanceWindow
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	Duration string     `json:"duration,omitempty"`
+}
+
+type maintenanceWindow MaintenanceWindow
+
+func (w MaintenanceWindow) MarshalJSON() ([]byte, error) {
+	window := jsonMaintenanceWindow{maintenanceWindow: maintenanceWindow(w)}
+	if !w.Start.IsZero() {
+		window.Start = &w.Start
+	}
+	if !w.End.IsZero() {
+		window.End = &w.End
+	}
+	if w.Duration > 0 {
+		window.Duration = w.Duration.String()
+	}
+	return json.Marshal(window)
+}
+
+func (w *MaintenanceWindow) UnmarshalJSON(b []byte) error {
+	var window jsonMaintenanceWindow
+	if err := json.Unmarshal(b, &window); err != nil {
+		return err
+	}
+	*w = MaintenanceWindow(window.maintenanceWindow)
+	if window.Start != nil {
+		w.Start = *window.Start
+	}
+	if window.End != nil {
+		w.End = *window.End
+	}
+	if window.Duration != "" {
+		var err error
+		if w.Duration, err = time.ParseDuration(window.Duration); err != nil {
+			return fmt.Errorf("duration: %w", err)
+		}
+	}
+	return nil
+}
+
+var _ http.Handler = &MaintenanceHandler{}
+
+// MaintenanceHandler lists, sets and deletes maintenance windows. PUT and DELETE take the ID of the window as the
+// id path value.
+type MaintenanceHandler struct {
+	MaintenanceManager
+}
+
+type MaintenanceManager interface {
+	Windows() []MaintenanceWindow
+	Set(window MaintenanceWindow) error
+	Delete(id string) bool
+}
+
+func (m MaintenanceHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	l := logger.Logger(req)
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(m.Windows()); err != nil {
+			l.Error("failed to encode response", "err", err)
+		}
+	case http.MethodPut:
+		var window MaintenanceWindow
+		err := json.NewDecoder(req.Body).Decode(&window)
+		if err == nil {
+			window.ID = req.PathValue("id")
+			err = m.Set(window)
+		}
+		if err != nil {
+			l.Error("invalid maintenance window", "err", err)
+			http.Error(w, "invalid maintenance window: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		l.Info("maintenance window set", "window", window.ID)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		id := req.PathValue("id")
+		if !m.Delete(id) {
+			http.Error(w, "maintenance window not found: "+id, http.StatusNotFound)
+			return
+		}
+		l.Info("maintenance window deleted", "window", id)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "invalid method: "+req.Method, http.StatusMethodNotAllowed)
+	}
+}
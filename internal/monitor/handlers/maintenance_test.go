@@ -0,0 +1,132 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		id       string
+		body     string
+		wantCode int
+		wantBody string
+		want     []handlers.MaintenanceWindow
+	}{
+		{
+			name:     "list",
+			method:   http.MethodGet,
+			wantCode: http.StatusOK,
+			wantBody: `[{"id":"backups","schedule":"0 2 * * sun","reason":"backups","duration":"2h0m0s"}]` + "\n",
+		},
+		{
+			name:     "set",
+			method:   http.MethodPut,
+			id:       "upgrade",
+			body:     `{"target":"https://*.example.com/*","start":"2024-03-06T08:00:00Z","end":"2024-03-06T10:00:00Z"}`,
+			wantCode: http.StatusOK,
+			want: []handlers.MaintenanceWindow{
+				{ID: "backups", Schedule: "0 2 * * sun", Duration: 2 * time.Hour, Reason: "backups"},
+				{ID: "upgrade", Target: "https://*.example.com/*", Start: time.Date(2024, time.March, 6, 8, 0, 0, 0, time.UTC), End: time.Date(2024, time.March, 6, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:     "set invalid",
+			method:   http.MethodPut,
+			id:       "upgrade",
+			body:     `{"schedule":"@daily"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "set invalid duration",
+			method:   http.MethodPut,
+			id:       "upgrade",
+			body:     `{"schedule":"@daily","duration":"forever"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "delete",
+			method:   http.MethodDelete,
+			id:       "backups",
+			wantCode: http.StatusOK,
+			want:     []handlers.MaintenanceWindow{},
+		},
+		{
+			name:     "delete unknown",
+			method:   http.MethodDelete,
+			id:       "upgrade",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := maintenanceManager{windows: []handlers.MaintenanceWindow{{ID: "backups", Schedule: "0 2 * * sun", Duration: 2 * time.Hour, Reason: "backups"}}}
+			req, _ := http.NewRequest(tt.method, "/maintenance/"+tt.id, bytes.NewBufferString(tt.body))
+			req.SetPathValue("id", tt.id)
+			w := httptest.NewRecorder()
+			handlers.MaintenanceHandler{MaintenanceManager: &m}.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			if tt.want != nil {
+				assert.Equal(t, tt.want, m.windows)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindow_JSON(t *testing.T) {
+	window := handlers.MaintenanceWindow{
+		ID:       "upgrade",
+		Target:   "example.com",
+		Start:    time.Date(2024, time.March, 6, 8, 0, 0, 0, time.UTC),
+		End:      time.Date(2024, time.March, 6, 10, 0, 0, 0, time.UTC),
+		Duration: time.Hour,
+	}
+	body, err := json.Marshal(window)
+	require.NoError(t, err)
+	var got handlers.MaintenanceWindow
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, window, got)
+}
+
+var _ handlers.MaintenanceManager = &maintenanceManager{}
+
+type maintenanceManager struct {
+	windows []handlers.MaintenanceWindow
+}
+
+func (m *maintenanceManager) Windows() []handlers.MaintenanceWindow {
+	return m.windows
+}
+
+func (m *maintenanceManager) Set(window handlers.MaintenanceWindow) error {
+	if window.Schedule != "" && window.Duration == 0 {
+		return errors.New("missing duration")
+	}
+	m.windows = append(m.windows, window)
+	return nil
+}
+
+func (m *maintenanceManager) Delete(id string) bool {
+	for i := range m.windows {
+		if m.windows[i].ID == id {
+			m.windows = append(m.windows[:i], m.windows[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/clambin/uptime/pkg/logger"
+	"log/slog"
+	"net/http"
+)
+
+var _ http.Handler = &ReconcileHandler{}
+
+// ReconcileHandler replaces the targets of an agent with the set of targets in the request.
+type ReconcileHandler struct {
+	TargetReconciler
+}
+
+type TargetReconciler interface {
+	Reconcile(agent string, requests []Request, logger *slog.Logger) ReconcileResult
+}
+
+// ReconcileRequest holds the full set of targets of an agent. Each target is a request encoded by Request.Encode.
+type ReconcileRequest struct {
+	Agent   string   `json:"agent"`
+	Targets []string `json:"targets"`
+}
+
+func NewReconcileRequest(agent string, requests []Request) ReconcileRequest {
+	r := ReconcileRequest{Agent: agent, Targets: make([]string, len(requests))}
+	for i := range requests {
+		r.Targets[i] = requests[i].Encode()
+	}
+	return r
+}
+
+func (r ReconcileRequest) requests() ([]Request, error) {
+	if r.Agent == "" {
+		return nil, errors.New("missing mandatory agent")
+	}
+	requests := make([]Request, len(r.Targets))
+	for i := range r.Targets {
+		var err error
+		if requests[i], err = DecodeRequest(r.Targets[i]); err != nil {
+			return nil, fmt.Errorf("target %d: %w", i, err)
+		}
+	}
+	return requests, nil
+}
+
+// ReconcileResult reports the changes made by a reconciliation.
+type ReconcileResult struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+}
+
+func (t ReconcileHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	l := logger.Logger(req)
+	var reconcileRequest ReconcileRequest
+	err := json.NewDecoder(req.Body).Decode(&reconcileRequest)
+	var requests []Request
+	if err == nil {
+		requests, err = reconcileRequest.requests()
+	}
+	if err != nil {
+		l.Error("invalid request", "err", err)
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := t.Reconcile(reconcileRequest.Agent, requests, l)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
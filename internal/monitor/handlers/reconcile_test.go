@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReconcileHandler(t *testing.T) {
+	request := handlers.Request{Target: "https://example.com", Type: handlers.ProbeHTTP, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Minute}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "valid",
+			body:     mustMarshal(t, handlers.NewReconcileRequest("cluster", []handlers.Request{request})),
+			wantCode: http.StatusOK,
+			wantBody: `{"added":1,"updated":0,"removed":0}` + "\n",
+		},
+		{
+			name:     "empty",
+			body:     mustMarshal(t, handlers.NewReconcileRequest("cluster", nil)),
+			wantCode: http.StatusOK,
+			wantBody: `{"added":0,"updated":0,"removed":0}` + "\n",
+		},
+		{
+			name:     "invalid json",
+			body:     `{`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "missing agent",
+			body:     mustMarshal(t, handlers.NewReconcileRequest("", []handlers.Request{request})),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid target",
+			body:     `{"agent":"cluster","targets":["method=GET"]}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var r reconciler
+			req, _ := http.NewRequest(http.MethodPut, "/targets", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			handlers.ReconcileHandler{TargetReconciler: &r}.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+				assert.Equal(t, "cluster", r.agent)
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+var _ handlers.TargetReconciler = &reconciler{}
+
+type reconciler struct {
+	agent string
+}
+
+func (r *reconciler) Reconcile(agent string, requests []handlers.Request, _ *slog.Logger) handlers.ReconcileResult {
+	r.agent = agent
+	return handlers.ReconcileResult{Added: len(requests)}
+}
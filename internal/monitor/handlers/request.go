@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/clambin/go-common/set"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -14,23 +17,75 @@ import (
 
 var _ slog.LogValuer = Request{}
 
+// Probe types supported by the monitor.
+const (
+	ProbeHTTP = "http"
+	ProbeTCP  = "tcp"
+	ProbeDNS  = "dns"
+)
+
+// Metadata keys set by the agent for every target.
+const (
+	MetadataKind      = "kind"
+	MetadataNamespace = "namespace"
+	MetadataName      = "name"
+)
+
 type Request struct {
 	Target     string
+	Type       string
 	Method     string
 	ValidCodes set.Set[int]
 	Interval   time.Duration
+	Send       string
+	Expect     string
+	Resolver   string
+	RecordType string
+	Records    []string
+	Body       BodyAssertions
+	Headers    http.Header
+	Payload    string
+	Host       string
+	UserAgent  string
+	// FailureThreshold is the number of consecutive failed checks before the target is considered down.
+	// SuccessThreshold is the number of consecutive successful checks before it is considered up again.
+	// Zero means a single check.
+	FailureThreshold int
+	SuccessThreshold int
+	// SLO is the target uptime ratio of the target, e.g. 0.999. Zero means the monitor's default.
+	SLO float64
+	// Metadata describes the kubernetes resource that exposes the target. It does not change how the target is
+	// checked, so Equals ignores it.
+	Metadata map[string]string
 }
 
 func (r Request) Equals(other Request) bool {
 	return r.Target == other.Target &&
+		r.Type == other.Type &&
 		r.Method == other.Method &&
 		r.ValidCodes.Equals(other.ValidCodes) &&
-		r.Interval == other.Interval
+		r.Interval == other.Interval &&
+		r.Send == other.Send &&
+		r.Expect == other.Expect &&
+		r.Resolver == other.Resolver &&
+		r.RecordType == other.RecordType &&
+		slices.Equal(r.Records, other.Records) &&
+		r.Body == other.Body &&
+		maps.EqualFunc(r.Headers, other.Headers, slices.Equal[[]string]) &&
+		r.Payload == other.Payload &&
+		r.Host == other.Host &&
+		r.UserAgent == other.UserAgent &&
+		r.FailureThreshold == other.FailureThreshold &&
+		r.SuccessThreshold == other.SuccessThreshold &&
+		r.SLO == other.SLO
 }
 
 func (r Request) Encode() string {
 	values := make(url.Values)
 	values.Set("target", r.Target)
+	if r.Type != "" {
+		values.Set("type", r.Type)
+	}
 	if r.Method != "" {
 		values.Set("method", r.Method)
 	}
@@ -44,32 +99,185 @@ func (r Request) Encode() string {
 	if r.Interval.Nanoseconds() > 0 {
 		values.Set("interval", r.Interval.String())
 	}
+	if r.Send != "" {
+		values.Set("send", r.Send)
+	}
+	if r.Expect != "" {
+		values.Set("expect", r.Expect)
+	}
+	if r.Resolver != "" {
+		values.Set("resolver", r.Resolver)
+	}
+	if r.RecordType != "" {
+		values.Set("record", r.RecordType)
+	}
+	for _, record := range r.Records {
+		values.Add("records", record)
+	}
+	r.Body.encode(values)
+	for _, name := range headerNames(r.Headers) {
+		for _, value := range r.Headers[name] {
+			values.Add("header", name+": "+value)
+		}
+	}
+	if r.Payload != "" {
+		values.Set("payload", r.Payload)
+	}
+	if r.Host != "" {
+		values.Set("host", r.Host)
+	}
+	if r.UserAgent != "" {
+		values.Set("user_agent", r.UserAgent)
+	}
+	if r.FailureThreshold > 0 {
+		values.Set("failures", strconv.Itoa(r.FailureThreshold))
+	}
+	if r.SuccessThreshold > 0 {
+		values.Set("successes", strconv.Itoa(r.SuccessThreshold))
+	}
+	if r.SLO > 0 {
+		values.Set("slo", strconv.FormatFloat(r.SLO, 'f', -1, 64))
+	}
+	for _, key := range metadataKeys(r.Metadata) {
+		values.Add("meta", key+"="+r.Metadata[key])
+	}
 	return values.Encode()
 }
 
 func (r Request) LogValue() slog.Value {
-	return slog.GroupValue(
+	attrs := []slog.Attr{
 		slog.String("target", r.Target),
+		slog.String("type", r.Type),
 		slog.String("method", r.Method),
 		slog.Any("codes", r.ValidCodes.ListOrdered()),
 		slog.Duration("interval", r.Interval),
-	)
+	}
+	if r.Send != "" {
+		attrs = append(attrs, slog.String("send", r.Send))
+	}
+	if r.Expect != "" {
+		attrs = append(attrs, slog.String("expect", r.Expect))
+	}
+	if r.Type == ProbeDNS {
+		attrs = append(attrs, slog.String("resolver", r.Resolver), slog.String("record", r.RecordType), slog.Any("records", r.Records))
+	}
+	if !r.Body.IsZero() {
+		attrs = append(attrs, slog.Any("body", r.Body))
+	}
+	if len(r.Headers) > 0 {
+		attrs = append(attrs, slog.Any("headers", headerNames(r.Headers)))
+	}
+	if r.Payload != "" {
+		attrs = append(attrs, slog.Int("payload", len(r.Payload)))
+	}
+	if r.Host != "" {
+		attrs = append(attrs, slog.String("host", r.Host))
+	}
+	if r.UserAgent != "" {
+		attrs = append(attrs, slog.String("userAgent", r.UserAgent))
+	}
+	if r.FailureThreshold > 1 || r.SuccessThreshold > 1 {
+		attrs = append(attrs, slog.Int("failures", r.FailureThreshold), slog.Int("successes", r.SuccessThreshold))
+	}
+	if r.SLO > 0 {
+		attrs = append(attrs, slog.Float64("slo", r.SLO))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// MarshalJSON encodes the request for the targets API. Header values are omitted, as they may hold credentials.
+func (r Request) MarshalJSON() ([]byte, error) {
+	type jsonRequest struct {
+		Target           string            `json:"target"`
+		Type             string            `json:"type"`
+		Method           string            `json:"method,omitempty"`
+		ValidCodes       []int             `json:"codes,omitempty"`
+		Interval         string            `json:"interval"`
+		Send             string            `json:"send,omitempty"`
+		Expect           string            `json:"expect,omitempty"`
+		Resolver         string            `json:"resolver,omitempty"`
+		RecordType       string            `json:"record,omitempty"`
+		Records          []string          `json:"records,omitempty"`
+		Body             *BodyAssertions   `json:"body,omitempty"`
+		Headers          []string          `json:"headers,omitempty"`
+		Host             string            `json:"host,omitempty"`
+		UserAgent        string            `json:"user_agent,omitempty"`
+		FailureThreshold int               `json:"failures,omitempty"`
+		SuccessThreshold int               `json:"successes,omitempty"`
+		SLO              float64           `json:"slo,omitempty"`
+		Metadata         map[string]string `json:"metadata,omitempty"`
+	}
+	request := jsonRequest{
+		Target:           r.Target,
+		Type:             r.Type,
+		Method:           r.Method,
+		ValidCodes:       r.ValidCodes.ListOrdered(),
+		Interval:         r.Interval.String(),
+		Send:             r.Send,
+		Expect:           r.Expect,
+		Resolver:         r.Resolver,
+		RecordType:       r.RecordType,
+		Records:          r.Records,
+		Host:             r.Host,
+		UserAgent:        r.UserAgent,
+		FailureThreshold: r.FailureThreshold,
+		SuccessThreshold: r.SuccessThreshold,
+		SLO:              r.SLO,
+		Metadata:         r.Metadata,
+	}
+	if !r.Body.IsZero() {
+		request.Body = &r.Body
+	}
+	if len(r.Headers) > 0 {
+		request.Headers = headerNames(r.Headers)
+	}
+	return json.Marshal(request)
 }
 
 func ParseRequest(r *http.Request) (Request, error) {
-	values, err := url.ParseQuery(r.URL.RawQuery)
+	return DecodeRequest(r.URL.RawQuery)
+}
+
+// DecodeRequest parses a request encoded by Request.Encode.
+func DecodeRequest(query string) (Request, error) {
+	values, err := url.ParseQuery(query)
 	if err != nil {
 		return Request{}, fmt.Errorf("parse query: %w", err)
 	}
 
 	request := Request{
 		Target:     values.Get("target"),
+		Type:       values.Get("type"),
 		Method:     values.Get("method"),
 		ValidCodes: set.New[int](),
+		Send:       values.Get("send"),
+		Expect:     values.Get("expect"),
+		Resolver:   values.Get("resolver"),
+		RecordType: strings.ToUpper(values.Get("record")),
+		Payload:    values.Get("payload"),
+		Host:       values.Get("host"),
+		UserAgent:  values.Get("user_agent"),
 	}
 	if request.Target == "" {
 		return Request{}, errors.New("missing mandatory target")
 	}
+	switch request.Type {
+	case "":
+		request.Type = ProbeHTTP
+	case ProbeHTTP, ProbeTCP, ProbeDNS:
+	default:
+		return Request{}, fmt.Errorf("invalid type %s", request.Type)
+	}
+	if request.Type == ProbeDNS {
+		switch request.RecordType {
+		case "":
+			request.RecordType = "A"
+		case "A", "AAAA", "CNAME", "MX", "TXT":
+		default:
+			return Request{}, fmt.Errorf("invalid record type %s", request.RecordType)
+		}
+		request.Records = values["records"]
+	}
 	if request.Method == "" {
 		request.Method = http.MethodGet
 	}
@@ -87,6 +295,26 @@ func ParseRequest(r *http.Request) (Request, error) {
 		request.ValidCodes.Add(http.StatusOK)
 	}
 
+	if request.Body, err = parseBodyAssertions(values); err != nil {
+		return Request{}, err
+	}
+	if request.Headers, err = parseHeaders(values["header"]); err != nil {
+		return Request{}, err
+	}
+	if request.Metadata, err = parseMetadata(values["meta"]); err != nil {
+		return Request{}, err
+	}
+
+	if request.FailureThreshold, err = parseThreshold(values.Get("failures")); err != nil {
+		return Request{}, fmt.Errorf("invalid failures: %w", err)
+	}
+	if request.SuccessThreshold, err = parseThreshold(values.Get("successes")); err != nil {
+		return Request{}, fmt.Errorf("invalid successes: %w", err)
+	}
+	if request.SLO, err = parseSLO(values.Get("slo")); err != nil {
+		return Request{}, fmt.Errorf("invalid slo: %w", err)
+	}
+
 	interval := values.Get("interval")
 	if interval == "" {
 		interval = "5m"
@@ -96,3 +324,75 @@ func ParseRequest(r *http.Request) (Request, error) {
 	}
 	return request, nil
 }
+
+func parseThreshold(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	threshold, err := strconv.Atoi(value)
+	if err == nil && threshold < 1 {
+		err = fmt.Errorf("%d is less than 1", threshold)
+	}
+	return threshold, err
+}
+
+func parseSLO(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	slo, err := strconv.ParseFloat(value, 64)
+	if err == nil && (slo <= 0 || slo >= 1) {
+		err = fmt.Errorf("%s is not between 0 and 1", value)
+	}
+	return slo, err
+}
+
+// parseHeaders parses a list of headers in "Name: value" format.
+func parseHeaders(headers []string) (http.Header, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	parsed := make(http.Header)
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %s", header)
+		}
+		parsed.Add(name, strings.TrimSpace(value))
+	}
+	return parsed, nil
+}
+
+// parseMetadata parses a list of metadata in "key=value" format.
+func parseMetadata(metadata []string) (map[string]string, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]string, len(metadata))
+	for _, entry := range metadata {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid metadata %s", entry)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+func metadataKeys(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func headerNames(headers http.Header) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/clambin/go-common/set"
 	"github.com/clambin/uptime/pkg/logtester"
 	"github.com/stretchr/testify/assert"
@@ -34,6 +35,7 @@ func Test_parseRequest(t *testing.T) {
 			wantErr:  assert.NoError,
 			wantReq: Request{
 				Target:     "http://localhost:8080/metrics",
+				Type:       ProbeHTTP,
 				Method:     http.MethodHead,
 				ValidCodes: set.New(http.StatusOK, http.StatusForbidden),
 				Interval:   1 * time.Minute,
@@ -50,11 +52,173 @@ func Test_parseRequest(t *testing.T) {
 			wantErr:  assert.NoError,
 			wantReq: Request{
 				Target:     "http://localhost:8080/metrics",
+				Type:       ProbeHTTP,
 				Method:     http.MethodGet,
 				ValidCodes: set.New(http.StatusOK),
 				Interval:   5 * time.Minute,
 			},
 		},
+		{
+			name:     "tcp",
+			rawQuery: `target=192.168.0.1:1883&type=tcp&send=PING%0D%0A&expect=%2BPONG`,
+			wantErr:  assert.NoError,
+			wantReq: Request{
+				Target:     "192.168.0.1:1883",
+				Type:       ProbeTCP,
+				Method:     http.MethodGet,
+				ValidCodes: set.New(http.StatusOK),
+				Interval:   5 * time.Minute,
+				Send:       "PING\r\n",
+				Expect:     "+PONG",
+			},
+		},
+		{
+			name:     "dns",
+			rawQuery: `target=example.com&type=dns&resolver=192.168.0.1:53&record=txt&records=v%3Dspf1+-all&records=foo,bar`,
+			wantErr:  assert.NoError,
+			wantReq: Request{
+				Target:     "example.com",
+				Type:       ProbeDNS,
+				Method:     http.MethodGet,
+				ValidCodes: set.New(http.StatusOK),
+				Interval:   5 * time.Minute,
+				Resolver:   "192.168.0.1:53",
+				RecordType: "TXT",
+				Records:    []string{"v=spf1 -all", "foo,bar"},
+			},
+		},
+		{
+			name:     "dns defaults",
+			rawQuery: `target=example.com&type=dns`,
+			wantErr:  assert.NoError,
+			wantReq: Request{
+				Target:     "example.com",
+				Type:       ProbeDNS,
+				Method:     http.MethodGet,
+				ValidCodes: set.New(http.StatusOK),
+				Interval:   5 * time.Minute,
+				RecordType: "A",
+			},
+		},
+		{
+			name:     "body assertions",
+			rawQuery: `target=localhost&body_contains=ok&body_regex=%5Eup&json_path=status&json_value=up&max_body_size=1024`,
+			wantErr:  assert.NoError,
+			wantReq: Request{
+				Target:     "localhost",
+				Type:       ProbeHTTP,
+				Method:     http.MethodGet,
+				ValidCodes: set.New(http.StatusOK),
+				Interval:   5 * time.Minute,
+				Body:       BodyAssertions{Contains: "ok", Regex: "^up", JSONPath: "status", JSONValue: "up", MaxSize: 1024},
+			},
+		},
+		{
+			name:     "custom request",
+			rawQuery: `target=localhost&method=POST&header=Accept%3A+application%2Fjson&header=x-token%3Afoo&payload=%7B%7D&host=www.example.com&user_agent=uptime`,
+			wantErr:  assert.NoError,
+			wantReq: Request{
+				Target:     "localhost",
+				Type:       ProbeHTTP,
+				Method:     http.MethodPost,
+				ValidCodes: set.New(http.StatusOK),
+				Interval:   5 * time.Minute,
+				Headers:    http.Header{"Accept": []string{"application/json"}, "X-Token": []string{"foo"}},
+				Payload:    "{}",
+				Host:       "www.example.com",
+				UserAgent:  "uptime",
+			},
+		},
+		{
+			name:     "thresholds",
+			rawQuery: `target=localhost&failures=3&successes=2`,
+			wantErr:  assert.NoError,
+			wantReq: Request{
+				Target:           "localhost",
+				Type:             ProbeHTTP,
+				Method:           http.MethodGet,
+				ValidCodes:       set.New(http.StatusOK),
+				Interval:         5 * time.Minute,
+				FailureThreshold: 3,
+				SuccessThreshold: 2,
+			},
+		},
+		{
+			name:     "metadata",
+			rawQuery: `target=localhost&meta=namespace%3Dfoo&meta=team%3Dinfra%3Dcore`,
+			wantErr:  assert.NoError,
+			wantReq: Request{
+				Target:     "localhost",
+				Type:       ProbeHTTP,
+				Method:     http.MethodGet,
+				ValidCodes: set.New(http.StatusOK),
+				Interval:   5 * time.Minute,
+				Metadata:   map[string]string{"namespace": "foo", "team": "infra=core"},
+			},
+		},
+		{
+			name:     "invalid metadata",
+			rawQuery: `target=localhost&meta=foo`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "slo",
+			rawQuery: `target=localhost&slo=0.995`,
+			wantErr:  assert.NoError,
+			wantReq: Request{
+				Target:     "localhost",
+				Type:       ProbeHTTP,
+				Method:     http.MethodGet,
+				ValidCodes: set.New(http.StatusOK),
+				Interval:   5 * time.Minute,
+				SLO:        0.995,
+			},
+		},
+		{
+			name:     "invalid slo",
+			rawQuery: `target=localhost&slo=1`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "invalid failures",
+			rawQuery: `target=localhost&failures=0`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "invalid successes",
+			rawQuery: `target=localhost&successes=many`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "invalid header",
+			rawQuery: `target=localhost&header=foo`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "invalid body regex",
+			rawQuery: `target=localhost&body_regex=%5B`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "json value without path",
+			rawQuery: `target=localhost&json_value=up`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "invalid max body size",
+			rawQuery: `target=localhost&max_body_size=0`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "invalid record type",
+			rawQuery: `target=example.com&type=dns&record=SRV`,
+			wantErr:  assert.Error,
+		},
+		{
+			name:     "invalid type",
+			rawQuery: `target=192.168.0.1:1883&type=udp`,
+			wantErr:  assert.Error,
+		},
 		{
 			name:     "invalid code",
 			rawQuery: `target=http://localhost:8080/metrics&method=HEAD&codes=20a,403&interval=1m`,
@@ -86,10 +250,25 @@ func Test_parseRequest(t *testing.T) {
 
 func TestRequest_Encode(t *testing.T) {
 	type fields struct {
-		Target    string
-		Method    string
-		ValidCode []int
-		Interval  time.Duration
+		Target     string
+		Type       string
+		Method     string
+		ValidCode  []int
+		Interval   time.Duration
+		Send       string
+		Expect     string
+		Resolver   string
+		RecordType string
+		Records    []string
+		Body       BodyAssertions
+		Headers    http.Header
+		Payload    string
+		Host       string
+		UserAgent  string
+		Failures   int
+		Successes  int
+		SLO        float64
+		Metadata   map[string]string
 	}
 	tests := []struct {
 		name   string
@@ -100,11 +279,77 @@ func TestRequest_Encode(t *testing.T) {
 			name: "full",
 			fields: fields{
 				Target:    "localhost:8080",
+				Type:      ProbeHTTP,
 				Method:    http.MethodGet,
 				ValidCode: []int{http.StatusOK, http.StatusForbidden},
 				Interval:  time.Minute,
 			},
-			want: `codes=200%2C403&interval=1m0s&method=GET&target=localhost%3A8080`,
+			want: `codes=200%2C403&interval=1m0s&method=GET&target=localhost%3A8080&type=http`,
+		},
+		{
+			name: "tcp",
+			fields: fields{
+				Target: "localhost:6379",
+				Type:   ProbeTCP,
+				Send:   "PING\r\n",
+				Expect: "+PONG",
+			},
+			want: `expect=%2BPONG&send=PING%0D%0A&target=localhost%3A6379&type=tcp`,
+		},
+		{
+			name: "dns",
+			fields: fields{
+				Target:     "example.com",
+				Type:       ProbeDNS,
+				Resolver:   "127.0.0.1:53",
+				RecordType: "A",
+				Records:    []string{"10.0.0.1", "10.0.0.2"},
+			},
+			want: `record=A&records=10.0.0.1&records=10.0.0.2&resolver=127.0.0.1%3A53&target=example.com&type=dns`,
+		},
+		{
+			name: "body",
+			fields: fields{
+				Target: "localhost:8080",
+				Body:   BodyAssertions{Contains: "ok", JSONPath: "$.status", JSONValue: "up", MaxSize: 512},
+			},
+			want: `body_contains=ok&json_path=%24.status&json_value=up&max_body_size=512&target=localhost%3A8080`,
+		},
+		{
+			name: "custom request",
+			fields: fields{
+				Target:    "localhost:8080",
+				Headers:   http.Header{"X-Token": []string{"foo"}, "Accept": []string{"application/json", "text/plain"}},
+				Payload:   "{}",
+				Host:      "www.example.com",
+				UserAgent: "uptime",
+			},
+			want: `header=Accept%3A+application%2Fjson&header=Accept%3A+text%2Fplain&header=X-Token%3A+foo&host=www.example.com&payload=%7B%7D&target=localhost%3A8080&user_agent=uptime`,
+		},
+		{
+			name: "thresholds",
+			fields: fields{
+				Target:    "localhost:8080",
+				Failures:  3,
+				Successes: 2,
+			},
+			want: `failures=3&successes=2&target=localhost%3A8080`,
+		},
+		{
+			name: "metadata",
+			fields: fields{
+				Target:   "localhost:8080",
+				Metadata: map[string]string{"team": "infra", "namespace": "foo"},
+			},
+			want: `meta=namespace%3Dfoo&meta=team%3Dinfra&target=localhost%3A8080`,
+		},
+		{
+			name: "slo",
+			fields: fields{
+				Target: "localhost:8080",
+				SLO:    0.999,
+			},
+			want: `slo=0.999&target=localhost%3A8080`,
 		},
 		{
 			name: "target only",
@@ -117,10 +362,25 @@ func TestRequest_Encode(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := Request{
-				Target:     tt.fields.Target,
-				Method:     tt.fields.Method,
-				ValidCodes: set.New(tt.fields.ValidCode...),
-				Interval:   tt.fields.Interval,
+				Target:           tt.fields.Target,
+				Type:             tt.fields.Type,
+				Method:           tt.fields.Method,
+				ValidCodes:       set.New(tt.fields.ValidCode...),
+				Interval:         tt.fields.Interval,
+				Send:             tt.fields.Send,
+				Expect:           tt.fields.Expect,
+				Resolver:         tt.fields.Resolver,
+				RecordType:       tt.fields.RecordType,
+				Records:          tt.fields.Records,
+				Body:             tt.fields.Body,
+				Headers:          tt.fields.Headers,
+				Payload:          tt.fields.Payload,
+				Host:             tt.fields.Host,
+				UserAgent:        tt.fields.UserAgent,
+				FailureThreshold: tt.fields.Failures,
+				SuccessThreshold: tt.fields.Successes,
+				SLO:              tt.fields.SLO,
+				Metadata:         tt.fields.Metadata,
 			}
 			assert.Equal(t, tt.want, r.Encode())
 		})
@@ -133,16 +393,34 @@ func TestRequest_LogValue(t *testing.T) {
 
 	req := Request{
 		Target:     "http://localhost",
+		Type:       ProbeHTTP,
 		Method:     http.MethodHead,
 		ValidCodes: set.New(http.StatusOK),
 		Interval:   time.Minute,
 	}
 	l.Info("request", "req", req)
 
-	assert.Equal(t, `level=INFO msg=request req.target=http://localhost req.method=HEAD req.codes=[200] req.interval=1m0s
+	assert.Equal(t, `level=INFO msg=request req.target=http://localhost req.type=http req.method=HEAD req.codes=[200] req.interval=1m0s
 `, output.String())
 }
 
+func TestRequest_MarshalJSON(t *testing.T) {
+	req := Request{
+		Target:           "https://example.com",
+		Type:             ProbeHTTP,
+		Method:           http.MethodPost,
+		ValidCodes:       set.New(http.StatusOK, http.StatusUnauthorized),
+		Interval:         time.Minute,
+		Body:             BodyAssertions{Contains: "ok"},
+		Headers:          http.Header{"Authorization": []string{"Bearer secret"}},
+		Payload:          "{}",
+		FailureThreshold: 3,
+	}
+	body, err := json.Marshal(req)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"target":"https://example.com","type":"http","method":"POST","codes":[200,401],"interval":"1m0s","body":{"contains":"ok"},"headers":["Authorization"],"failures":3}`, string(body))
+}
+
 func TestRequest_Equals(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -162,6 +440,24 @@ func TestRequest_Equals(t *testing.T) {
 			right:  Request{Target: "http://localhost", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour},
 			wantOK: assert.False,
 		},
+		{
+			name:   "different type",
+			left:   Request{Target: "localhost:8080", Type: ProbeHTTP, ValidCodes: set.New(http.StatusOK), Interval: time.Hour},
+			right:  Request{Target: "localhost:8080", Type: ProbeTCP, ValidCodes: set.New(http.StatusOK), Interval: time.Hour},
+			wantOK: assert.False,
+		},
+		{
+			name:   "different expect",
+			left:   Request{Target: "localhost:6379", Type: ProbeTCP, Send: "PING", Expect: "PONG"},
+			right:  Request{Target: "localhost:6379", Type: ProbeTCP, Send: "PING", Expect: "+PONG"},
+			wantOK: assert.False,
+		},
+		{
+			name:   "different records",
+			left:   Request{Target: "example.com", Type: ProbeDNS, RecordType: "A", Records: []string{"10.0.0.1"}},
+			right:  Request{Target: "example.com", Type: ProbeDNS, RecordType: "A", Records: []string{"10.0.0.2"}},
+			wantOK: assert.False,
+		},
 		{
 			name:   "different method",
 			left:   Request{Target: "http://localhost:8080", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour},
@@ -180,6 +476,42 @@ func TestRequest_Equals(t *testing.T) {
 			right:  Request{Target: "http://localhost:8080", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Minute},
 			wantOK: assert.False,
 		},
+		{
+			name:   "different thresholds",
+			left:   Request{Target: "http://localhost:8080", FailureThreshold: 3},
+			right:  Request{Target: "http://localhost:8080", FailureThreshold: 2},
+			wantOK: assert.False,
+		},
+		{
+			name:   "different slo",
+			left:   Request{Target: "http://10.0.0.1", SLO: 0.99},
+			right:  Request{Target: "http://10.0.0.1", SLO: 0.999},
+			wantOK: assert.False,
+		},
+		{
+			name:   "equal headers",
+			left:   Request{Target: "http://localhost:8080", Headers: http.Header{"Accept": []string{"application/json"}}},
+			right:  Request{Target: "http://localhost:8080", Headers: http.Header{"Accept": []string{"application/json"}}},
+			wantOK: assert.True,
+		},
+		{
+			name:   "different headers",
+			left:   Request{Target: "http://localhost:8080", Headers: http.Header{"Accept": []string{"application/json"}}},
+			right:  Request{Target: "http://localhost:8080", Headers: http.Header{"Accept": []string{"text/plain"}}},
+			wantOK: assert.False,
+		},
+		{
+			name:   "different host",
+			left:   Request{Target: "http://10.0.0.1", Host: "www.example.com"},
+			right:  Request{Target: "http://10.0.0.1", Host: "api.example.com"},
+			wantOK: assert.False,
+		},
+		{
+			name:   "different metadata",
+			left:   Request{Target: "http://10.0.0.1", Metadata: map[string]string{"team": "a"}},
+			right:  Request{Target: "http://10.0.0.1", Metadata: map[string]string{"team": "b"}},
+			wantOK: assert.True,
+		},
 	}
 
 	for _, tt := range tests {
@@ -12,9 +12,11 @@ type TargetHandler struct {
 	TargetManager
 }
 
+// TargetManager adds and removes targets on behalf of an agent. A target is only removed once all agents that
+// added it have removed it.
 type TargetManager interface {
-	Add(Request, *slog.Logger)
-	Remove(Request, *slog.Logger)
+	Add(agent string, request Request, logger *slog.Logger)
+	Remove(agent string, request Request, logger *slog.Logger)
 }
 
 func (t TargetHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -26,11 +28,12 @@ func (t TargetHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	agent := req.URL.Query().Get("agent")
 	switch req.Method {
 	case http.MethodPost:
-		t.Add(r, l)
+		t.Add(agent, r, l)
 	case http.MethodDelete:
-		t.Remove(r, l)
+		t.Remove(agent, r, l)
 	default:
 		http.Error(w, "invalid method: "+req.Method, http.StatusMethodNotAllowed)
 		return
@@ -11,7 +11,7 @@ import (
 )
 
 func TestTargetHandler(t *testing.T) {
-	m := mgr{target: make(map[string]struct{})}
+	m := mgr{target: make(map[string]string)}
 	h := handlers.TargetHandler{
 		TargetManager: &m,
 	}
@@ -21,17 +21,20 @@ func TestTargetHandler(t *testing.T) {
 	h.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
 
-	req, _ = http.NewRequest(http.MethodPost, "/?target=localhost:8080", nil)
+	req, _ = http.NewRequest(http.MethodPost, "/?target=localhost:8080&agent=cluster", nil)
 	w = httptest.NewRecorder()
 	h.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.True(t, m.has("localhost:8080"))
+	agent, ok := m.get("localhost:8080")
+	assert.True(t, ok)
+	assert.Equal(t, "cluster", agent)
 
-	req, _ = http.NewRequest(http.MethodDelete, "/?target=localhost:8080", nil)
+	req, _ = http.NewRequest(http.MethodDelete, "/?target=localhost:8080&agent=cluster", nil)
 	w = httptest.NewRecorder()
 	h.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.False(t, m.has("localhost:8080"))
+	_, ok = m.get("localhost:8080")
+	assert.False(t, ok)
 
 	req, _ = http.NewRequest(http.MethodDelete, "/", nil)
 	w = httptest.NewRecorder()
@@ -42,25 +45,27 @@ func TestTargetHandler(t *testing.T) {
 var _ handlers.TargetManager = &mgr{}
 
 type mgr struct {
-	target map[string]struct{}
+	target map[string]string
 	lock   sync.Mutex
 }
 
-func (m *mgr) Add(request handlers.Request, _ *slog.Logger) {
+func (m *mgr) Add(agent string, request handlers.Request, _ *slog.Logger) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	m.target[request.Target] = struct{}{}
+	m.target[request.Target] = agent
 }
 
-func (m *mgr) Remove(request handlers.Request, _ *slog.Logger) {
+func (m *mgr) Remove(agent string, request handlers.Request, _ *slog.Logger) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	delete(m.target, request.Target)
+	if m.target[request.Target] == agent {
+		delete(m.target, request.Target)
+	}
 }
 
-func (m *mgr) has(target string) bool {
+func (m *mgr) get(target string) (string, bool) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	_, ok := m.target[target]
-	return ok
+	agent, ok := m.target[target]
+	return agent, ok
 }
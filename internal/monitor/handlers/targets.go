@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/clambin/uptime/pkg/logger"
+	"net/http"
+	"time"
+)
+
+var _ http.Handler = &TargetsHandler{}
+
+// TargetsHandler reports the registered targets and their status. Without a host path value, it lists all targets.
+type TargetsHandler struct {
+	TargetLister
+}
+
+type TargetLister interface {
+	Targets() []TargetStatus
+	Target(string) (TargetStatus, bool)
+}
+
+// TargetStatus is the status of a registered target.
+type TargetStatus struct {
+	Request             Request      `json:"request"`
+	Owners              []string     `json:"owners,omitempty"`
+	Up                  *bool        `json:"up,omitempty"`
+	LastCheck           *CheckResult `json:"last_check,omitempty"`
+	LastStateChange     *time.Time   `json:"last_state_change,omitempty"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	NextCheck           time.Time    `json:"next_check"`
+	SLO                 float64      `json:"slo,omitempty"`
+	Uptime              []Uptime     `json:"uptime,omitempty"`
+	Maintenance         bool         `json:"maintenance,omitempty"`
+}
+
+// Uptime summarizes the checks of a target over a rolling window (e.g. 24h). ErrorBudgetRemaining is the fraction
+// of the downtime allowed by the SLO that has not been used yet. It is negative if the SLO has been missed.
+type Uptime struct {
+	Window               string        `json:"window"`
+	Checks               int           `json:"checks"`
+	Ratio                float64       `json:"ratio"`
+	ErrorBudgetRemaining float64       `json:"error_budget_remaining"`
+	MeanLatency          time.Duration `json:"-"`
+}
+
+// MarshalJSON encodes the mean latency as a duration string, like CheckResult's latency.
+func (u Uptime) MarshalJSON() ([]byte, error) {
+	type uptime Uptime
+	return json.Marshal(struct {
+		uptime
+		MeanLatency string `json:"mean_latency"`
+	}{uptime: uptime(u), MeanLatency: u.MeanLatency.String()})
+}
+
+// CheckResult is the outcome of a single check. Maintenance is set if the check was made during a maintenance window.
+type CheckResult struct {
+	Time        time.Time `json:"time"`
+	Up          bool      `json:"up"`
+	Code        int       `json:"code,omitempty"`
+	Latency     string    `json:"latency"`
+	Reason      string    `json:"reason,omitempty"`
+	Maintenance bool      `json:"maintenance,omitempty"`
+}
+
+func (t TargetsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var response any
+	if host := req.PathValue("host"); host != "" {
+		status, ok := t.Target(host)
+		if !ok {
+			http.Error(w, "target not found: "+host, http.StatusNotFound)
+			return
+		}
+		response = status
+	} else {
+		response = t.Targets()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Logger(req).Error("failed to encode response", "err", err)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTargetsHandler(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	up := true
+	l := lister{targets: map[string]handlers.TargetStatus{
+		"https://example.com": {
+			Request:             handlers.Request{Target: "https://example.com", Type: handlers.ProbeHTTP, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Minute},
+			Up:                  &up,
+			LastCheck:           &handlers.CheckResult{Time: now, Up: true, Code: http.StatusOK, Latency: "10ms"},
+			LastStateChange:     &now,
+			ConsecutiveFailures: 0,
+			NextCheck:           now.Add(time.Minute),
+			SLO:                 0.999,
+			Uptime:              []handlers.Uptime{{Window: "24h", Checks: 1440, Ratio: 1, ErrorBudgetRemaining: 1, MeanLatency: 10 * time.Millisecond}},
+		},
+	}}
+
+	h := http.NewServeMux()
+	h.Handle("GET /targets", handlers.TargetsHandler{TargetLister: l})
+	h.Handle("GET /targets/{host...}", handlers.TargetsHandler{TargetLister: l})
+
+	const status = `{"request":{"target":"https://example.com","type":"http","method":"GET","codes":[200],"interval":"1m0s"},"up":true,"last_check":{"time":"2024-03-01T12:00:00Z","up":true,"code":200,"latency":"10ms"},"last_state_change":"2024-03-01T12:00:00Z","consecutive_failures":0,"next_check":"2024-03-01T12:01:00Z","slo":0.999,"uptime":[{"window":"24h","checks":1440,"ratio":1,"error_budget_remaining":1,"mean_latency":"10ms"}]}`
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "list",
+			path:     "/targets",
+			wantCode: http.StatusOK,
+			wantBody: `[` + status + `]` + "\n",
+		},
+		{
+			name:     "target",
+			path:     "/targets/" + url.PathEscape("https://example.com"),
+			wantCode: http.StatusOK,
+			wantBody: status + "\n",
+		},
+		{
+			name:     "unknown target",
+			path:     "/targets/" + url.PathEscape("https://example.org"),
+			wantCode: http.StatusNotFound,
+			wantBody: "target not found: https://example.org\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+var _ handlers.TargetLister = lister{}
+
+type lister struct {
+	targets map[string]handlers.TargetStatus
+}
+
+func (l lister) Targets() []handlers.TargetStatus {
+	targets := make([]handlers.TargetStatus, 0, len(l.targets))
+	for _, target := range l.targets {
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+func (l lister) Target(host string) (handlers.TargetStatus, bool) {
+	target, ok := l.targets[host]
+	return target, ok
+}
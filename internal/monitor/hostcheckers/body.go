@@ -0,0 +1,88 @@
+package hostcheckers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxBodySize = 1 << 20
+
+// checkBody reads the body and evaluates the assertions. If an assertion fails, it returns the reason and an error
+// describing the failure.
+func checkBody(r io.Reader, assertions handlers.BodyAssertions) (string, error) {
+	maxSize := assertions.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return reasonBodyRead, err
+	}
+	if int64(len(body)) > maxSize {
+		return reasonBodyTooLarge, fmt.Errorf("body exceeds %d bytes", maxSize)
+	}
+	if assertions.Contains != "" && !bytes.Contains(body, []byte(assertions.Contains)) {
+		return reasonBodyContains, fmt.Errorf("body does not contain %q", assertions.Contains)
+	}
+	if assertions.Regex != "" {
+		// regex is validated when the request is parsed
+		re, err := regexp.Compile(assertions.Regex)
+		if err != nil || !re.Match(body) {
+			return reasonBodyRegex, fmt.Errorf("body does not match %q", assertions.Regex)
+		}
+	}
+	if assertions.JSONPath != "" {
+		if err = checkJSONPath(body, assertions.JSONPath, assertions.JSONValue); err != nil {
+			return reasonBodyJSONPath, err
+		}
+	}
+	return "", nil
+}
+
+// checkJSONPath checks that the path exists in the JSON document and, if value is not empty, that it holds value.
+// The path is a dot-separated list of object keys and array indices, optionally starting with "$.".
+func checkJSONPath(body []byte, path string, value string) error {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	for _, key := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		switch node := doc.(type) {
+		case map[string]any:
+			var ok bool
+			if doc, ok = node[key]; !ok {
+				return fmt.Errorf("json path %s: key %q not found", path, key)
+			}
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return fmt.Errorf("json path %s: invalid index %q", path, key)
+			}
+			doc = node[index]
+		default:
+			return fmt.Errorf("json path %s: %q not found", path, key)
+		}
+	}
+	if value == "" {
+		return nil
+	}
+	if got := jsonString(doc); got != value {
+		return errors.New("json path " + path + ": got " + got + ", want " + value)
+	}
+	return nil
+}
+
+func jsonString(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
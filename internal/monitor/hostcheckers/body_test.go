@@ -0,0 +1,117 @@
+package hostcheckers
+
+import (
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostChecker_probeHTTP_Body(t *testing.T) {
+	const body = `{"status":"up","checks":[{"name":"db","ok":true}],"version":1.5}`
+
+	tests := []struct {
+		name       string
+		assertions handlers.BodyAssertions
+		wantUp     assert.BoolAssertionFunc
+		wantReason string
+	}{
+		{
+			name:   "no assertions",
+			wantUp: assert.True,
+		},
+		{
+			name:       "contains",
+			assertions: handlers.BodyAssertions{Contains: `"status":"up"`},
+			wantUp:     assert.True,
+		},
+		{
+			name:       "does not contain",
+			assertions: handlers.BodyAssertions{Contains: `"status":"down"`},
+			wantUp:     assert.False,
+			wantReason: reasonBodyContains,
+		},
+		{
+			name:       "regex",
+			assertions: handlers.BodyAssertions{Regex: `"version":\d+\.\d+`},
+			wantUp:     assert.True,
+		},
+		{
+			name:       "regex mismatch",
+			assertions: handlers.BodyAssertions{Regex: `"version":"\d+"`},
+			wantUp:     assert.False,
+			wantReason: reasonBodyRegex,
+		},
+		{
+			name:       "json path",
+			assertions: handlers.BodyAssertions{JSONPath: "$.status", JSONValue: "up"},
+			wantUp:     assert.True,
+		},
+		{
+			name:       "json path into array",
+			assertions: handlers.BodyAssertions{JSONPath: "checks.0.ok", JSONValue: "true"},
+			wantUp:     assert.True,
+		},
+		{
+			name:       "json path number",
+			assertions: handlers.BodyAssertions{JSONPath: "version", JSONValue: "1.5"},
+			wantUp:     assert.True,
+		},
+		{
+			name:       "json path exists",
+			assertions: handlers.BodyAssertions{JSONPath: "checks.0.name"},
+			wantUp:     assert.True,
+		},
+		{
+			name:       "json path missing",
+			assertions: handlers.BodyAssertions{JSONPath: "checks.1.name"},
+			wantUp:     assert.False,
+			wantReason: reasonBodyJSONPath,
+		},
+		{
+			name:       "json value mismatch",
+			assertions: handlers.BodyAssertions{JSONPath: "status", JSONValue: "down"},
+			wantUp:     assert.False,
+			wantReason: reasonBodyJSONPath,
+		},
+		{
+			name:       "body too large",
+			assertions: handlers.BodyAssertions{Contains: "up", MaxSize: 10},
+			wantUp:     assert.False,
+			wantReason: reasonBodyTooLarge,
+		},
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newHostChecker(handlers.Request{
+				Target:     s.URL,
+				Method:     http.MethodGet,
+				ValidCodes: set.New(http.StatusOK),
+				Body:       tt.assertions,
+			}, nil, s.Client(), slog.Default())
+
+			m := h.probe()
+			tt.wantUp(t, m.Up)
+			assert.Equal(t, http.StatusOK, m.Code)
+			assert.Equal(t, tt.wantReason, m.Reason)
+		})
+	}
+}
+
+func TestCheckJSONPath_InvalidJSON(t *testing.T) {
+	reason, err := checkBody(strings.NewReader(`not json`), handlers.BodyAssertions{JSONPath: "status"})
+	assert.Error(t, err)
+	assert.Equal(t, reasonBodyJSONPath, reason)
+}
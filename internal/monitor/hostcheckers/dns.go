@@ -0,0 +1,109 @@
+package hostcheckers
+
+import (
+	"context"
+	"fmt"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/metrics"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// probeDNS resolves the target using the request's resolver (or the system resolver if none is set). The target is
+// up if the name resolves to at least one record of the requested type and the answer contains all expected records.
+func (h *hostChecker) probeDNS() metrics.Measurement {
+	m := metrics.Measurement{Host: h.req.Target, Type: handlers.ProbeDNS}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+
+	start := time.Now()
+	answer, err := lookup(ctx, newResolver(h.req.Resolver), h.req.RecordType, h.req.Target)
+	if err != nil {
+		h.logger.Debug("measurement failed", "err", err)
+		m.Reason = reasonResolution
+		return m
+	}
+	m.Latency = time.Since(start)
+	m.Up = len(answer) > 0
+	if !m.Up {
+		m.Reason = reasonResolution
+	}
+
+	if len(h.req.Records) > 0 {
+		m.ExpectsAnswer = true
+		m.AnswerMatch = containsAll(answer, h.req.Records)
+		if m.Up && !m.AnswerMatch {
+			m.Up = false
+			m.Reason = reasonAnswerMismatch
+		}
+	}
+
+	h.logger.Debug("measurement made", "up", m.Up, "latency", m.Latency, "answer", answer)
+	return m
+}
+
+func newResolver(address string) *net.Resolver {
+	if address == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+	}
+}
+
+func lookup(ctx context.Context, r *net.Resolver, recordType, name string) ([]string, error) {
+	var answer []string
+	switch recordType {
+	case "", "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answer = append(answer, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answer = append(answer, strings.TrimSuffix(cname, "."))
+	case "MX":
+		mxs, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answer = append(answer, strings.TrimSuffix(mx.Host, "."))
+		}
+	case "TXT":
+		txts, err := r.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answer = append(answer, txts...)
+	default:
+		return nil, fmt.Errorf("unsupported record type: %s", recordType)
+	}
+	return answer, nil
+}
+
+func containsAll(answer []string, expected []string) bool {
+	for _, record := range expected {
+		if !slices.Contains(answer, strings.TrimSuffix(record, ".")) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package hostcheckers
+
+import (
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestHostChecker_probeDNS(t *testing.T) {
+	resolver := newDNSServer(t)
+
+	tests := []struct {
+		name        string
+		target      string
+		recordType  string
+		records     []string
+		wantUp      assert.BoolAssertionFunc
+		wantExpects assert.BoolAssertionFunc
+		wantMatch   assert.BoolAssertionFunc
+	}{
+		{
+			name:        "A",
+			target:      "www.example.com",
+			recordType:  "A",
+			wantUp:      assert.True,
+			wantExpects: assert.False,
+			wantMatch:   assert.False,
+		},
+		{
+			name:        "A: match",
+			target:      "www.example.com",
+			recordType:  "A",
+			records:     []string{"10.0.0.2"},
+			wantUp:      assert.True,
+			wantExpects: assert.True,
+			wantMatch:   assert.True,
+		},
+		{
+			name:        "A: mismatch",
+			target:      "www.example.com",
+			recordType:  "A",
+			records:     []string{"10.0.0.3"},
+			wantUp:      assert.False,
+			wantExpects: assert.True,
+			wantMatch:   assert.False,
+		},
+		{
+			name:        "AAAA",
+			target:      "www.example.com",
+			recordType:  "AAAA",
+			records:     []string{"fd00::1"},
+			wantUp:      assert.True,
+			wantExpects: assert.True,
+			wantMatch:   assert.True,
+		},
+		{
+			name:        "CNAME",
+			target:      "alias.example.com",
+			recordType:  "CNAME",
+			records:     []string{"www.example.com."},
+			wantUp:      assert.True,
+			wantExpects: assert.True,
+			wantMatch:   assert.True,
+		},
+		{
+			name:        "MX",
+			target:      "example.com",
+			recordType:  "MX",
+			records:     []string{"mail.example.com"},
+			wantUp:      assert.True,
+			wantExpects: assert.True,
+			wantMatch:   assert.True,
+		},
+		{
+			name:        "TXT",
+			target:      "example.com",
+			recordType:  "TXT",
+			records:     []string{"v=spf1 -all"},
+			wantUp:      assert.True,
+			wantExpects: assert.True,
+			wantMatch:   assert.True,
+		},
+		{
+			name:        "NXDOMAIN",
+			target:      "missing.example.com",
+			recordType:  "A",
+			records:     []string{"10.0.0.1"},
+			wantUp:      assert.False,
+			wantExpects: assert.False,
+			wantMatch:   assert.False,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := handlers.Request{Target: tt.target, Type: handlers.ProbeDNS, Resolver: resolver, RecordType: tt.recordType, Records: tt.records}
+			h := newHostChecker(r, nil, &http.Client{}, slog.Default())
+			m := h.probe()
+			assert.Equal(t, handlers.ProbeDNS, m.Type)
+			tt.wantUp(t, m.Up)
+			tt.wantExpects(t, m.ExpectsAnswer)
+			tt.wantMatch(t, m.AnswerMatch)
+		})
+	}
+}
+
+// newDNSServer starts an in-process DNS server for a small example.com zone and returns its address.
+func newDNSServer(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp, err := answerDNS(buf[:n]); err == nil {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+var dnsZone = map[string][]dnsmessage.ResourceBody{
+	"www.example.com.": {
+		&dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}},
+		&dnsmessage.AResource{A: [4]byte{10, 0, 0, 2}},
+		&dnsmessage.AAAAResource{AAAA: [16]byte{0xfd, 15: 1}},
+	},
+	"alias.example.com.": {
+		&dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("www.example.com.")},
+	},
+	"example.com.": {
+		&dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.com.")},
+		&dnsmessage.TXTResource{TXT: []string{"v=spf1 -all"}},
+	},
+}
+
+func answerDNS(request []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(request)
+	if err != nil {
+		return nil, err
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	header.Response = true
+	header.Authoritative = true
+	name := question.Name
+	var answers []dnsmessage.Resource
+	records, ok := dnsZone[name.String()]
+	if !ok {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	for _, record := range records {
+		if cname, ok := record.(*dnsmessage.CNAMEResource); ok && question.Type != dnsmessage.TypeCNAME {
+			// follow the alias
+			answers = append(answers, dnsmessage.Resource{Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 60}, Body: cname})
+			name = cname.CNAME
+			records = append(records, dnsZone[name.String()]...)
+			continue
+		}
+		if recordType(record) == question.Type {
+			answers = append(answers, dnsmessage.Resource{Header: dnsmessage.ResourceHeader{Name: name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}, Body: record})
+		}
+	}
+
+	return (&dnsmessage.Message{Header: header, Questions: []dnsmessage.Question{question}, Answers: answers}).Pack()
+}
+
+func recordType(record dnsmessage.ResourceBody) dnsmessage.Type {
+	switch record.(type) {
+	case *dnsmessage.AResource:
+		return dnsmessage.TypeA
+	case *dnsmessage.AAAAResource:
+		return dnsmessage.TypeAAAA
+	case *dnsmessage.CNAMEResource:
+		return dnsmessage.TypeCNAME
+	case *dnsmessage.MXResource:
+		return dnsmessage.TypeMX
+	case *dnsmessage.TXTResource:
+		return dnsmessage.TypeTXT
+	default:
+		return 0
+	}
+}
@@ -1,88 +1,329 @@
 package hostcheckers
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/maintenance"
 	"github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/clambin/uptime/internal/monitor/status"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptrace"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
+const defaultUserAgent = "uptime-monitor"
+
+// Reasons why a target is considered down.
+const (
+	reasonInvalidRequest     = "invalid request"
+	reasonConnectionFailed   = "connection failed"
+	reasonCertificateInvalid = "certificate invalid"
+	reasonStatusCode         = "invalid status code"
+	reasonBodyRead           = "body read failed"
+	reasonBodyTooLarge       = "body too large"
+	reasonBodyContains       = "body missing substring"
+	reasonBodyRegex          = "body regex mismatch"
+	reasonBodyJSONPath       = "body json path mismatch"
+	reasonBannerMismatch     = "banner mismatch"
+	reasonResolution         = "resolution failed"
+	reasonAnswerMismatch     = "answer mismatch"
+	reasonRecovering         = "recovering"
+)
+
+// recheckDelay is the time to wait before checking a target again after its first failure.
+const recheckDelay = time.Second
+
 type hostChecker struct {
-	req        handlers.Request
-	httpClient *http.Client
-	metrics    HTTPObserver
-	shutdown   chan struct{}
-	logger     *slog.Logger
+	req          handlers.Request
+	httpClient   *http.Client
+	metrics      Observer
+	recheckDelay time.Duration
+	slo          float64
+	history      *history
+	maintenance  *maintenance.Windows
+	logger       *slog.Logger
+	// renewed is the last time the target was registered and owners holds the agents that registered it.
+	// Both are protected by the lock of HostCheckers.
+	renewed   time.Time
+	owners    map[string]ownership
+	lock      sync.RWMutex
+	state     targetState
+	lastCheck *handlers.CheckResult
+	nextCheck time.Time
 }
 
-type HTTPObserver interface {
-	Observe(httpMetrics metrics.HTTPMeasurement)
+// ownership records when an agent last registered the target and the request and metadata it registered the target
+// with.
+type ownership struct {
+	renewed  time.Time
+	request  handlers.Request
+	metadata map[string]string
 }
 
-func newHostChecker(req handlers.Request, m HTTPObserver, c *http.Client, l *slog.Logger) *hostChecker {
+type Observer interface {
+	Observe(measurement metrics.Measurement)
+}
+
+func newHostChecker(req handlers.Request, m Observer, c *http.Client, l *slog.Logger) *hostChecker {
 	if c == nil {
 		c = http.DefaultClient
 	}
+	slo := req.SLO
+	if slo == 0 {
+		slo = DefaultSLO
+	}
 	return &hostChecker{
-		req:        req,
-		httpClient: c,
-		metrics:    m,
-		shutdown:   make(chan struct{}),
-		logger:     l,
+		req:          req,
+		httpClient:   c,
+		metrics:      m,
+		state:        newTargetState(req.FailureThreshold, req.SuccessThreshold),
+		recheckDelay: recheckDelay,
+		slo:          slo,
+		history:      &history{},
+		owners:       make(map[string]ownership),
+		logger:       l,
 	}
 }
 
-func (h *hostChecker) Cancel() {
-	h.shutdown <- struct{}{}
-}
-
 func (h *hostChecker) GetRequest() handlers.Request {
 	return h.req
 }
 
-func (h *hostChecker) Run(interval time.Duration) {
-	h.logger.Debug("hostchecker started", "request", h.req)
-	defer h.logger.Debug("hostchecker stopped", "target", h.req.Target)
-	for {
-		h.metrics.Observe(h.ping())
-		select {
-		case <-h.shutdown:
-			return
-		case <-time.After(interval):
+// next returns the time of the next check, as scheduled by the last check.
+func (h *hostChecker) next() time.Time {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.nextCheck
+}
+
+// check probes the target, updates its state and schedules the next check. The measurement reports the state,
+// rather than the result of the probe. During maintenance, the state and uptime of the target are not updated.
+func (h *hostChecker) check(interval time.Duration) metrics.Measurement {
+	m := h.probe()
+	now := time.Now()
+	m.Maintenance = h.maintenance != nil && h.maintenance.Active(h.req.Target, now)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lastCheck = &handlers.CheckResult{
+		Time:        now,
+		Up:          m.Up,
+		Code:        m.Code,
+		Latency:     m.Latency.String(),
+		Reason:      m.Reason,
+		Maintenance: m.Maintenance,
+	}
+	if m.Maintenance {
+		// report the state from before the maintenance. A target that has not been checked before is reported up.
+		m.Up, m.Reason = h.state.up || !h.state.known, ""
+	} else {
+		h.updateState(&m, now)
+	}
+	m.SLO = h.slo
+	m.Uptime = h.history.uptime(now, h.slo)
+	h.nextCheck = now.Add(interval)
+	if h.state.recheck() {
+		h.logger.Debug("check failed. rechecking")
+		h.nextCheck = now.Add(h.recheckDelay)
+	}
+	return m
+}
+
+// updateState records the result of the probe in the state and uptime history of the target.
+func (h *hostChecker) updateState(m *metrics.Measurement, now time.Time) {
+	lastChange := h.state.lastChange
+	if m.Transition = h.state.update(m.Up); m.Transition {
+		h.logger.Info("target state changed", "up", h.state.up, "reason", m.Reason)
+		if h.state.up {
+			m.Downtime = h.state.lastChange.Sub(lastChange)
+			h.history.up(now)
+		} else {
+			h.history.down(now, m.Reason)
+		}
+	}
+	if m.Up = h.state.up; !m.Up && m.Reason == "" {
+		m.Reason = reasonRecovering
+	}
+	h.history.record(now, m.Up, m.Latency)
+}
+
+func (h *hostChecker) status() handlers.TargetStatus {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	status := handlers.TargetStatus{
+		Request:             h.req,
+		Owners:              h.ownerNames(),
+		LastCheck:           h.lastCheck,
+		ConsecutiveFailures: h.state.failures,
+		NextCheck:           h.nextCheck,
+		SLO:                 h.slo,
+		Uptime:              h.history.uptime(time.Now(), h.slo),
+		Maintenance:         h.maintenance != nil && h.maintenance.Active(h.req.Target, time.Now()),
+	}
+	if h.state.known {
+		up, lastChange := h.state.up, h.state.lastChange
+		status.Up = &up
+		status.LastStateChange = &lastChange
+	}
+	return status
+}
+
+func (h *hostChecker) statusTarget() status.Target {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	target := status.Target{
+		Target:      h.req.Target,
+		Maintenance: h.lastCheck != nil && h.lastCheck.Maintenance,
+	}
+	if h.state.known {
+		up := h.state.up
+		target.Up = &up
+	}
+	target.Days, target.Incidents = h.history.status(time.Now())
+	return target
+}
+
+// ownerNames returns the sorted names of the agents that registered the target. Agents without a name are omitted.
+func (h *hostChecker) ownerNames() []string {
+	names := make([]string, 0, len(h.owners))
+	for owner := range h.owners {
+		if owner != "" {
+			names = append(names, owner)
 		}
 	}
+	slices.Sort(names)
+	return names
+}
+
+// ownerRequest returns the request of the owner whose name sorts first. It returns false if the target has no owners.
+func (h *hostChecker) ownerRequest() (handlers.Request, bool) {
+	if len(h.owners) == 0 {
+		return handlers.Request{}, false
+	}
+	names := make([]string, 0, len(h.owners))
+	for owner := range h.owners {
+		names = append(names, owner)
+	}
+	return h.owners[slices.Min(names)].request, true
+}
+
+// ownerMetrics returns the named owners of the target, sorted by name.
+func (h *hostChecker) ownerMetrics() []metrics.Owner {
+	names := h.ownerNames()
+	owners := make([]metrics.Owner, len(names))
+	for i, name := range names {
+		owners[i] = metrics.Owner{Name: name, Metadata: h.owners[name].metadata}
+	}
+	return owners
+}
+
+func (h *hostChecker) probe() metrics.Measurement {
+	switch h.req.Type {
+	case handlers.ProbeTCP:
+		return h.probeTCP()
+	case handlers.ProbeDNS:
+		return h.probeDNS()
+	default:
+		return h.probeHTTP()
+	}
+}
+
+const defaultTimeout = 10 * time.Second
+
+// timeout returns the timeout for non-HTTP probes. It follows the timeout of the HTTP client, so all probes
+// share the same timeout.
+func (h *hostChecker) timeout() time.Duration {
+	if h.httpClient.Timeout > 0 {
+		return h.httpClient.Timeout
+	}
+	return defaultTimeout
 }
 
-func (h *hostChecker) ping() metrics.HTTPMeasurement {
-	m := metrics.HTTPMeasurement{Host: h.req.Target}
+func (h *hostChecker) probeHTTP() metrics.Measurement {
+	m := metrics.Measurement{Host: h.req.Target, Type: handlers.ProbeHTTP}
 
 	target := h.req.Target
 	if !strings.HasPrefix(target, "https://") && !strings.HasPrefix(target, "http://") {
 		target = "https://" + target
 	}
 
-	req, _ := http.NewRequest(h.req.Method, target, nil)
+	var payload io.Reader
+	if h.req.Payload != "" {
+		payload = strings.NewReader(h.req.Payload)
+	}
+	req, err := http.NewRequest(h.req.Method, target, payload)
+	if err != nil {
+		h.logger.Debug("invalid request", "err", err)
+		m.Reason = reasonInvalidRequest
+		return m
+	}
+	for name, values := range h.req.Headers {
+		req.Header[name] = values
+	}
+	if h.req.Host != "" {
+		req.Host = h.req.Host
+	}
+	userAgent := h.req.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	var timer phaseTimer
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
 
 	start := time.Now()
 	resp, err := h.httpClient.Do(req)
 
 	if err != nil {
 		h.logger.Debug("measurement failed", "err", err)
+		m.Reason = reasonConnectionFailed
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) && len(certErr.UnverifiedCertificates) > 0 {
+			m.Reason = reasonCertificateInvalid
+			h.observeTLS(&m, certErr.UnverifiedCertificates, nil, req.URL.Hostname())
+		}
 		return m
 	}
 
-	_ = resp.Body.Close()
-	m.Up = h.req.ValidCodes.Contains(resp.StatusCode)
 	m.Code = resp.StatusCode
+	m.Up = h.req.ValidCodes.Contains(resp.StatusCode)
+	if !m.Up {
+		m.Reason = reasonStatusCode
+	}
+	if m.Up && !h.req.Body.IsZero() {
+		if m.Reason, err = checkBody(resp.Body, h.req.Body); err != nil {
+			h.logger.Debug("body assertion failed", "reason", m.Reason, "err", err)
+			m.Up = false
+		}
+	} else {
+		// drain the body so the transfer phase covers the full response
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, defaultMaxBodySize))
+	}
+	_ = resp.Body.Close()
 	m.Latency = time.Since(start)
+	m.Phases = timer.done()
 	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
-		m.IsTLS = true
-		// PeerCertificates: the first one in the list is the leaf certificate
-		m.TLSExpiry = time.Until(resp.TLS.PeerCertificates[0].NotAfter)
+		h.observeTLS(&m, resp.TLS.PeerCertificates, resp.TLS, req.URL.Hostname())
 	}
 
-	h.logger.Debug("measurement made", "up", m.Up, "latency", m.Latency, "code", m.Code)
+	h.logger.Debug("measurement made", "up", m.Up, "latency", m.Latency, "code", m.Code, "phases", m.Phases)
 	return m
 }
+
+func (h *hostChecker) observeTLS(m *metrics.Measurement, certificates []*x509.Certificate, state *tls.ConnectionState, hostname string) {
+	m.IsTLS = true
+	// PeerCertificates: the first one in the list is the leaf certificate
+	m.TLSExpiry = time.Until(certificates[0].NotAfter)
+	m.TLS = inspectTLS(certificates, state, hostname, rootCAs(h.httpClient))
+	if m.TLS.VerifyError != "" {
+		h.logger.Debug("certificate does not verify", "tls", m.TLS)
+	}
+}
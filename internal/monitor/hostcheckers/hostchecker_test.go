@@ -5,6 +5,7 @@ import (
 	"github.com/clambin/uptime/internal/monitor/handlers"
 	"github.com/clambin/uptime/internal/monitor/metrics"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -49,43 +50,108 @@ func TestHostChecker_Up(t *testing.T) {
 				Target:     strings.TrimPrefix(s.URL, "https://"),
 				Method:     http.MethodGet,
 				ValidCodes: set.New(tt.valid...),
+				Interval:   10 * time.Millisecond,
 			}
 			h := newHostChecker(r, &o, s.Client(), slog.Default())
 			assert.Equal(t, r, h.GetRequest())
-			go h.Run(10 * time.Millisecond)
+			sched := newScheduler(1, 0)
+			sched.add(h, 0)
 
-			var m metrics.HTTPMeasurement
+			var m metrics.Measurement
 			var ok bool
 			assert.Eventually(t, func() bool {
 				m, ok = o.result()
 				return ok
 			}, time.Second, 20*time.Millisecond)
 
-			h.Cancel()
+			sched.remove(h)
 
 			tt.wantUp(t, m.Up)
 			assert.True(t, m.IsTLS)
 			assert.NotZero(t, m.TLSExpiry)
+			assert.NotZero(t, m.Phases.TTFB)
 		})
 	}
 }
 
-var _ HTTPObserver = &observer{}
+func TestHostChecker_probeHTTP_Request(t *testing.T) {
+	tests := []struct {
+		name          string
+		req           handlers.Request
+		wantMethod    string
+		wantHost      string
+		wantUserAgent string
+		wantAccept    string
+		wantBody      string
+	}{
+		{
+			name:          "default",
+			req:           handlers.Request{Method: http.MethodGet},
+			wantMethod:    http.MethodGet,
+			wantUserAgent: defaultUserAgent,
+		},
+		{
+			name: "custom",
+			req: handlers.Request{
+				Method:    http.MethodPost,
+				Headers:   http.Header{"Accept": []string{"application/json"}},
+				Payload:   `{"ping":true}`,
+				Host:      "www.example.com",
+				UserAgent: "uptime/1.0",
+			},
+			wantMethod:    http.MethodPost,
+			wantHost:      "www.example.com",
+			wantUserAgent: "uptime/1.0",
+			wantAccept:    "application/json",
+			wantBody:      `{"ping":true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var received *http.Request
+			var body []byte
+			s := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				received = r
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer s.Close()
+
+			tt.req.Target = s.URL
+			tt.req.ValidCodes = set.New(http.StatusOK)
+			h := newHostChecker(tt.req, nil, s.Client(), slog.Default())
+			assert.True(t, h.probe().Up)
+
+			assert.Equal(t, tt.wantMethod, received.Method)
+			if tt.wantHost == "" {
+				tt.wantHost = s.Listener.Addr().String()
+			}
+			assert.Equal(t, tt.wantHost, received.Host)
+			assert.Equal(t, tt.wantUserAgent, received.UserAgent())
+			assert.Equal(t, tt.wantAccept, received.Header.Get("Accept"))
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
+
+var _ Observer = &observer{}
 
 type observer struct {
-	observation metrics.HTTPMeasurement
+	observation metrics.Measurement
 	received    bool
 	lock        sync.Mutex
 }
 
-func (o *observer) Observe(httpMetrics metrics.HTTPMeasurement) {
+func (o *observer) Observe(measurement metrics.Measurement) {
 	o.lock.Lock()
 	defer o.lock.Unlock()
-	o.observation = httpMetrics
+	o.observation = measurement
 	o.received = true
 }
 
-func (o *observer) result() (metrics.HTTPMeasurement, bool) {
+func (o *observer) result() (metrics.Measurement, bool) {
 	o.lock.Lock()
 	defer o.lock.Unlock()
 	return o.observation, o.received
@@ -1,56 +1,410 @@
 package hostcheckers
 
 import (
+	"context"
 	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/maintenance"
 	metrics2 "github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/clambin/uptime/internal/monitor/status"
+	"github.com/clambin/uptime/internal/monitor/store"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 type HostCheckers struct {
-	Metrics      *metrics2.HostMetrics
-	HTTPClient   *http.Client
+	Metrics    *metrics2.HostMetrics
+	HTTPClient *http.Client
+	Store      TargetStore
+	// Workers is the number of checks that can run at the same time. MaxInFlightPerHost limits the number of
+	// concurrent checks of the same host (0: no limit). StartJitter spreads the first check of new targets over
+	// up to StartJitter, or the target's interval if that is shorter.
+	// Changes only take effect before the first target is added.
+	Workers            int
+	MaxInFlightPerHost int
+	StartJitter        time.Duration
+	// SLO is the target uptime ratio of targets that do not set their own SLO. Zero means DefaultSLO.
+	SLO float64
+	// Maintenance, if not nil, holds the maintenance windows of the targets.
+	Maintenance *maintenance.Windows
+	// Alerts, if not nil, observes the measurements of all targets, e.g. to send notifications.
+	Alerts       Observer
 	lock         sync.Mutex
 	hostCheckers map[string]*hostChecker
+	scheduler    *scheduler
+	flushLock    sync.Mutex
+	flushPending bool
 }
 
+// TargetStore persists the registered targets and their owners, so they can be restored when the monitor restarts.
+// The uptime history of the targets is not persisted.
+// Save and Delete are called while HostCheckers is locked and should only record the change. Flush persists the
+// recorded changes.
+type TargetStore interface {
+	Load() ([]store.Target, error)
+	Save(store.Target) error
+	Delete(target string) error
+	Flush() error
+}
+
+// storeDelay is the time between a change to the targets and the write to the Store. All changes made in the
+// meantime, e.g. by a Reconcile, are written at once.
+const storeDelay = time.Second
+
 func New(hostMetrics *metrics2.HostMetrics, httpClient *http.Client) *HostCheckers {
 	return &HostCheckers{
-		Metrics:      hostMetrics,
-		HTTPClient:   httpClient,
-		hostCheckers: make(map[string]*hostChecker),
+		Metrics:            hostMetrics,
+		HTTPClient:         httpClient,
+		Workers:            DefaultWorkers,
+		MaxInFlightPerHost: DefaultMaxInFlightPerHost,
+		hostCheckers:       make(map[string]*hostChecker),
 	}
 }
 
-func (h *HostCheckers) Add(request handlers.Request, logger *slog.Logger) {
+// Add registers agent as an owner of the target and starts checking the target.
+func (h *HostCheckers) Add(agent string, request handlers.Request, logger *slog.Logger) {
 	h.lock.Lock()
 	defer h.lock.Unlock()
+	h.add(agent, request, logger)
+}
+
+type addResult int
+
+const (
+	targetUnchanged addResult = iota
+	targetAdded
+	targetUpdated
+)
+
+// add registers agent as an owner of the target and renews its lease. If the target is not checked yet, add starts
+// checking the target. The target keeps its other owners. The request's metadata is kept per owner.
+//
+// If owners register the target with different requests, the target is checked with the request of the owner whose
+// name sorts first, so the owners do not replace each other's request every time they register the target.
+func (h *HostCheckers) add(agent string, request handlers.Request, logger *slog.Logger) addResult {
+	owner := ownership{renewed: time.Now(), metadata: request.Metadata}
+	request.Metadata = nil
+	owner.request = request
 
 	c, ok := h.hostCheckers[request.Target]
-	if ok {
-		if c.GetRequest().Equals(request) {
+	if !ok {
+		logger.Info("target added", "target", request, "agent", agent)
+		c = h.start(request, nil, logger)
+		c.owners[agent] = owner
+		h.observeOwners(c)
+		h.save(c, logger)
+		return targetAdded
+	}
+
+	current, owned := c.owners[agent]
+	c.renewed = owner.renewed
+	c.owners[agent] = owner
+	if !owned {
+		logger.Info("target owner added", "target", request.Target, "agent", agent)
+	}
+	if h.update(c, logger) {
+		return targetUpdated
+	}
+	if !c.GetRequest().Equals(request) && (!owned || !current.request.Equals(request)) {
+		logger.Warn("agents registered the target with different requests", "target", request.Target, "agent", agent, "owners", c.ownerNames())
+	}
+	if !owned {
+		h.save(c, logger)
+	}
+	if !owned || !maps.Equal(current.metadata, owner.metadata) {
+		h.observeOwners(c)
+	}
+	return targetUnchanged
+}
+
+// update restarts checking the target if the request of its owners differs from the request the target is checked
+// with. The target keeps its owners and uptime history. update returns true if the target was restarted.
+func (h *HostCheckers) update(c *hostChecker, logger *slog.Logger) bool {
+	request, ok := c.ownerRequest()
+	if !ok || c.GetRequest().Equals(request) {
+		return false
+	}
+	logger.Debug("target replaced. shutting down old hostChecker", "target", request.Target)
+	h.scheduler.remove(c)
+	delete(h.hostCheckers, request.Target)
+
+	logger.Info("target updated", "target", request)
+	n := h.start(request, c.history, logger)
+	n.owners = c.owners
+	n.renewed = c.renewed
+	h.observeOwners(n)
+	h.save(n, logger)
+	return true
+}
+
+// Reconcile makes the targets owned by agent match requests: new targets are added, changed targets are updated and
+// agent releases the targets that are no longer requested. Targets owned by other agents are not removed.
+func (h *HostCheckers) Reconcile(agent string, requests []handlers.Request, logger *slog.Logger) handlers.ReconcileResult {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var result handlers.ReconcileResult
+	desired := make(map[string]struct{}, len(requests))
+	for _, request := range requests {
+		desired[request.Target] = struct{}{}
+		switch h.add(agent, request, logger) {
+		case targetAdded:
+			result.Added++
+		case targetUpdated:
+			result.Updated++
+		}
+	}
+	for target, c := range h.hostCheckers {
+		if _, ok := desired[target]; ok {
+			continue
+		}
+		if _, ok := c.owners[agent]; ok {
+			h.release(agent, target, logger)
+			result.Removed++
+		}
+	}
+	logger.Info("targets reconciled", "agent", agent, "added", result.Added, "updated", result.Updated, "removed", result.Removed)
+	return result
+}
+
+// Restore starts checking the targets in the Store. Restored targets keep their owners, whose leases start when
+// the target is restored, so an agent's next Reconcile releases the targets it no longer requests.
+func (h *HostCheckers) Restore(logger *slog.Logger) error {
+	if h.Store == nil {
+		return nil
+	}
+	targets, err := h.Store.Load()
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, target := range targets {
+		if _, ok := h.hostCheckers[target.Request.Target]; ok {
+			continue
+		}
+		c := h.start(target.Request, nil, logger)
+		for _, agent := range target.Owners {
+			c.owners[agent] = ownership{renewed: c.renewed, request: target.Request}
+		}
+		h.observeOwners(c)
+	}
+	logger.Info("targets restored", "count", len(targets))
+	return nil
+}
+
+// ExpireLeases removes targets that have not been registered again for longer than ttl. Agents periodically resend
+// their targets, so a target whose lease is not renewed belongs to an agent that disappeared.
+func (h *HostCheckers) ExpireLeases(ctx context.Context, ttl time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(max(ttl/10, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			h.expire(ttl, logger)
+		}
+	}
+}
+
+// expire removes the owners whose lease expired. Targets without owners are removed once their lease expires.
+func (h *HostCheckers) expire(ttl time.Duration, logger *slog.Logger) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for target, c := range h.hostCheckers {
+		var expired bool
+		for agent, owner := range c.owners {
+			if time.Since(owner.renewed) > ttl {
+				logger.Info("target ownership expired", "target", target, "agent", agent, "renewed", owner.renewed)
+				delete(c.owners, agent)
+				expired = true
+			}
+		}
+		if len(c.owners) > 0 || time.Since(c.renewed) <= ttl {
+			if expired && !h.update(c, logger) {
+				h.observeOwners(c)
+				h.save(c, logger)
+			}
+			continue
+		}
+		logger.Info("target expired", "target", target, "renewed", c.renewed)
+		h.remove(target, logger)
+		if h.Metrics != nil {
+			h.Metrics.ObserveExpiry(target)
 		}
-		logger.Debug("target replaced. shutting down old hostChecker", "target", request.Target)
-		c.Cancel()
-		delete(h.hostCheckers, request.Target)
 	}
+}
 
-	logger.Info("target added", "target", request)
-	hc := newHostChecker(request, h.Metrics, h.HTTPClient, logger.With("target", request.Target))
+// start schedules the checks of the target. If past is not nil, the target continues the uptime history of a
+// previous request.
+func (h *HostCheckers) start(request handlers.Request, past *history, logger *slog.Logger) *hostChecker {
+	if h.scheduler == nil {
+		h.scheduler = newScheduler(h.Workers, h.MaxInFlightPerHost)
+	}
+	hc := newHostChecker(request, h.observer(), h.HTTPClient, logger.With("target", request.Target))
+	if request.SLO == 0 && h.SLO > 0 {
+		hc.slo = h.SLO
+	}
+	if past != nil {
+		hc.history = past
+	}
+	hc.maintenance = h.Maintenance
+	hc.renewed = time.Now()
 	h.hostCheckers[request.Target] = hc
-	go hc.Run(request.Interval)
+	h.scheduler.add(hc, startDelay(h.StartJitter, request.Interval))
+	return hc
 }
 
-func (h *HostCheckers) Remove(request handlers.Request, logger *slog.Logger) {
+// observer returns the Observer of the measurements of a target.
+func (h *HostCheckers) observer() Observer {
+	if h.Alerts == nil {
+		return h.Metrics
+	}
+	return observers{h.Metrics, h.Alerts}
+}
+
+// observers sends measurements to each of its observers.
+type observers []Observer
+
+func (o observers) Observe(measurement metrics2.Measurement) {
+	for _, observer := range o {
+		observer.Observe(measurement)
+	}
+}
+
+func (h *HostCheckers) Targets() []handlers.TargetStatus {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
-	c, ok := h.hostCheckers[request.Target]
-	if ok {
-		logger.Info("target removed", "target", request)
-		c.Cancel()
-		delete(h.hostCheckers, request.Target)
+	targets := make([]handlers.TargetStatus, 0, len(h.hostCheckers))
+	for _, c := range h.hostCheckers {
+		targets = append(targets, c.status())
+	}
+	slices.SortFunc(targets, func(a, b handlers.TargetStatus) int {
+		return strings.Compare(a.Request.Target, b.Request.Target)
+	})
+	return targets
+}
+
+// StatusTargets returns the status of the targets for the status page, sorted by target.
+func (h *HostCheckers) StatusTargets() []status.Target {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	targets := make([]status.Target, 0, len(h.hostCheckers))
+	for _, c := range h.hostCheckers {
+		targets = append(targets, c.statusTarget())
+	}
+	slices.SortFunc(targets, func(a, b status.Target) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+	return targets
+}
+
+func (h *HostCheckers) Target(target string) (handlers.TargetStatus, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	c, ok := h.hostCheckers[target]
+	if !ok {
+		return handlers.TargetStatus{}, false
+	}
+	return c.status(), true
+}
+
+// Remove releases agent's ownership of the target. The target is removed once no agent owns it anymore.
+func (h *HostCheckers) Remove(agent string, request handlers.Request, logger *slog.Logger) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if _, ok := h.hostCheckers[request.Target]; ok {
+		h.release(agent, request.Target, logger)
+		return
+	}
+	if h.Store != nil {
+		// the target may still be stored, e.g. if it failed to restore
+		if err := h.Store.Delete(request.Target); err != nil {
+			logger.Warn("failed to remove stored target", "target", request.Target, "err", err)
+		}
+		h.storeChanged(logger)
+	}
+}
+
+// release removes agent as an owner of the target and removes the target if it has no owners left.
+func (h *HostCheckers) release(agent string, target string, logger *slog.Logger) {
+	c := h.hostCheckers[target]
+	delete(c.owners, agent)
+	if len(c.owners) > 0 {
+		logger.Info("target owner removed", "target", target, "agent", agent, "owners", c.ownerNames())
+		if !h.update(c, logger) {
+			h.observeOwners(c)
+			h.save(c, logger)
+		}
+		return
+	}
+	h.remove(target, logger)
+}
+
+// remove stops checking the target, removes its metrics and removes it from the Store.
+func (h *HostCheckers) remove(target string, logger *slog.Logger) {
+	c := h.hostCheckers[target]
+	logger.Info("target removed", "target", c.GetRequest())
+	h.scheduler.remove(c)
+	delete(h.hostCheckers, target)
+	if h.Metrics != nil {
+		h.Metrics.Forget(target)
+	}
+	if h.Store != nil {
+		if err := h.Store.Delete(target); err != nil {
+			logger.Warn("failed to remove stored target", "target", target, "err", err)
+		}
+		h.storeChanged(logger)
+	}
+}
+
+// save records the request and owners of the target in the Store.
+func (h *HostCheckers) save(c *hostChecker, logger *slog.Logger) {
+	if h.Store == nil {
+		return
+	}
+	owners := make([]string, 0, len(c.owners))
+	for agent := range c.owners {
+		owners = append(owners, agent)
+	}
+	slices.Sort(owners)
+	if err := h.Store.Save(store.Target{Request: c.GetRequest(), Owners: owners}); err != nil {
+		logger.Warn("failed to store target", "target", c.req.Target, "err", err)
+	}
+	h.storeChanged(logger)
+}
+
+// storeChanged schedules a Flush of the Store, unless one is already pending. The Flush runs without holding the
+// lock, so writing the Store does not block the API or the checks.
+func (h *HostCheckers) storeChanged(logger *slog.Logger) {
+	h.flushLock.Lock()
+	defer h.flushLock.Unlock()
+	if h.flushPending {
+		return
+	}
+	h.flushPending = true
+	time.AfterFunc(storeDelay, func() {
+		h.flushLock.Lock()
+		h.flushPending = false
+		h.flushLock.Unlock()
+		if err := h.Store.Flush(); err != nil {
+			logger.Warn("failed to write stored targets", "err", err)
+		}
+	})
+}
+
+func (h *HostCheckers) observeOwners(c *hostChecker) {
+	if h.Metrics != nil {
+		h.Metrics.ObserveOwners(c.req.Target, c.ownerMetrics())
 	}
 }
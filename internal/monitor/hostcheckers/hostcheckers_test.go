@@ -1,12 +1,20 @@
 package hostcheckers
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"github.com/clambin/go-common/set"
 	"github.com/clambin/uptime/internal/monitor/handlers"
 	"github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/clambin/uptime/internal/monitor/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -26,22 +34,379 @@ func TestHostCheckers(t *testing.T) {
 		hostCheckers: make(map[string]*hostChecker),
 	}
 
-	checkers.Add(req, l)
+	checkers.Add("", req, l)
 	p, ok := checkers.hostCheckers[req.Target]
 	assert.True(t, ok)
 
-	checkers.Add(req, l)
+	checkers.Add("", req, l)
 	p2, ok := checkers.hostCheckers[req.Target]
 	assert.True(t, ok)
 	assert.Equal(t, p, p2)
 
 	req.Interval = time.Hour
-	checkers.Add(req, l)
+	checkers.Add("", req, l)
 	p2, ok = checkers.hostCheckers[req.Target]
 	assert.True(t, ok)
 	assert.NotEqual(t, p, p2)
 
-	checkers.Remove(req, l)
+	checkers.Remove("", req, l)
 	_, ok = checkers.hostCheckers[req.Target]
 	assert.False(t, ok)
 }
+
+func TestHostCheckers_Targets(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	checkers := New(metrics.NewHostMetrics("", "", nil), s.Client())
+	req := handlers.Request{
+		Target:           s.URL,
+		Method:           http.MethodGet,
+		ValidCodes:       set.New(http.StatusOK),
+		Interval:         time.Hour,
+		FailureThreshold: 3,
+	}
+	checkers.Add("", req, slog.Default())
+	defer checkers.Remove("", req, slog.Default())
+
+	assert.Eventually(t, func() bool {
+		status, ok := checkers.Target(s.URL)
+		return ok && status.ConsecutiveFailures == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	targets := checkers.Targets()
+	require.Len(t, targets, 1)
+	status := targets[0]
+	assert.Equal(t, req, status.Request)
+	// the first failure does not set the state: the target is rechecked until it reaches the failure threshold
+	assert.Nil(t, status.Up)
+	require.NotNil(t, status.LastCheck)
+	assert.Equal(t, http.StatusInternalServerError, status.LastCheck.Code)
+	assert.Equal(t, reasonStatusCode, status.LastCheck.Reason)
+	assert.True(t, status.NextCheck.Before(time.Now().Add(time.Minute)))
+
+	_, ok := checkers.Target("http://localhost:1")
+	assert.False(t, ok)
+}
+
+func TestHostCheckers_Store(t *testing.T) {
+	s := &fakeStore{targets: map[string]store.Target{
+		"example.com": {Request: handlers.Request{Target: "example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}},
+	}}
+	l := slog.Default()
+
+	checkers := New(metrics.NewHostMetrics("", "", nil), nil)
+	checkers.Store = s
+	require.NoError(t, checkers.Restore(l))
+	_, ok := checkers.Target("example.com")
+	assert.True(t, ok)
+
+	req := handlers.Request{Target: "example.org", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+	checkers.Add("", req, l)
+	assert.Contains(t, s.targets, "example.org")
+
+	checkers.Remove("", handlers.Request{Target: "example.com"}, l)
+	checkers.Remove("", req, l)
+	assert.Empty(t, s.targets)
+	assert.Empty(t, checkers.Targets())
+}
+
+func TestHostCheckers_Store_Owners(t *testing.T) {
+	newRequest := func(target string) handlers.Request {
+		return handlers.Request{Target: target, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+	}
+	s := &fakeStore{targets: make(map[string]store.Target)}
+	l := slog.Default()
+
+	checkers := New(metrics.NewHostMetrics("", "", nil), nil)
+	checkers.Store = s
+	checkers.Reconcile("cluster-a", []handlers.Request{newRequest("example.com"), newRequest("example.org")}, l)
+	checkers.Add("cluster-b", newRequest("example.com"), l)
+	assert.Equal(t, []string{"cluster-a", "cluster-b"}, s.targets["example.com"].Owners)
+	assert.Equal(t, []string{"cluster-a"}, s.targets["example.org"].Owners)
+
+	// restored targets keep their owners, so reconciling releases the targets that are no longer requested
+	restored := New(metrics.NewHostMetrics("", "", nil), nil)
+	restored.Store = s
+	require.NoError(t, restored.Restore(l))
+	status, ok := restored.Target("example.com")
+	require.True(t, ok)
+	assert.Equal(t, []string{"cluster-a", "cluster-b"}, status.Owners)
+
+	assert.Equal(t, handlers.ReconcileResult{Removed: 2}, restored.Reconcile("cluster-a", nil, l))
+	targets := restored.Targets()
+	require.Len(t, targets, 1)
+	assert.Equal(t, "example.com", targets[0].Request.Target)
+	assert.Equal(t, []string{"cluster-b"}, targets[0].Owners)
+	assert.Equal(t, []string{"cluster-b"}, s.targets["example.com"].Owners)
+	assert.NotContains(t, s.targets, "example.org")
+}
+
+func TestHostCheckers_Store_Batched(t *testing.T) {
+	s := &fakeStore{targets: make(map[string]store.Target)}
+	checkers := New(metrics.NewHostMetrics("", "", nil), nil)
+	checkers.Store = s
+	l := slog.Default()
+
+	requests := make([]handlers.Request, 100)
+	for i := range requests {
+		requests[i] = handlers.Request{Target: fmt.Sprintf("https://%d.example.com", i), Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+	}
+	checkers.Reconcile("cluster", requests, l)
+	checkers.Add("other", handlers.Request{Target: "https://example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}, l)
+	assert.Len(t, s.targets, len(requests)+1)
+	assert.Zero(t, s.flushes.Load())
+
+	// all changes are written at once
+	assert.Eventually(t, func() bool { return s.flushes.Load() == 1 }, 2*storeDelay, 10*time.Millisecond)
+	checkers.Remove("other", handlers.Request{Target: "https://example.com"}, l)
+	assert.Eventually(t, func() bool { return s.flushes.Load() == 2 }, 2*storeDelay, 10*time.Millisecond)
+}
+
+var _ TargetStore = &fakeStore{}
+
+type fakeStore struct {
+	targets map[string]store.Target
+	flushes atomic.Int32
+}
+
+func (f *fakeStore) Load() ([]store.Target, error) {
+	targets := make([]store.Target, 0, len(f.targets))
+	for _, target := range f.targets {
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func (f *fakeStore) Save(target store.Target) error {
+	f.targets[target.Request.Target] = target
+	return nil
+}
+
+func (f *fakeStore) Delete(target string) error {
+	delete(f.targets, target)
+	return nil
+}
+
+func (f *fakeStore) Flush() error {
+	f.flushes.Add(1)
+	return nil
+}
+
+func TestHostCheckers_ExpireLeases(t *testing.T) {
+	s := &fakeStore{targets: make(map[string]store.Target)}
+	m := metrics.NewHostMetrics("uptime", "monitor", nil)
+	checkers := New(m, nil)
+	checkers.Store = s
+	l := slog.Default()
+
+	renewed := handlers.Request{Target: "example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+	expired := handlers.Request{Target: "example.org", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+	checkers.Add("", renewed, l)
+	checkers.Add("", expired, l)
+
+	checkers.lock.Lock()
+	for _, c := range checkers.hostCheckers {
+		c.renewed = time.Now().Add(-time.Hour)
+		for name, owner := range c.owners {
+			owner.renewed = c.renewed
+			c.owners[name] = owner
+		}
+	}
+	checkers.lock.Unlock()
+
+	// registering the same request again renews the lease
+	checkers.Add("", renewed, l)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go checkers.ExpireLeases(ctx, 10*time.Second, l)
+
+	assert.Eventually(t, func() bool {
+		return len(checkers.Targets()) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+
+	_, ok := checkers.Target(renewed.Target)
+	assert.True(t, ok)
+	assert.NotContains(t, s.targets, expired.Target)
+	assert.NoError(t, testutil.CollectAndCompare(m, bytes.NewBufferString(`
+# HELP uptime_monitor_expired_targets_total number of targets removed because their registration was not renewed
+# TYPE uptime_monitor_expired_targets_total counter
+uptime_monitor_expired_targets_total{host="example.org"} 1
+`), "uptime_monitor_expired_targets_total"))
+}
+
+func TestHostCheckers_ExpireLeases_Metrics(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	m := metrics.NewHostMetrics("uptime", "monitor", nil)
+	checkers := New(m, s.Client())
+	l := slog.Default()
+	req := handlers.Request{Target: s.URL, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+	checkers.Add("cluster", req, l)
+
+	assert.Eventually(t, func() bool {
+		return testutil.CollectAndCount(m, "uptime_monitor_up", "uptime_monitor_down_reason") == 2
+	}, time.Second, 10*time.Millisecond)
+
+	checkers.lock.Lock()
+	c := checkers.hostCheckers[req.Target]
+	c.renewed = time.Now().Add(-time.Hour)
+	c.owners["cluster"] = ownership{renewed: c.renewed}
+	checkers.lock.Unlock()
+	checkers.expire(time.Minute, l)
+
+	// only the expiry is still reported
+	assert.Equal(t, 1, testutil.CollectAndCount(m))
+	assert.Equal(t, 1, testutil.CollectAndCount(m, "uptime_monitor_expired_targets_total"))
+}
+
+func TestHostCheckers_Reconcile(t *testing.T) {
+	checkers := New(metrics.NewHostMetrics("", "", nil), nil)
+	l := slog.Default()
+	newRequest := func(target string, interval time.Duration) handlers.Request {
+		return handlers.Request{Target: target, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: interval}
+	}
+
+	checkers.Reconcile("other", []handlers.Request{newRequest("example.net", time.Hour)}, l)
+
+	result := checkers.Reconcile("cluster", []handlers.Request{newRequest("example.com", time.Hour), newRequest("example.org", time.Hour)}, l)
+	assert.Equal(t, handlers.ReconcileResult{Added: 2}, result)
+
+	result = checkers.Reconcile("cluster", []handlers.Request{newRequest("example.com", time.Hour)}, l)
+	assert.Equal(t, handlers.ReconcileResult{Removed: 1}, result)
+
+	result = checkers.Reconcile("cluster", []handlers.Request{newRequest("example.com", time.Minute)}, l)
+	assert.Equal(t, handlers.ReconcileResult{Updated: 1}, result)
+
+	targets := checkers.Targets()
+	require.Len(t, targets, 2)
+	assert.Equal(t, "example.com", targets[0].Request.Target)
+	assert.Equal(t, []string{"cluster"}, targets[0].Owners)
+	assert.Equal(t, time.Minute, targets[0].Request.Interval)
+	assert.Equal(t, "example.net", targets[1].Request.Target)
+	assert.Equal(t, []string{"other"}, targets[1].Owners)
+
+	// an empty set removes all targets of the agent
+	result = checkers.Reconcile("cluster", nil, l)
+	assert.Equal(t, handlers.ReconcileResult{Removed: 1}, result)
+	assert.Len(t, checkers.Targets(), 1)
+}
+
+func TestHostCheckers_Owners(t *testing.T) {
+	m := metrics.NewHostMetrics("uptime", "monitor", nil)
+	checkers := New(m, nil)
+	l := slog.Default()
+	req := handlers.Request{Target: "example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+
+	checkers.Add("cluster-a", req, l)
+	checkers.Add("cluster-b", req, l)
+	status, ok := checkers.Target(req.Target)
+	require.True(t, ok)
+	assert.Equal(t, []string{"cluster-a", "cluster-b"}, status.Owners)
+	assert.NoError(t, testutil.CollectAndCompare(m, bytes.NewBufferString(`
+# HELP uptime_monitor_owner agent that registered the site. join on host to add the owner to other metrics
+# TYPE uptime_monitor_owner gauge
+uptime_monitor_owner{host="example.com",owner="cluster-a"} 1
+uptime_monitor_owner{host="example.com",owner="cluster-b"} 1
+`), "uptime_monitor_owner"))
+
+	// a different request keeps the owners
+	req.Interval = time.Minute
+	checkers.Add("cluster-a", req, l)
+	status, ok = checkers.Target(req.Target)
+	require.True(t, ok)
+	assert.Equal(t, time.Minute, status.Request.Interval)
+	assert.Equal(t, []string{"cluster-a", "cluster-b"}, status.Owners)
+
+	// a conflicting request of another owner does not replace the request of the owner that sorts first
+	c := checkers.hostCheckers[req.Target]
+	other := req
+	other.Interval = 2 * time.Hour
+	for range 2 {
+		checkers.Add("cluster-b", other, l)
+		status, ok = checkers.Target(req.Target)
+		require.True(t, ok)
+		assert.Equal(t, time.Minute, status.Request.Interval)
+		assert.Same(t, c, checkers.hostCheckers[req.Target])
+	}
+
+	// removing the target for one owner keeps checking it for the other, with the other owner's request
+	checkers.Remove("cluster-a", req, l)
+	status, ok = checkers.Target(req.Target)
+	require.True(t, ok)
+	assert.Equal(t, []string{"cluster-b"}, status.Owners)
+	assert.Equal(t, 2*time.Hour, status.Request.Interval)
+
+	// reconciling without the target releases it
+	assert.Equal(t, handlers.ReconcileResult{Removed: 1}, checkers.Reconcile("cluster-b", nil, l))
+	_, ok = checkers.Target(req.Target)
+	assert.False(t, ok)
+	assert.NoError(t, testutil.CollectAndCompare(m, bytes.NewBufferString(``), "uptime_monitor_owner"))
+}
+
+func TestHostCheckers_ExpireLeases_Owners(t *testing.T) {
+	checkers := New(metrics.NewHostMetrics("", "", nil), nil)
+	l := slog.Default()
+	req := handlers.Request{Target: "example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+	checkers.Add("cluster-a", req, l)
+	checkers.Add("cluster-b", req, l)
+
+	checkers.lock.Lock()
+	checkers.hostCheckers[req.Target].owners["cluster-a"] = ownership{renewed: time.Now().Add(-time.Hour)}
+	checkers.lock.Unlock()
+
+	checkers.expire(time.Minute, l)
+	status, ok := checkers.Target(req.Target)
+	require.True(t, ok)
+	assert.Equal(t, []string{"cluster-b"}, status.Owners)
+}
+
+func TestHostCheckers_Metadata(t *testing.T) {
+	m := metrics.NewHostMetricsWithMetadata("uptime", "monitor", nil, []string{"team"})
+	checkers := New(m, nil)
+	l := slog.Default()
+	req := handlers.Request{
+		Target:     "example.com",
+		Method:     http.MethodGet,
+		ValidCodes: set.New(http.StatusOK),
+		Interval:   time.Hour,
+		Metadata:   map[string]string{"kind": "ingress", "namespace": "foo", "name": "bar", "team": "infra"},
+	}
+	checkers.Add("cluster", req, l)
+	c := checkers.hostCheckers[req.Target]
+	assert.Nil(t, c.GetRequest().Metadata)
+
+	assert.NoError(t, testutil.CollectAndCompare(m, bytes.NewBufferString(`
+# HELP uptime_monitor_info kubernetes metadata of the resource that exposes the site. join on host to route alerts
+# TYPE uptime_monitor_info gauge
+uptime_monitor_info{host="example.com",kind="ingress",name="bar",namespace="foo",owner="cluster",team="infra"} 1
+`), "uptime_monitor_info"))
+
+	// changing the metadata does not restart the check
+	req.Metadata = map[string]string{"kind": "ingress", "namespace": "foo", "name": "bar", "team": "web"}
+	checkers.Add("cluster", req, l)
+	assert.Equal(t, c, checkers.hostCheckers[req.Target])
+
+	assert.NoError(t, testutil.CollectAndCompare(m, bytes.NewBufferString(`
+# HELP uptime_monitor_info kubernetes metadata of the resource that exposes the site. join on host to route alerts
+# TYPE uptime_monitor_info gauge
+uptime_monitor_info{host="example.com",kind="ingress",name="bar",namespace="foo",owner="cluster",team="web"} 1
+`), "uptime_monitor_info"))
+}
+
+func TestHostCheckers_Alerts(t *testing.T) {
+	var alerts counter
+	checkers := New(metrics.NewHostMetrics("", "", nil), &http.Client{Transport: &stubTransport{}})
+	checkers.Alerts = &alerts
+	t.Cleanup(func() { checkers.scheduler.stop() })
+
+	req := handlers.Request{Target: "example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+	checkers.Add("agent", req, slog.Default())
+	assert.Eventually(t, func() bool { return alerts.count.Load() == 1 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,277 @@
+package hostcheckers
+
+import (
+	"container/heap"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default scheduler settings.
+const (
+	DefaultWorkers            = 64
+	DefaultMaxInFlightPerHost = 4
+)
+
+// scheduler runs the checks of all targets on a bounded pool of workers. Scheduled checks are kept in a min-heap,
+// ordered by the time of their next check. A check whose host already has maxPerHost checks in flight waits until
+// one of those checks is done.
+type scheduler struct {
+	workers    int
+	maxPerHost int
+	lock       sync.Mutex
+	queue      checkQueue
+	checks     map[*hostChecker]*scheduledCheck
+	inFlight   map[string]int
+	waiting    map[string][]*scheduledCheck
+	wake       chan struct{}
+	work       chan *scheduledCheck
+	done       chan struct{}
+	start      sync.Once
+	stopped    sync.Once
+}
+
+type scheduledCheck struct {
+	checker *hostChecker
+	host    string
+	next    time.Time
+	// index is the position of the check in the queue, or -1 if the check is not queued.
+	index   int
+	removed bool
+}
+
+func newScheduler(workers, maxPerHost int) *scheduler {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &scheduler{
+		workers:    workers,
+		maxPerHost: maxPerHost,
+		checks:     make(map[*hostChecker]*scheduledCheck),
+		inFlight:   make(map[string]int),
+		waiting:    make(map[string][]*scheduledCheck),
+		wake:       make(chan struct{}, 1),
+		work:       make(chan *scheduledCheck),
+		done:       make(chan struct{}),
+	}
+}
+
+// add schedules the first check of the target after delay.
+func (s *scheduler) add(c *hostChecker, delay time.Duration) {
+	s.start.Do(func() {
+		go s.dispatch()
+		for range s.workers {
+			go s.worker()
+		}
+	})
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	check := &scheduledCheck{checker: c, host: hostKey(c.req), next: time.Now().Add(delay)}
+	s.checks[c] = check
+	heap.Push(&s.queue, check)
+	s.notify()
+}
+
+// remove stops scheduling checks of the target. A check that is already running completes, but is not reported or
+// rescheduled.
+func (s *scheduler) remove(c *hostChecker) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	check, ok := s.checks[c]
+	if !ok {
+		return
+	}
+	delete(s.checks, c)
+	check.removed = true
+	if check.index >= 0 {
+		heap.Remove(&s.queue, check.index)
+	}
+	if waiting := s.waiting[check.host]; len(waiting) > 0 {
+		s.waiting[check.host] = deleteCheck(waiting, check)
+	}
+}
+
+// stop stops the workers. Running checks complete, but no new checks are started.
+func (s *scheduler) stop() {
+	s.stopped.Do(func() { close(s.done) })
+}
+
+func (s *scheduler) size() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.checks)
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands due checks to the workers. It blocks while all workers are busy.
+func (s *scheduler) dispatch() {
+	defer close(s.work)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.lock.Lock()
+		check, wait := s.due()
+		s.lock.Unlock()
+		if check != nil {
+			select {
+			case s.work <- check:
+			case <-s.done:
+				return
+			}
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-s.wake:
+		case <-timer.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// due returns the next check to run. If no check is due, it returns the time until the next check is due.
+func (s *scheduler) due() (*scheduledCheck, time.Duration) {
+	for s.queue.Len() > 0 {
+		if wait := time.Until(s.queue[0].next); wait > 0 {
+			return nil, wait
+		}
+		check := heap.Pop(&s.queue).(*scheduledCheck)
+		if s.maxPerHost > 0 && s.inFlight[check.host] >= s.maxPerHost {
+			s.waiting[check.host] = append(s.waiting[check.host], check)
+			continue
+		}
+		s.inFlight[check.host]++
+		return check, 0
+	}
+	return nil, time.Hour
+}
+
+func (s *scheduler) worker() {
+	for check := range s.work {
+		s.lock.Lock()
+		removed := check.removed
+		s.lock.Unlock()
+		if !removed {
+			m := check.checker.check(check.checker.req.Interval)
+			// don't report targets that were removed while they were being checked. Reporting while holding the
+			// lock means that, once remove returns, the target is no longer reported, so its metrics can be removed.
+			s.lock.Lock()
+			if !check.removed {
+				check.checker.metrics.Observe(m)
+			}
+			s.lock.Unlock()
+		}
+		s.finish(check)
+	}
+}
+
+// finish reschedules the check and releases the first check waiting for the same host.
+func (s *scheduler) finish(check *scheduledCheck) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.inFlight[check.host]--; s.inFlight[check.host] <= 0 {
+		delete(s.inFlight, check.host)
+	}
+	if waiting := s.waiting[check.host]; len(waiting) > 0 {
+		heap.Push(&s.queue, waiting[0])
+		if s.waiting[check.host] = waiting[1:]; len(s.waiting[check.host]) == 0 {
+			delete(s.waiting, check.host)
+		}
+	}
+	if !check.removed {
+		check.next = check.checker.next()
+		heap.Push(&s.queue, check)
+	}
+	s.notify()
+}
+
+func deleteCheck(checks []*scheduledCheck, check *scheduledCheck) []*scheduledCheck {
+	for i := range checks {
+		if checks[i] == check {
+			return append(checks[:i], checks[i+1:]...)
+		}
+	}
+	return checks
+}
+
+// startDelay returns a random delay before the first check of a target, so targets registered at the same time
+// (e.g. after a restart) are not all checked at once. The delay is less than both maxJitter and the interval.
+func startDelay(maxJitter, interval time.Duration) time.Duration {
+	if interval > 0 {
+		maxJitter = min(maxJitter, interval)
+	}
+	if maxJitter <= 0 {
+		return 0
+	}
+	return rand.N(maxJitter)
+}
+
+// hostKey returns the host that the request probes. It limits the number of concurrent checks of the same host.
+func hostKey(req handlers.Request) string {
+	switch req.Type {
+	case handlers.ProbeTCP:
+		if host, _, err := net.SplitHostPort(req.Target); err == nil {
+			return host
+		}
+	case handlers.ProbeDNS:
+		if req.Resolver != "" {
+			return req.Resolver
+		}
+	default:
+		target := req.Target
+		if !strings.HasPrefix(target, "https://") && !strings.HasPrefix(target, "http://") {
+			target = "https://" + target
+		}
+		if u, err := url.Parse(target); err == nil {
+			return u.Hostname()
+		}
+	}
+	return req.Target
+}
+
+// checkQueue implements heap.Interface. The check that is due first is at the top of the heap.
+type checkQueue []*scheduledCheck
+
+func (q checkQueue) Len() int { return len(q) }
+
+func (q checkQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q checkQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *checkQueue) Push(x any) {
+	check := x.(*scheduledCheck)
+	check.index = len(*q)
+	*q = append(*q, check)
+}
+
+func (q *checkQueue) Pop() any {
+	old := *q
+	n := len(old)
+	check := old[n-1]
+	old[n-1] = nil
+	check.index = -1
+	*q = old[:n-1]
+	return check
+}
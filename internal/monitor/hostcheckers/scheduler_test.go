@@ -0,0 +1,214 @@
+package hostcheckers
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Concurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		workers     int
+		maxPerHost  int
+		hosts       int
+		wantMaximum int
+	}{
+		{name: "workers", workers: 3, hosts: 10, wantMaximum: 3},
+		{name: "per host", workers: 10, maxPerHost: 2, hosts: 1, wantMaximum: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			transport := stubTransport{delay: 20 * time.Millisecond}
+			client := &http.Client{Transport: &transport}
+			s := newScheduler(tt.workers, tt.maxPerHost)
+			t.Cleanup(s.stop)
+			var o counter
+			for i := range 10 {
+				target := fmt.Sprintf("https://host-%d.example.com/%d", i%tt.hosts, i)
+				s.add(newHostChecker(handlers.Request{Target: target, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}, &o, client, slog.Default()), 0)
+			}
+
+			assert.Eventually(t, func() bool { return o.count.Load() == 10 }, 5*time.Second, 10*time.Millisecond)
+			assert.Equal(t, int64(tt.wantMaximum), transport.maximum.Load())
+		})
+	}
+}
+
+func TestScheduler_Remove(t *testing.T) {
+	var o counter
+	h := newHostChecker(handlers.Request{Target: "https://example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: 10 * time.Millisecond}, &o, &http.Client{Transport: &stubTransport{}}, slog.Default())
+	s := newScheduler(1, 0)
+	t.Cleanup(s.stop)
+	s.add(h, 0)
+	assert.Eventually(t, func() bool { return o.count.Load() > 1 }, time.Second, 10*time.Millisecond)
+
+	s.remove(h)
+	assert.Zero(t, s.size())
+	// allow a running check to complete
+	time.Sleep(20 * time.Millisecond)
+	count := o.count.Load()
+	assert.Never(t, func() bool { return o.count.Load() != count }, 100*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestScheduler_Remove_Observing(t *testing.T) {
+	o := blockingObserver{observing: make(chan struct{}), release: make(chan struct{})}
+	h := newHostChecker(handlers.Request{Target: "https://example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}, &o, &http.Client{Transport: &stubTransport{}}, slog.Default())
+	s := newScheduler(1, 0)
+	t.Cleanup(s.stop)
+	s.add(h, 0)
+	<-o.observing
+
+	// remove waits for the check being reported, so no measurements are reported once it returns
+	var removed atomic.Bool
+	go func() {
+		s.remove(h)
+		removed.Store(true)
+	}()
+	assert.Never(t, removed.Load, 50*time.Millisecond, 10*time.Millisecond)
+	close(o.release)
+	assert.Eventually(t, removed.Load, time.Second, 10*time.Millisecond)
+}
+
+func TestScheduler_Delay(t *testing.T) {
+	var o counter
+	h := newHostChecker(handlers.Request{Target: "https://example.com", Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}, &o, &http.Client{Transport: &stubTransport{}}, slog.Default())
+	s := newScheduler(1, 0)
+	t.Cleanup(s.stop)
+	s.add(h, 200*time.Millisecond)
+	assert.Never(t, func() bool { return o.count.Load() > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return o.count.Load() > 0 }, time.Second, 10*time.Millisecond)
+	s.remove(h)
+}
+
+func TestCheckQueue(t *testing.T) {
+	now := time.Now()
+	var q checkQueue
+	checks := make([]*scheduledCheck, 5)
+	for i, offset := range []int{3, 1, 4, 0, 2} {
+		checks[i] = &scheduledCheck{next: now.Add(time.Duration(offset) * time.Second)}
+		heap.Push(&q, checks[i])
+	}
+	// remove the check due at +1s
+	heap.Remove(&q, checks[1].index)
+	assert.Equal(t, -1, checks[1].index)
+
+	var got []time.Duration
+	for q.Len() > 0 {
+		got = append(got, heap.Pop(&q).(*scheduledCheck).next.Sub(now))
+	}
+	assert.Equal(t, []time.Duration{0, 2 * time.Second, 3 * time.Second, 4 * time.Second}, got)
+}
+
+func TestStartDelay(t *testing.T) {
+	assert.Zero(t, startDelay(0, time.Minute))
+	for range 100 {
+		assert.Less(t, startDelay(time.Minute, time.Second), time.Second)
+		assert.Less(t, startDelay(time.Second, time.Minute), time.Second)
+		assert.Less(t, startDelay(time.Second, 0), time.Second)
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	tests := []struct {
+		name string
+		req  handlers.Request
+		want string
+	}{
+		{name: "url", req: handlers.Request{Target: "https://example.com:8443/health"}, want: "example.com"},
+		{name: "host", req: handlers.Request{Target: "example.com/health"}, want: "example.com"},
+		{name: "tcp", req: handlers.Request{Target: "example.com:1883", Type: handlers.ProbeTCP}, want: "example.com"},
+		{name: "dns", req: handlers.Request{Target: "example.com", Type: handlers.ProbeDNS, Resolver: "1.1.1.1:53"}, want: "1.1.1.1:53"},
+		{name: "dns default resolver", req: handlers.Request{Target: "example.com", Type: handlers.ProbeDNS}, want: "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, hostKey(tt.req))
+		})
+	}
+}
+
+// BenchmarkScheduler checks 10k targets once, spread over 1k hosts.
+func BenchmarkScheduler(b *testing.B) {
+	const targets = 10_000
+	client := &http.Client{Transport: &stubTransport{delay: time.Millisecond}}
+	for range b.N {
+		var o counter
+		s := newScheduler(DefaultWorkers, DefaultMaxInFlightPerHost)
+		checkers := make([]*hostChecker, targets)
+		for i := range checkers {
+			req := handlers.Request{Target: fmt.Sprintf("https://host-%d.example.com/%d", i%1000, i), Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}
+			checkers[i] = newHostChecker(req, &o, client, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			s.add(checkers[i], 0)
+		}
+		for o.count.Load() < targets {
+			time.Sleep(time.Millisecond)
+		}
+		b.ReportMetric(float64(runtime.NumGoroutine()), "goroutines")
+		s.stop()
+	}
+}
+
+var _ Observer = &counter{}
+
+type counter struct {
+	count atomic.Int64
+}
+
+func (c *counter) Observe(_ metrics.Measurement) {
+	c.count.Add(1)
+}
+
+var _ Observer = &blockingObserver{}
+
+// blockingObserver signals observing when a measurement is reported and blocks until release is closed.
+type blockingObserver struct {
+	observing chan struct{}
+	release   chan struct{}
+}
+
+func (b *blockingObserver) Observe(_ metrics.Measurement) {
+	b.observing <- struct{}{}
+	<-b.release
+}
+
+var _ http.RoundTripper = &stubTransport{}
+
+// stubTransport answers every request with 200 OK after delay and records the maximum number of concurrent requests.
+type stubTransport struct {
+	delay   time.Duration
+	current atomic.Int64
+	maximum atomic.Int64
+	lock    sync.Mutex
+}
+
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	current := s.current.Add(1)
+	defer s.current.Add(-1)
+	s.lock.Lock()
+	if current > s.maximum.Load() {
+		s.maximum.Store(current)
+	}
+	s.lock.Unlock()
+	time.Sleep(s.delay)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
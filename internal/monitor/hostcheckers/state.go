@@ -0,0 +1,57 @@
+package hostcheckers
+
+import "time"
+
+// targetState dampens the raw result of each check: a target only goes down after failureThreshold consecutive
+// failures and only comes back up after successThreshold consecutive successes. A new target is treated as up, but
+// its state is only known after its first success or once it goes down, so a target that is down when it is added
+// is notified once it reaches the failure threshold.
+type targetState struct {
+	failureThreshold int
+	successThreshold int
+	known            bool
+	up               bool
+	failures         int
+	successes        int
+	lastChange       time.Time
+}
+
+func newTargetState(failureThreshold, successThreshold int) targetState {
+	return targetState{
+		failureThreshold: max(failureThreshold, 1),
+		successThreshold: max(successThreshold, 1),
+		up:               true,
+	}
+}
+
+// update records the result of a check and returns true if the state changed.
+func (s *targetState) update(up bool) bool {
+	if up {
+		s.successes++
+		s.failures = 0
+	} else {
+		s.failures++
+		s.successes = 0
+	}
+	switch {
+	case s.up && s.failures >= s.failureThreshold:
+		s.up = false
+	case !s.up && s.successes >= s.successThreshold:
+		s.up = true
+	default:
+		if up && !s.known {
+			s.known = true
+			s.lastChange = time.Now()
+		}
+		return false
+	}
+	s.known = true
+	s.lastChange = time.Now()
+	return true
+}
+
+// recheck returns true if the target should be checked again right away: it failed for the first time, but has not
+// reached the failure threshold yet.
+func (s *targetState) recheck() bool {
+	return s.up && s.failures == 1 && s.failureThreshold > 1
+}
@@ -0,0 +1,267 @@
+package hostcheckers
+
+import (
+	"context"
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/maintenance"
+	"github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/clambin/uptime/internal/monitor/notifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTargetState_update(t *testing.T) {
+	tests := []struct {
+		name            string
+		failures        int
+		successes       int
+		checks          []bool
+		wantUp          []bool
+		wantKnown       []bool
+		wantTransitions []bool
+		wantRecheck     []bool
+	}{
+		{
+			name:            "no thresholds",
+			checks:          []bool{true, false, true, false},
+			wantUp:          []bool{true, false, true, false},
+			wantTransitions: []bool{false, true, true, true},
+			wantRecheck:     []bool{false, false, false, false},
+		},
+		{
+			name:            "failure threshold",
+			failures:        3,
+			checks:          []bool{true, false, false, true, false, false, false, true},
+			wantUp:          []bool{true, true, true, true, true, true, false, true},
+			wantTransitions: []bool{false, false, false, false, false, false, true, true},
+			wantRecheck:     []bool{false, true, false, false, true, false, false, false},
+		},
+		{
+			name:            "new target down",
+			failures:        3,
+			checks:          []bool{false, false, false, true},
+			wantUp:          []bool{true, true, false, true},
+			wantKnown:       []bool{false, false, true, true},
+			wantTransitions: []bool{false, false, true, true},
+			wantRecheck:     []bool{true, false, false, false},
+		},
+		{
+			name:            "success threshold",
+			successes:       2,
+			checks:          []bool{false, true, false, true, true, true},
+			wantUp:          []bool{false, false, false, false, true, true},
+			wantTransitions: []bool{true, false, false, false, true, false},
+			wantRecheck:     []bool{false, false, false, false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := newTargetState(tt.failures, tt.successes)
+			for i, check := range tt.checks {
+				assert.Equal(t, tt.wantTransitions[i], s.update(check), i)
+				assert.Equal(t, tt.wantUp[i], s.up, i)
+				assert.Equal(t, tt.wantRecheck[i], s.recheck(), i)
+				if tt.wantKnown != nil {
+					assert.Equal(t, tt.wantKnown[i], s.known, i)
+				}
+			}
+		})
+	}
+}
+
+func TestHostChecker_Recheck(t *testing.T) {
+	var lock sync.Mutex
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		// first check succeeds, all others fail
+		if calls > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	var o recorder
+	const interval = 500 * time.Millisecond
+	h := newHostChecker(handlers.Request{
+		Target:           s.URL,
+		Method:           http.MethodGet,
+		ValidCodes:       set.New(http.StatusOK),
+		Interval:         interval,
+		FailureThreshold: 2,
+	}, &o, s.Client(), slog.Default())
+	h.recheckDelay = 10 * time.Millisecond
+	sched := newScheduler(1, 0)
+	sched.add(h, 0)
+
+	assert.Eventually(t, func() bool { return len(o.results()) >= 3 }, 2*time.Second, 10*time.Millisecond)
+	sched.remove(h)
+
+	measurements, timestamps := o.results(), o.times()
+	// the first failure is checked again immediately, so the target goes down without waiting for the interval
+	assert.GreaterOrEqual(t, timestamps[1].Sub(timestamps[0]), interval)
+	assert.Less(t, timestamps[2].Sub(timestamps[1]), interval)
+	assert.True(t, measurements[0].Up)
+	assert.False(t, measurements[0].Transition)
+	assert.True(t, measurements[1].Up)
+	assert.Equal(t, reasonStatusCode, measurements[1].Reason)
+	assert.False(t, measurements[2].Up)
+	assert.True(t, measurements[2].Transition)
+}
+
+func TestHostChecker_Downtime(t *testing.T) {
+	var up atomic.Bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	h := newHostChecker(handlers.Request{Target: s.URL, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}, &recorder{}, s.Client(), slog.Default())
+	up.Store(true)
+	assert.Zero(t, h.check(time.Hour).Downtime)
+	up.Store(false)
+	m := h.check(time.Hour)
+	assert.True(t, m.Transition)
+	assert.Zero(t, m.Downtime)
+
+	time.Sleep(20 * time.Millisecond)
+	up.Store(true)
+	m = h.check(time.Hour)
+	assert.True(t, m.Transition)
+	assert.GreaterOrEqual(t, m.Downtime, 20*time.Millisecond)
+
+	incidents := h.statusTarget().Incidents
+	require.Len(t, incidents, 1)
+	assert.Equal(t, reasonStatusCode, incidents[0].Reason)
+	assert.False(t, incidents[0].End.IsZero())
+}
+
+func TestHostChecker_Maintenance(t *testing.T) {
+	var up atomic.Bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	h := newHostChecker(handlers.Request{Target: s.URL, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}, &recorder{}, s.Client(), slog.Default())
+	h.maintenance = maintenance.New()
+	up.Store(true)
+	assert.True(t, h.check(time.Hour).Up)
+
+	// during maintenance, the target keeps its state and its uptime is not updated
+	require.NoError(t, h.maintenance.Set(handlers.MaintenanceWindow{ID: "test", Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)}))
+	up.Store(false)
+	m := h.check(time.Hour)
+	assert.True(t, m.Maintenance)
+	assert.True(t, m.Up)
+	assert.False(t, m.Transition)
+	assert.Empty(t, m.Reason)
+	require.Len(t, m.Uptime, 3)
+	assert.Equal(t, 1, m.Uptime[0].Checks)
+	status := h.status()
+	assert.True(t, status.Maintenance)
+	assert.True(t, status.LastCheck.Maintenance)
+	assert.False(t, status.LastCheck.Up)
+
+	// after maintenance, the target goes down
+	h.maintenance.Delete("test")
+	m = h.check(time.Hour)
+	assert.False(t, m.Maintenance)
+	assert.False(t, m.Up)
+	assert.True(t, m.Transition)
+	assert.Equal(t, 2, m.Uptime[0].Checks)
+}
+
+func TestHostChecker_StartsDown_Alerts(t *testing.T) {
+	var up atomic.Bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	var n notifications
+	alerter := notifier.NewAlerter(slog.Default(), &n)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go alerter.Run(ctx)
+
+	h := newHostChecker(handlers.Request{Target: s.URL, Method: http.MethodGet, ValidCodes: set.New(http.StatusOK), Interval: time.Hour}, alerter, s.Client(), slog.Default())
+
+	// a target that is down when it is first checked is notified once it reaches the failure threshold
+	alerter.Observe(h.check(time.Hour))
+	assert.Eventually(t, func() bool { return len(n.received()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, notifier.EventDown, n.received()[0].Type)
+	assert.Equal(t, reasonStatusCode, n.received()[0].Reason)
+
+	alerter.Observe(h.check(time.Hour))
+	time.Sleep(20 * time.Millisecond)
+	up.Store(true)
+	alerter.Observe(h.check(time.Hour))
+	assert.Eventually(t, func() bool { return len(n.received()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, notifier.EventUp, n.received()[1].Type)
+	assert.GreaterOrEqual(t, n.received()[1].Downtime, 20*time.Millisecond)
+}
+
+var _ notifier.Notifier = &notifications{}
+
+// notifications records the events sent by an Alerter.
+type notifications struct {
+	lock   sync.Mutex
+	events []notifier.Event
+}
+
+func (n *notifications) Notify(_ context.Context, event notifier.Event) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+func (n *notifications) received() []notifier.Event {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return append([]notifier.Event(nil), n.events...)
+}
+
+type recorder struct {
+	measurements []metrics.Measurement
+	timestamps   []time.Time
+	lock         sync.Mutex
+}
+
+func (r *recorder) Observe(measurement metrics.Measurement) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.measurements = append(r.measurements, measurement)
+	r.timestamps = append(r.timestamps, time.Now())
+}
+
+func (r *recorder) times() []time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]time.Time(nil), r.timestamps...)
+}
+
+func (r *recorder) results() []metrics.Measurement {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]metrics.Measurement(nil), r.measurements...)
+}
@@ -0,0 +1,69 @@
+package hostcheckers
+
+import (
+	"bytes"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/metrics"
+	"net"
+	"time"
+)
+
+const maxBannerSize = 4096
+
+// probeTCP connects to the target. If the request has a Send string, it is written once the connection is
+// established. If the request has an Expect string, the target is only up if it replies with a banner that
+// contains the Expect string.
+func (h *hostChecker) probeTCP() metrics.Measurement {
+	m := metrics.Measurement{Host: h.req.Target, Type: handlers.ProbeTCP}
+
+	timeout := h.timeout()
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", h.req.Target, timeout)
+	if err != nil {
+		h.logger.Debug("measurement failed", "err", err)
+		m.Reason = reasonConnectionFailed
+		return m
+	}
+	defer func() { _ = conn.Close() }()
+	m.Latency = time.Since(start)
+	m.Up = true
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if h.req.Send != "" {
+		if _, err = conn.Write([]byte(h.req.Send)); err != nil {
+			h.logger.Debug("measurement failed: send", "err", err)
+			m.Up = false
+			m.Reason = reasonConnectionFailed
+			return m
+		}
+	}
+	if h.req.Expect != "" {
+		m.ExpectsBanner = true
+		m.BannerMatch = readBanner(conn, []byte(h.req.Expect))
+		m.Up = m.BannerMatch
+		if !m.BannerMatch {
+			m.Reason = reasonBannerMismatch
+		}
+	}
+
+	h.logger.Debug("measurement made", "up", m.Up, "latency", m.Latency)
+	return m
+}
+
+// readBanner reads from the connection until the response contains expect, the connection is closed or times out,
+// or maxBannerSize bytes have been read.
+func readBanner(conn net.Conn, expect []byte) bool {
+	var banner []byte
+	buf := make([]byte, 512)
+	for len(banner) < maxBannerSize {
+		n, err := conn.Read(buf)
+		banner = append(banner, buf[:n]...)
+		if bytes.Contains(banner, expect) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package hostcheckers
+
+import (
+	"bufio"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestHostChecker_probeTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go serveTCP(l)
+
+	tests := []struct {
+		name          string
+		target        string
+		send          string
+		expect        string
+		wantUp        assert.BoolAssertionFunc
+		wantExpects   assert.BoolAssertionFunc
+		wantConnected bool
+	}{
+		{
+			name:          "connect",
+			target:        l.Addr().String(),
+			wantUp:        assert.True,
+			wantExpects:   assert.False,
+			wantConnected: true,
+		},
+		{
+			name:          "banner",
+			target:        l.Addr().String(),
+			expect:        "READY",
+			wantUp:        assert.True,
+			wantExpects:   assert.True,
+			wantConnected: true,
+		},
+		{
+			name:          "send/expect",
+			target:        l.Addr().String(),
+			send:          "PING\n",
+			expect:        "PONG",
+			wantUp:        assert.True,
+			wantExpects:   assert.True,
+			wantConnected: true,
+		},
+		{
+			name:          "banner mismatch",
+			target:        l.Addr().String(),
+			send:          "QUIT\n",
+			expect:        "PONG",
+			wantUp:        assert.False,
+			wantExpects:   assert.True,
+			wantConnected: true,
+		},
+		{
+			name:        "refused",
+			target:      "127.0.0.1:1",
+			wantUp:      assert.False,
+			wantExpects: assert.False,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := handlers.Request{Target: tt.target, Type: handlers.ProbeTCP, Send: tt.send, Expect: tt.expect}
+			h := newHostChecker(r, nil, &http.Client{}, slog.Default())
+			m := h.probe()
+			assert.Equal(t, handlers.ProbeTCP, m.Type)
+			tt.wantUp(t, m.Up)
+			tt.wantExpects(t, m.ExpectsBanner)
+			assert.Equal(t, tt.wantConnected, m.Latency > 0)
+		})
+	}
+}
+
+// serveTCP greets each client with a banner, replies to PING and closes the connection on any other command.
+func serveTCP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer func() { _ = conn.Close() }()
+			_, _ = conn.Write([]byte("READY\n"))
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				if scanner.Text() != "PING" {
+					return
+				}
+				_, _ = conn.Write([]byte("PONG\n"))
+			}
+		}(conn)
+	}
+}
@@ -0,0 +1,82 @@
+package hostcheckers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/clambin/uptime/internal/monitor/metrics"
+	"net/http"
+	"time"
+)
+
+// Reasons why a certificate chain does not verify.
+const (
+	verifyErrorExpired          = "expired"
+	verifyErrorUnknownAuthority = "unknown authority"
+	verifyErrorHostname         = "hostname mismatch"
+	verifyErrorInvalid          = "invalid"
+)
+
+// inspectTLS inspects the certificate chain presented by the server. The chain is verified against roots (or the
+// system roots if roots is nil), regardless of how the connection was verified.
+func inspectTLS(certificates []*x509.Certificate, state *tls.ConnectionState, hostname string, roots *x509.CertPool) metrics.TLSInfo {
+	leaf := certificates[0]
+	info := metrics.TLSInfo{
+		ChainExpiry:      time.Until(leaf.NotAfter),
+		Subject:          leaf.Subject.String(),
+		Issuer:           leaf.Issuer.String(),
+		Serial:           leaf.SerialNumber.String(),
+		HostnameMismatch: leaf.VerifyHostname(hostname) != nil,
+		SelfSigned:       isSelfSigned(leaf),
+	}
+	if state != nil {
+		info.Version = tls.VersionName(state.Version)
+		info.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+		if expiry := time.Until(certificate.NotAfter); expiry < info.ChainExpiry {
+			info.ChainExpiry = expiry
+		}
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       hostname,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	info.VerifyError = verifyError(err)
+	return info
+}
+
+func isSelfSigned(certificate *x509.Certificate) bool {
+	return certificate.Subject.String() == certificate.Issuer.String() && certificate.CheckSignatureFrom(certificate) == nil
+}
+
+func verifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired {
+		return verifyErrorExpired
+	}
+	var authorityErr x509.UnknownAuthorityError
+	if errors.As(err, &authorityErr) {
+		return verifyErrorUnknownAuthority
+	}
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return verifyErrorHostname
+	}
+	return verifyErrorInvalid
+}
+
+// rootCAs returns the trusted roots configured in the client's transport, or nil to use the system roots.
+func rootCAs(c *http.Client) *x509.CertPool {
+	if t, ok := c.Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		return t.TLSClientConfig.RootCAs
+	}
+	return nil
+}
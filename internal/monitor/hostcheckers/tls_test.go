@@ -0,0 +1,154 @@
+package hostcheckers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostChecker_probeHTTP_TLS(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(s.Close)
+
+	relaxed := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	wrongName := s.Client()
+	wrongName.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+
+	tests := []struct {
+		name            string
+		client          *http.Client
+		target          string
+		wantUp          assert.BoolAssertionFunc
+		wantReason      string
+		wantMismatch    assert.BoolAssertionFunc
+		wantVerifyError string
+	}{
+		{
+			name:         "valid",
+			client:       s.Client(),
+			target:       s.URL,
+			wantUp:       assert.True,
+			wantMismatch: assert.False,
+		},
+		{
+			name:            "relaxed verification",
+			client:          relaxed,
+			target:          s.URL,
+			wantUp:          assert.True,
+			wantMismatch:    assert.False,
+			wantVerifyError: verifyErrorUnknownAuthority,
+		},
+		{
+			name:            "verification fails",
+			client:          &http.Client{},
+			target:          s.URL,
+			wantUp:          assert.False,
+			wantReason:      reasonCertificateInvalid,
+			wantMismatch:    assert.False,
+			wantVerifyError: verifyErrorUnknownAuthority,
+		},
+		{
+			name:            "hostname mismatch",
+			client:          wrongName,
+			target:          strings.Replace(s.URL, "127.0.0.1", "localhost", 1),
+			wantUp:          assert.True,
+			wantMismatch:    assert.True,
+			wantVerifyError: verifyErrorHostname,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newHostChecker(handlers.Request{
+				Target:     tt.target,
+				Method:     http.MethodGet,
+				ValidCodes: set.New(http.StatusOK),
+			}, nil, tt.client, slog.Default())
+
+			m := h.probe()
+			tt.wantUp(t, m.Up)
+			assert.Equal(t, tt.wantReason, m.Reason)
+			assert.True(t, m.IsTLS)
+			assert.True(t, m.TLS.SelfSigned)
+			assert.Equal(t, "O=Acme Co", m.TLS.Subject)
+			tt.wantMismatch(t, m.TLS.HostnameMismatch)
+			assert.Equal(t, tt.wantVerifyError, m.TLS.VerifyError)
+			if m.Up {
+				assert.NotEmpty(t, m.TLS.Version)
+				assert.NotEmpty(t, m.TLS.CipherSuite)
+			}
+		})
+	}
+}
+
+func TestInspectTLS(t *testing.T) {
+	now := time.Now()
+	ca, caKey := makeCertificate(t, "CA", now.Add(24*time.Hour), nil, nil)
+	leaf, _ := makeCertificate(t, "example.com", now.Add(48*time.Hour), ca, caKey)
+	expired, _ := makeCertificate(t, "example.com", now.Add(-time.Hour), ca, caKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	info := inspectTLS([]*x509.Certificate{leaf, ca}, nil, "example.com", roots)
+	assert.Equal(t, "CN=example.com", info.Subject)
+	assert.Equal(t, "CN=CA", info.Issuer)
+	assert.Equal(t, "2", info.Serial)
+	assert.False(t, info.SelfSigned)
+	assert.False(t, info.HostnameMismatch)
+	assert.Empty(t, info.VerifyError)
+	// the CA expires before the leaf certificate
+	assert.Less(t, info.ChainExpiry, 25*time.Hour)
+
+	info = inspectTLS([]*x509.Certificate{expired, ca}, nil, "example.com", roots)
+	assert.Equal(t, verifyErrorExpired, info.VerifyError)
+	assert.Negative(t, info.ChainExpiry)
+
+	info = inspectTLS([]*x509.Certificate{leaf, ca}, nil, "example.com", x509.NewCertPool())
+	assert.Equal(t, verifyErrorUnknownAuthority, info.VerifyError)
+}
+
+func makeCertificate(t *testing.T, name string, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notAfter.Add(-72 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.SerialNumber = big.NewInt(1)
+		parent, parentKey = &template, key
+	} else {
+		template.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certificate, key
+}
@@ -0,0 +1,67 @@
+package hostcheckers
+
+import (
+	"crypto/tls"
+	"github.com/clambin/uptime/internal/monitor/metrics"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// phaseTimer records the duration of each phase of an HTTP request. DNS, connect and TLS are only recorded when a new
+// connection is established.
+type phaseTimer struct {
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	phases       metrics.Phases
+	lock         sync.Mutex
+}
+
+func (p *phaseTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { p.mark(&p.dnsStart) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			p.record(&p.phases.DNS, &p.dnsStart)
+		},
+		ConnectStart: func(string, string) { p.mark(&p.connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				p.record(&p.phases.Connect, &p.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { p.mark(&p.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.record(&p.phases.TLS, &p.tlsStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { p.mark(&p.wroteRequest) },
+		GotFirstResponseByte: func() {
+			p.mark(&p.firstByte)
+			p.record(&p.phases.TTFB, &p.wroteRequest)
+		},
+	}
+}
+
+// done records the transfer phase, i.e. the time from the first response byte until the body has been read.
+func (p *phaseTimer) done() metrics.Phases {
+	p.record(&p.phases.Transfer, &p.firstByte)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.phases
+}
+
+func (p *phaseTimer) mark(t *time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	*t = time.Now()
+}
+
+func (p *phaseTimer) record(d *time.Duration, start *time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !start.IsZero() {
+		*d = time.Since(*start)
+	}
+}
@@ -0,0 +1,50 @@
+package hostcheckers
+
+import (
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostChecker_probeHTTP_Phases(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	// use a hostname so the request includes a dns lookup. the test certificate is valid for example.com.
+	c := s.Client()
+	c.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+	h := newHostChecker(handlers.Request{
+		Target:     strings.Replace(s.URL, "127.0.0.1", "localhost", 1),
+		Method:     http.MethodGet,
+		ValidCodes: set.New(http.StatusOK),
+	}, nil, c, slog.Default())
+
+	// first request sets up a new connection
+	m := h.probe()
+	assert.True(t, m.Up)
+	assert.NotZero(t, m.Phases.DNS)
+	assert.NotZero(t, m.Phases.Connect)
+	assert.NotZero(t, m.Phases.TLS)
+	assert.GreaterOrEqual(t, m.Phases.TTFB, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, m.Phases.Transfer, 10*time.Millisecond)
+
+	// second request reuses the connection
+	m = h.probe()
+	assert.True(t, m.Up)
+	assert.Zero(t, m.Phases.DNS)
+	assert.Zero(t, m.Phases.Connect)
+	assert.Zero(t, m.Phases.TLS)
+	assert.NotZero(t, m.Phases.TTFB)
+}
@@ -0,0 +1,156 @@
+package hostcheckers
+
+import (
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/status"
+	"sync"
+	"time"
+)
+
+// DefaultSLO is the target uptime ratio of targets that do not set their own SLO.
+const DefaultSLO = 0.999
+
+// uptimeWindows are the rolling windows over which the uptime of a target is reported.
+var uptimeWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{name: "24h", duration: 24 * time.Hour},
+	{name: "7d", duration: 7 * 24 * time.Hour},
+	{name: "30d", duration: 30 * 24 * time.Hour},
+}
+
+// bucketSize is the resolution of the history. Windows include the current, partial bucket, so a window may cover
+// up to one bucket more than its duration.
+const bucketSize = time.Hour
+
+// maxIncidents is the number of incidents kept per target.
+const maxIncidents = 20
+
+// history aggregates the checks of a target per bucket, for as long as the longest uptime window, and per day,
+// for status.Days days. It also records the recent incidents of the target. The history of a target is kept when
+// its request changes, so it has its own lock. The history is only kept in memory: the TargetStore does not persist
+// it, so the uptime windows, days and incidents of a target start over when the monitor restarts.
+type history struct {
+	lock      sync.Mutex
+	buckets   []bucket
+	days      []bucket
+	incidents []status.Incident
+}
+
+type bucket struct {
+	start     time.Time
+	checks    int
+	up        int
+	latency   time.Duration
+	latencies int
+}
+
+// record adds a check to the history. Latency is ignored if it is zero, e.g. if the target could not be reached.
+func (h *history) record(t time.Time, up bool, latency time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.buckets = addCheck(h.buckets, t.Truncate(bucketSize), up, latency)
+	h.buckets = trim(h.buckets, t.Add(-uptimeWindows[len(uptimeWindows)-1].duration).Truncate(bucketSize))
+	h.days = addCheck(h.days, t.Truncate(24*time.Hour), up, latency)
+	h.days = trim(h.days, t.Truncate(24*time.Hour).AddDate(0, 0, 1-status.Days))
+}
+
+// addCheck adds a check to the bucket starting at start, appending the bucket if it does not exist yet.
+func addCheck(buckets []bucket, start time.Time, up bool, latency time.Duration) []bucket {
+	if n := len(buckets); n == 0 || buckets[n-1].start.Before(start) {
+		buckets = append(buckets, bucket{start: start})
+	}
+	b := &buckets[len(buckets)-1]
+	b.checks++
+	if up {
+		b.up++
+	}
+	if latency > 0 {
+		b.latency += latency
+		b.latencies++
+	}
+	return buckets
+}
+
+// trim drops the buckets that start before oldest.
+func trim(buckets []bucket, oldest time.Time) []bucket {
+	var drop int
+	for drop < len(buckets) && buckets[drop].start.Before(oldest) {
+		drop++
+	}
+	if drop > 0 {
+		buckets = append(buckets[:0], buckets[drop:]...)
+	}
+	return buckets
+}
+
+// down records the start of an incident.
+func (h *history) down(t time.Time, reason string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.incidents = append(h.incidents, status.Incident{Start: t, Reason: reason})
+	if len(h.incidents) > maxIncidents {
+		h.incidents = append(h.incidents[:0], h.incidents[len(h.incidents)-maxIncidents:]...)
+	}
+}
+
+// up records the end of the current incident.
+func (h *history) up(t time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if n := len(h.incidents); n > 0 && h.incidents[n-1].End.IsZero() {
+		h.incidents[n-1].End = t
+	}
+}
+
+// status returns the checks per day and the incidents of the last status.Days days.
+func (h *history) status(now time.Time) ([]status.Day, []status.Incident) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	oldest := now.Truncate(24*time.Hour).AddDate(0, 0, 1-status.Days)
+	var days []status.Day
+	for _, day := range h.days {
+		if !day.start.Before(oldest) {
+			days = append(days, status.Day{Date: day.start.UTC(), Checks: day.checks, Up: day.up})
+		}
+	}
+	var incidents []status.Incident
+	for _, incident := range h.incidents {
+		if incident.End.IsZero() || !incident.End.Before(oldest) {
+			incidents = append(incidents, incident)
+		}
+	}
+	return days, incidents
+}
+
+// uptime reports the uptime of each window that holds at least one check.
+func (h *history) uptime(now time.Time, slo float64) []handlers.Uptime {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var windows []handlers.Uptime
+	for _, window := range uptimeWindows {
+		oldest := now.Add(-window.duration).Truncate(bucketSize)
+		var total bucket
+		for i := len(h.buckets) - 1; i >= 0 && !h.buckets[i].start.Before(oldest); i-- {
+			total.checks += h.buckets[i].checks
+			total.up += h.buckets[i].up
+			total.latency += h.buckets[i].latency
+			total.latencies += h.buckets[i].latencies
+		}
+		if total.checks == 0 {
+			continue
+		}
+		uptime := handlers.Uptime{
+			Window: window.name,
+			Checks: total.checks,
+			Ratio:  float64(total.up) / float64(total.checks),
+		}
+		uptime.ErrorBudgetRemaining = 1 - (1-uptime.Ratio)/(1-slo)
+		if total.latencies > 0 {
+			uptime.MeanLatency = total.latency / time.Duration(total.latencies)
+		}
+		windows = append(windows, uptime)
+	}
+	return windows
+}
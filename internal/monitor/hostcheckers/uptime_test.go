@@ -0,0 +1,91 @@
+package hostcheckers
+
+import (
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHistory_Uptime(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 12, 30, 0, 0, time.UTC)
+	var h history
+	assert.Empty(t, h.uptime(now, 0.99))
+
+	// 20 days ago: 10 checks, all down
+	for i := range 10 {
+		h.record(now.Add(-20*24*time.Hour+time.Duration(i)*time.Minute), false, 0)
+	}
+	// 2 days ago: 10 checks, all up
+	for i := range 10 {
+		h.record(now.Add(-48*time.Hour+time.Duration(i)*time.Minute), true, 200*time.Millisecond)
+	}
+	// last hour: 20 checks, one down
+	for i := range 20 {
+		h.record(now.Add(-time.Duration(i)*time.Minute), i != 0, 100*time.Millisecond)
+	}
+
+	want := []handlers.Uptime{
+		{Window: "24h", Checks: 20, Ratio: 0.95, ErrorBudgetRemaining: -4, MeanLatency: 100 * time.Millisecond},
+		{Window: "7d", Checks: 30, Ratio: 29.0 / 30, ErrorBudgetRemaining: 1 - (1-29.0/30)/(1-0.99), MeanLatency: 4 * time.Second / 30},
+		{Window: "30d", Checks: 40, Ratio: 29.0 / 40, ErrorBudgetRemaining: 1 - (1-29.0/40)/(1-0.99), MeanLatency: 4 * time.Second / 30},
+	}
+	got := h.uptime(now, 0.99)
+	require.Len(t, got, len(want))
+	for i := range want {
+		assert.Equal(t, want[i].Window, got[i].Window)
+		assert.Equal(t, want[i].Checks, got[i].Checks)
+		assert.InDelta(t, want[i].Ratio, got[i].Ratio, 1e-9)
+		assert.InDelta(t, want[i].ErrorBudgetRemaining, got[i].ErrorBudgetRemaining, 1e-9)
+		assert.Equal(t, want[i].MeanLatency, got[i].MeanLatency)
+	}
+}
+
+func TestHistory_Trim(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	var h history
+	for hour := range 40 * 24 {
+		h.record(start.Add(time.Duration(hour)*time.Hour), true, time.Millisecond)
+	}
+	// 30 days, plus the current bucket
+	assert.Len(t, h.buckets, 30*24+1)
+}
+
+func TestHistory_Status(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 12, 30, 0, 0, time.UTC)
+	var h history
+	// one check a day for 100 days, down on the last day
+	for day := range 100 {
+		h.record(now.AddDate(0, 0, day-99), day != 99, time.Millisecond)
+	}
+	h.down(now.AddDate(0, 0, -95), "connection failed")
+	h.up(now.AddDate(0, 0, -95).Add(time.Hour))
+	h.down(now.AddDate(0, 0, -2), "invalid status code")
+	h.up(now.AddDate(0, 0, -2).Add(time.Hour))
+	h.down(now, "connection failed")
+
+	days, incidents := h.status(now)
+	require.Len(t, days, status.Days)
+	assert.Equal(t, time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC), days[0].Date)
+	assert.Equal(t, status.Day{Date: time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC), Checks: 1}, days[len(days)-1])
+
+	want := []status.Incident{
+		{Start: now.AddDate(0, 0, -2), End: now.AddDate(0, 0, -2).Add(time.Hour), Reason: "invalid status code"},
+		{Start: now, Reason: "connection failed"},
+	}
+	assert.Equal(t, want, incidents)
+}
+
+func TestHistory_Incidents(t *testing.T) {
+	now := time.Now()
+	var h history
+	for i := range maxIncidents + 5 {
+		h.down(now.Add(time.Duration(i)*time.Minute), "connection failed")
+		h.up(now.Add(time.Duration(i)*time.Minute + time.Second))
+	}
+	_, incidents := h.status(now)
+	require.Len(t, incidents, maxIncidents)
+	assert.Equal(t, now.Add(5*time.Minute), incidents[0].Start)
+}
@@ -0,0 +1,168 @@
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression: minute, hour, day of month, month and day of week. Each field holds
+// the values that match as a bit set.
+type cronSchedule struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek uint64
+	// anyDayOfMonth and anyDayOfWeek record a day field that starts with '*'. If both day fields are restricted,
+	// a day matches if either field matches.
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+var descriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// parseCron parses a cron expression with five fields. Fields hold '*', values, ranges (1-5) and steps (*/15, 1-10/2),
+// separated by commas. Months and days of the week can also be given by their first three letters.
+func parseCron(expression string) (cronSchedule, error) {
+	if descriptor, ok := descriptors[expression]; ok {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	var s cronSchedule
+	var err error
+	if s.minutes, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return cronSchedule{}, fmt.Errorf("minute: %w", err)
+	}
+	if s.hours, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return cronSchedule{}, fmt.Errorf("hour: %w", err)
+	}
+	if s.daysOfMonth, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return cronSchedule{}, fmt.Errorf("day of month: %w", err)
+	}
+	if s.months, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return cronSchedule{}, fmt.Errorf("month: %w", err)
+	}
+	// 7 is Sunday as well
+	if s.daysOfWeek, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return cronSchedule{}, fmt.Errorf("day of week: %w", err)
+	}
+	if s.daysOfWeek&(1<<7) != 0 {
+		s.daysOfWeek |= 1
+	}
+	s.anyDayOfMonth, s.anyDayOfWeek = strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+func parseField(field string, minimum, maximum int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepValue); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepValue)
+			}
+		}
+		first, last := minimum, maximum
+		if valueRange != "*" {
+			from, to, isRange := strings.Cut(valueRange, "-")
+			var err error
+			if first, err = parseValue(from, minimum, maximum, names); err != nil {
+				return 0, err
+			}
+			last = first
+			if isRange {
+				if last, err = parseValue(to, minimum, maximum, names); err != nil {
+					return 0, err
+				}
+				if last < first {
+					return 0, fmt.Errorf("invalid range %q", valueRange)
+				}
+			} else if hasStep {
+				last = maximum
+			}
+		}
+		for value := first; value <= last; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, minimum, maximum int, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if n < minimum || n > maximum {
+		return 0, fmt.Errorf("value %d out of range [%d-%d]", n, minimum, maximum)
+	}
+	return n, nil
+}
+
+var errNoMatch = errors.New("no match")
+
+// prev returns the last time, at or before t, that matches the schedule. It looks back no further than the start
+// of the day of earliest.
+func (s cronSchedule) prev(t time.Time, earliest time.Time) (time.Time, error) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	first := time.Date(earliest.Year(), earliest.Month(), earliest.Day(), 0, 0, 0, 0, earliest.Location())
+	for today := true; !day.Before(first); day, today = day.AddDate(0, 0, -1), false {
+		if !s.matchDay(day) {
+			continue
+		}
+		lastHour := 23
+		if today {
+			lastHour = t.Hour()
+		}
+		for hour := lastHour; hour >= 0; hour-- {
+			if s.hours&(1<<hour) == 0 {
+				continue
+			}
+			lastMinute := 59
+			if today && hour == t.Hour() {
+				lastMinute = t.Minute()
+			}
+			for minute := lastMinute; minute >= 0; minute-- {
+				if s.minutes&(1<<minute) != 0 {
+					return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location()), nil
+				}
+			}
+		}
+	}
+	return time.Time{}, errNoMatch
+}
+
+func (s cronSchedule) matchDay(day time.Time) bool {
+	if s.months&(1<<int(day.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := s.daysOfMonth&(1<<day.Day()) != 0
+	dayOfWeek := s.daysOfWeek&(1<<int(day.Weekday())) != 0
+	switch {
+	case s.anyDayOfMonth && s.anyDayOfWeek:
+		return true
+	case s.anyDayOfMonth:
+		return dayOfWeek
+	case s.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
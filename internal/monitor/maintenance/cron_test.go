@@ -0,0 +1,66 @@
+package maintenance
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    assert.ErrorAssertionFunc
+	}{
+		{name: "every minute", expression: "* * * * *", wantErr: assert.NoError},
+		{name: "lists, ranges and steps", expression: "0,30 1-5/2 */10 1-12 1-5", wantErr: assert.NoError},
+		{name: "names", expression: "0 2 * jan-mar Sat,sun", wantErr: assert.NoError},
+		{name: "descriptor", expression: "@daily", wantErr: assert.NoError},
+		{name: "sunday as 7", expression: "0 0 * * 7", wantErr: assert.NoError},
+		{name: "too few fields", expression: "* * * *", wantErr: assert.Error},
+		{name: "out of range", expression: "60 * * * *", wantErr: assert.Error},
+		{name: "invalid value", expression: "* foo * * *", wantErr: assert.Error},
+		{name: "invalid range", expression: "* 5-1 * * *", wantErr: assert.Error},
+		{name: "invalid step", expression: "*/0 * * * *", wantErr: assert.Error},
+		{name: "day of month zero", expression: "* * 0 * *", wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parseCron(tt.expression)
+			tt.wantErr(t, err)
+		})
+	}
+}
+
+func TestCronSchedule_Prev(t *testing.T) {
+	// 2024-03-06 is a Wednesday
+	now := time.Date(2024, time.March, 6, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		name       string
+		expression string
+		lookback   time.Duration
+		want       time.Time
+		wantErr    assert.ErrorAssertionFunc
+	}{
+		{name: "every minute", expression: "* * * * *", lookback: time.Hour, want: time.Date(2024, time.March, 6, 10, 17, 0, 0, time.UTC), wantErr: assert.NoError},
+		{name: "earlier today", expression: "30 2 * * *", lookback: 24 * time.Hour, want: time.Date(2024, time.March, 6, 2, 30, 0, 0, time.UTC), wantErr: assert.NoError},
+		{name: "later today", expression: "30 22 * * *", lookback: 24 * time.Hour, want: time.Date(2024, time.March, 5, 22, 30, 0, 0, time.UTC), wantErr: assert.NoError},
+		{name: "same hour", expression: "*/15 10 * * *", lookback: time.Hour, want: time.Date(2024, time.March, 6, 10, 15, 0, 0, time.UTC), wantErr: assert.NoError},
+		{name: "day of week", expression: "0 3 * * sun", lookback: 7 * 24 * time.Hour, want: time.Date(2024, time.March, 3, 3, 0, 0, 0, time.UTC), wantErr: assert.NoError},
+		{name: "day of month or week", expression: "0 3 1 * sun", lookback: 7 * 24 * time.Hour, want: time.Date(2024, time.March, 3, 3, 0, 0, 0, time.UTC), wantErr: assert.NoError},
+		{name: "month", expression: "0 0 1 feb *", lookback: 40 * 24 * time.Hour, want: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), wantErr: assert.NoError},
+		{name: "beyond lookback", expression: "0 0 1 jan *", lookback: 24 * time.Hour, wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s, err := parseCron(tt.expression)
+			require.NoError(t, err)
+			got, err := s.prev(now, now.Add(-tt.lookback))
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
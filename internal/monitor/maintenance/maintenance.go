@@ -0,0 +1,152 @@
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"github.com/clambin/uptime/internal/monitor/glob"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ handlers.MaintenanceManager = &Windows{}
+
+// Windows holds the maintenance windows of the monitor.
+type Windows struct {
+	lock    sync.RWMutex
+	windows map[string]window
+}
+
+// window is a validated maintenance window.
+type window struct {
+	handlers.MaintenanceWindow
+	target   *regexp.Regexp
+	schedule cronSchedule
+	location *time.Location
+}
+
+func New() *Windows {
+	return &Windows{windows: make(map[string]window)}
+}
+
+// Load reads maintenance windows from a YAML file holding a list of windows.
+func Load(r io.Reader) (*Windows, error) {
+	var windows []handlers.MaintenanceWindow
+	if err := yaml.NewDecoder(r).Decode(&windows); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	w := New()
+	for _, window := range windows {
+		if _, ok := w.windows[window.ID]; ok {
+			return nil, fmt.Errorf("window %s: duplicate id", window.ID)
+		}
+		if err := w.Set(window); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func LoadFromFile(path string) (*Windows, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return Load(f)
+}
+
+// Windows returns the maintenance windows, sorted by ID.
+func (w *Windows) Windows() []handlers.MaintenanceWindow {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	windows := make([]handlers.MaintenanceWindow, 0, len(w.windows))
+	for _, window := range w.windows {
+		windows = append(windows, window.MaintenanceWindow)
+	}
+	slices.SortFunc(windows, func(a, b handlers.MaintenanceWindow) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return windows
+}
+
+// Set adds the window, or replaces the window with the same ID.
+func (w *Windows) Set(window handlers.MaintenanceWindow) error {
+	v, err := validate(window)
+	if err != nil {
+		return fmt.Errorf("window %s: %w", window.ID, err)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.windows[window.ID] = v
+	return nil
+}
+
+// Delete removes the window. It returns false if the window does not exist.
+func (w *Windows) Delete(id string) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, ok := w.windows[id]
+	delete(w.windows, id)
+	return ok
+}
+
+// Active returns true if the target is in maintenance at time t.
+func (w *Windows) Active(target string, t time.Time) bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	for _, window := range w.windows {
+		if window.matches(target) && window.active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func validate(w handlers.MaintenanceWindow) (window, error) {
+	if w.ID == "" {
+		return window{}, errors.New("missing id")
+	}
+	v := window{MaintenanceWindow: w, target: glob.Compile(w.Target), location: time.UTC}
+	switch {
+	case w.Schedule != "" && (!w.Start.IsZero() || !w.End.IsZero()):
+		return window{}, errors.New("window has both a schedule and a start or end")
+	case w.Schedule != "":
+		var err error
+		if v.schedule, err = parseCron(w.Schedule); err != nil {
+			return window{}, fmt.Errorf("schedule: %w", err)
+		}
+		if w.Duration <= 0 {
+			return window{}, errors.New("recurring window needs a duration")
+		}
+		if w.TimeZone != "" {
+			if v.location, err = time.LoadLocation(w.TimeZone); err != nil {
+				return window{}, fmt.Errorf("timezone: %w", err)
+			}
+		}
+	case w.Start.IsZero() || w.End.IsZero():
+		return window{}, errors.New("window needs a start and end, or a schedule")
+	case !w.End.After(w.Start):
+		return window{}, errors.New("end must be after start")
+	}
+	return v, nil
+}
+
+func (w window) matches(target string) bool {
+	return w.target.MatchString(target)
+}
+
+func (w window) active(t time.Time) bool {
+	if w.Schedule == "" {
+		return !t.Before(w.Start) && t.Before(w.End)
+	}
+	t = t.In(w.location)
+	start, err := w.schedule.prev(t, t.Add(-w.Duration))
+	return err == nil && t.Sub(start) < w.Duration
+}
@@ -0,0 +1,187 @@
+package maintenance
+
+import (
+	"bytes"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWindows_Active(t *testing.T) {
+	// 2024-03-06 is a Wednesday
+	now := time.Date(2024, time.March, 6, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		window handlers.MaintenanceWindow
+		target string
+		at     time.Time
+		want   bool
+	}{
+		{
+			name:   "one-off",
+			window: handlers.MaintenanceWindow{Target: "https://example.com", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+			target: "https://example.com",
+			at:     now,
+			want:   true,
+		},
+		{
+			name:   "one-off ended",
+			window: handlers.MaintenanceWindow{Target: "https://example.com", Start: now.Add(-time.Hour), End: now},
+			target: "https://example.com",
+			at:     now,
+		},
+		{
+			name:   "other target",
+			window: handlers.MaintenanceWindow{Target: "https://example.com", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+			target: "https://example.org",
+			at:     now,
+		},
+		{
+			name:   "glob",
+			window: handlers.MaintenanceWindow{Target: "https://*.example.com/*", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+			target: "https://api.example.com/v1/health",
+			at:     now,
+			want:   true,
+		},
+		{
+			name:   "glob mismatch",
+			window: handlers.MaintenanceWindow{Target: "https://*.example.com/*", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+			target: "https://example.com",
+			at:     now,
+		},
+		{
+			name:   "global",
+			window: handlers.MaintenanceWindow{Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+			target: "example.com:443",
+			at:     now,
+			want:   true,
+		},
+		{
+			name:   "recurring",
+			window: handlers.MaintenanceWindow{Schedule: "30 9 * * wed", Duration: time.Hour},
+			target: "https://example.com",
+			at:     now,
+			want:   true,
+		},
+		{
+			name:   "recurring ended",
+			window: handlers.MaintenanceWindow{Schedule: "30 9 * * wed", Duration: 30 * time.Minute},
+			target: "https://example.com",
+			at:     now,
+		},
+		{
+			name:   "recurring since yesterday",
+			window: handlers.MaintenanceWindow{Schedule: "0 22 * * *", Duration: 13 * time.Hour},
+			target: "https://example.com",
+			at:     now,
+			want:   true,
+		},
+		{
+			name:   "recurring in time zone",
+			window: handlers.MaintenanceWindow{Schedule: "30 10 * * *", Duration: time.Hour, TimeZone: "Europe/Brussels"},
+			target: "https://example.com",
+			at:     now,
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := New()
+			tt.window.ID = "test"
+			require.NoError(t, w.Set(tt.window))
+			assert.Equal(t, tt.want, w.Active(tt.target, tt.at))
+		})
+	}
+}
+
+func TestWindows_Set(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		window  handlers.MaintenanceWindow
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "one-off", window: handlers.MaintenanceWindow{ID: "test", Start: now, End: now.Add(time.Hour)}, wantErr: assert.NoError},
+		{name: "recurring", window: handlers.MaintenanceWindow{ID: "test", Schedule: "@weekly", Duration: time.Hour}, wantErr: assert.NoError},
+		{name: "missing id", window: handlers.MaintenanceWindow{Start: now, End: now.Add(time.Hour)}, wantErr: assert.Error},
+		{name: "missing end", window: handlers.MaintenanceWindow{ID: "test", Start: now}, wantErr: assert.Error},
+		{name: "end before start", window: handlers.MaintenanceWindow{ID: "test", Start: now, End: now.Add(-time.Hour)}, wantErr: assert.Error},
+		{name: "schedule and start", window: handlers.MaintenanceWindow{ID: "test", Schedule: "@daily", Duration: time.Hour, Start: now}, wantErr: assert.Error},
+		{name: "invalid schedule", window: handlers.MaintenanceWindow{ID: "test", Schedule: "@never", Duration: time.Hour}, wantErr: assert.Error},
+		{name: "missing duration", window: handlers.MaintenanceWindow{ID: "test", Schedule: "@daily"}, wantErr: assert.Error},
+		{name: "invalid time zone", window: handlers.MaintenanceWindow{ID: "test", Schedule: "@daily", Duration: time.Hour, TimeZone: "Mars/Olympus"}, wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.wantErr(t, New().Set(tt.window))
+		})
+	}
+}
+
+func TestWindows_Delete(t *testing.T) {
+	w := New()
+	require.NoError(t, w.Set(handlers.MaintenanceWindow{ID: "b", Schedule: "@daily", Duration: time.Hour}))
+	require.NoError(t, w.Set(handlers.MaintenanceWindow{ID: "a", Schedule: "@weekly", Duration: time.Hour}))
+	windows := w.Windows()
+	require.Len(t, windows, 2)
+	assert.Equal(t, "a", windows[0].ID)
+
+	assert.True(t, w.Delete("a"))
+	assert.False(t, w.Delete("a"))
+	assert.Len(t, w.Windows(), 1)
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "empty", input: ``, wantErr: assert.NoError},
+		{
+			name: "valid",
+			input: `
+- id: upgrade
+  target: https://*.example.com/*
+  start: 2024-03-06T08:00:00Z
+  end: 2024-03-06T10:00:00Z
+  reason: cluster upgrade
+- id: backups
+  schedule: "0 2 * * sun"
+  duration: 2h
+  timezone: Europe/Brussels
+`,
+			want:    2,
+			wantErr: assert.NoError,
+		},
+		{
+			name: "duplicate id",
+			input: `
+- id: backups
+  schedule: "@daily"
+  duration: 1h
+- id: backups
+  schedule: "@weekly"
+  duration: 1h
+`,
+			wantErr: assert.Error,
+		},
+		{name: "invalid window", input: `[{id: backups, schedule: "@daily"}]`, wantErr: assert.Error},
+		{name: "invalid yaml", input: `{`, wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w, err := Load(bytes.NewBufferString(tt.input))
+			tt.wantErr(t, err)
+			if err == nil {
+				assert.Len(t, w.Windows(), tt.want)
+			}
+		})
+	}
+}
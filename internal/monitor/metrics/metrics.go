@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"github.com/clambin/go-common/http/metrics"
+	"github.com/clambin/uptime/internal/monitor/handlers"
 	"github.com/prometheus/client_golang/prometheus"
 	"log/slog"
 	"net/http"
@@ -12,11 +13,29 @@ import (
 var _ prometheus.Collector = HostMetrics{}
 
 type HostMetrics struct {
-	up         *prometheus.GaugeVec
-	certExpiry *prometheus.GaugeVec
+	up          *prometheus.GaugeVec
+	certExpiry  *prometheus.GaugeVec
+	tcpLatency  *prometheus.GaugeVec
+	bannerMatch *prometheus.GaugeVec
+	dnsLatency  *prometheus.GaugeVec
+	answerMatch *prometheus.GaugeVec
+	downReason  *prometheus.GaugeVec
+	maintenance *prometheus.GaugeVec
+	phases      *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	expiries    *prometheus.CounterVec
+	owners      ownerMetrics
+	uptime      uptimeMetrics
+	tls         tlsMetrics
 }
 
 func NewHostMetrics(namespace, subsystem string, labels map[string]string) *HostMetrics {
+	return NewHostMetricsWithMetadata(namespace, subsystem, labels, nil)
+}
+
+// NewHostMetricsWithMetadata returns HostMetrics that add the metadata keys, forwarded by the agents, as labels to
+// the info metric. Keys are validated by ValidateMetadataKeys.
+func NewHostMetricsWithMetadata(namespace, subsystem string, labels map[string]string, metadataKeys []string) *HostMetrics {
 	return &HostMetrics{
 		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace:   namespace,
@@ -32,6 +51,72 @@ func NewHostMetrics(namespace, subsystem string, labels map[string]string) *Host
 			Help:        "number of days before the certificate expires",
 			ConstLabels: labels,
 		}, []string{"host"}),
+		tcpLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "tcp_connect_latency_seconds",
+			Help:        "time taken to establish a tcp connection",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		bannerMatch: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "tcp_banner_match",
+			Help:        "tcp response contains the expected banner",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		dnsLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "dns_resolution_latency_seconds",
+			Help:        "time taken to resolve the dns name",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		answerMatch: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "dns_answer_match",
+			Help:        "dns answer contains the expected records",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		downReason: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "down_reason",
+			Help:        "reason why the site is down",
+			ConstLabels: labels,
+		}, []string{"host", "reason"}),
+		phases: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "http_phase_duration_seconds",
+			Help:        "duration of each phase of the http request",
+			ConstLabels: labels,
+		}, []string{"host", "phase"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "state_transitions_total",
+			Help:        "number of times the site changed state",
+			ConstLabels: labels,
+		}, []string{"host", "state"}),
+		maintenance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "maintenance",
+			Help:        "site is in a maintenance window (up reports the state from before the maintenance)",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		expiries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "expired_targets_total",
+			Help:        "number of targets removed because their registration was not renewed",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		owners: newOwnerMetrics(namespace, subsystem, labels, metadataKeys),
+		uptime: newUptimeMetrics(namespace, subsystem, labels),
+		tls:    newTLSMetrics(namespace, subsystem, labels),
 	}
 }
 
@@ -40,21 +125,118 @@ var bool2int = map[bool]int{
 	false: 0,
 }
 
-func (m HostMetrics) Observe(measurement HTTPMeasurement) {
+var upDown = map[bool]string{
+	true:  "up",
+	false: "down",
+}
+
+func (m HostMetrics) Observe(measurement Measurement) {
 	m.up.WithLabelValues(measurement.Host).Set(float64(bool2int[measurement.Up]))
+	m.maintenance.WithLabelValues(measurement.Host).Set(float64(bool2int[measurement.Maintenance]))
+	if measurement.Transition {
+		m.transitions.WithLabelValues(measurement.Host, upDown[measurement.Up]).Inc()
+	}
+	// only report the current reason
+	m.downReason.DeletePartialMatch(prometheus.Labels{"host": measurement.Host})
+	if !measurement.Up && measurement.Reason != "" {
+		m.downReason.WithLabelValues(measurement.Host, measurement.Reason).Set(1)
+	}
 	if measurement.IsTLS {
 		m.certExpiry.WithLabelValues(measurement.Host).Set(measurement.TLSExpiry.Hours() / 24)
+		m.tls.observe(measurement.Host, measurement.TLS)
+	}
+	if measurement.Type == handlers.ProbeTCP && measurement.Latency > 0 {
+		m.tcpLatency.WithLabelValues(measurement.Host).Set(measurement.Latency.Seconds())
+	}
+	if measurement.ExpectsBanner {
+		m.bannerMatch.WithLabelValues(measurement.Host).Set(float64(bool2int[measurement.BannerMatch]))
+	}
+	if measurement.Type == handlers.ProbeDNS && measurement.Latency > 0 {
+		m.dnsLatency.WithLabelValues(measurement.Host).Set(measurement.Latency.Seconds())
+	}
+	if measurement.ExpectsAnswer {
+		m.answerMatch.WithLabelValues(measurement.Host).Set(float64(bool2int[measurement.AnswerMatch]))
+	}
+	if measurement.Code > 0 {
+		m.observePhases(measurement.Host, measurement.Phases)
+	}
+	m.uptime.observe(measurement.Host, measurement.SLO, measurement.Uptime)
+}
+
+func (m HostMetrics) observePhases(host string, phases Phases) {
+	// dns, connect & tls are only measured for new connections: keep the last measured value
+	for phase, duration := range map[string]time.Duration{"dns": phases.DNS, "connect": phases.Connect, "tls": phases.TLS} {
+		if duration > 0 {
+			m.phases.WithLabelValues(host, phase).Set(duration.Seconds())
+		}
+	}
+	m.phases.WithLabelValues(host, "ttfb").Set(phases.TTFB.Seconds())
+	m.phases.WithLabelValues(host, "transfer").Set(phases.Transfer.Seconds())
+}
+
+// Forget removes the metrics of a host that is no longer checked. The number of expired targets is kept.
+func (m HostMetrics) Forget(host string) {
+	labels := prometheus.Labels{"host": host}
+	for _, vec := range []*prometheus.MetricVec{
+		m.up.MetricVec,
+		m.certExpiry.MetricVec,
+		m.tcpLatency.MetricVec,
+		m.bannerMatch.MetricVec,
+		m.dnsLatency.MetricVec,
+		m.answerMatch.MetricVec,
+		m.downReason.MetricVec,
+		m.maintenance.MetricVec,
+		m.phases.MetricVec,
+		m.transitions.MetricVec,
+	} {
+		vec.DeletePartialMatch(labels)
 	}
+	m.owners.observe(host, nil)
+	m.uptime.forget(host)
+	m.tls.forget(host)
+}
+
+func (m HostMetrics) ObserveExpiry(host string) {
+	m.expiries.WithLabelValues(host).Inc()
+}
+
+// ObserveOwners reports the agents that registered the host. Calling it without owners removes the host's owners.
+func (m HostMetrics) ObserveOwners(host string, owners []Owner) {
+	m.owners.observe(host, owners)
 }
 
 func (m HostMetrics) Describe(ch chan<- *prometheus.Desc) {
 	m.up.Describe(ch)
 	m.certExpiry.Describe(ch)
+	m.tcpLatency.Describe(ch)
+	m.bannerMatch.Describe(ch)
+	m.dnsLatency.Describe(ch)
+	m.answerMatch.Describe(ch)
+	m.downReason.Describe(ch)
+	m.maintenance.Describe(ch)
+	m.phases.Describe(ch)
+	m.transitions.Describe(ch)
+	m.expiries.Describe(ch)
+	m.owners.Describe(ch)
+	m.uptime.Describe(ch)
+	m.tls.Describe(ch)
 }
 
 func (m HostMetrics) Collect(ch chan<- prometheus.Metric) {
 	m.up.Collect(ch)
 	m.certExpiry.Collect(ch)
+	m.tcpLatency.Collect(ch)
+	m.bannerMatch.Collect(ch)
+	m.dnsLatency.Collect(ch)
+	m.answerMatch.Collect(ch)
+	m.downReason.Collect(ch)
+	m.maintenance.Collect(ch)
+	m.phases.Collect(ch)
+	m.transitions.Collect(ch)
+	m.expiries.Collect(ch)
+	m.owners.Collect(ch)
+	m.uptime.Collect(ch)
+	m.tls.Collect(ch)
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -111,27 +293,81 @@ func (h httpMetrics) Collect(ch chan<- prometheus.Metric) {
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
-var _ slog.LogValuer = HTTPMeasurement{}
+var _ slog.LogValuer = Measurement{}
 
-type HTTPMeasurement struct {
-	Host      string
-	Up        bool
-	Code      int
-	Latency   time.Duration
-	IsTLS     bool
-	TLSExpiry time.Duration
+type Measurement struct {
+	Host          string
+	Type          string
+	Up            bool
+	Code          int
+	Latency       time.Duration
+	IsTLS         bool
+	TLSExpiry     time.Duration
+	TLS           TLSInfo
+	ExpectsBanner bool
+	BannerMatch   bool
+	ExpectsAnswer bool
+	AnswerMatch   bool
+	Reason        string
+	Phases        Phases
+	Transition    bool
+	// Downtime is the time a target that came back up was down.
+	Downtime time.Duration
+	// Maintenance is set if the check was made during a maintenance window.
+	Maintenance bool
+	SLO         float64
+	Uptime      []handlers.Uptime
 }
 
-func (m HTTPMeasurement) LogValue() slog.Value {
+func (m Measurement) LogValue() slog.Value {
 	attrs := make([]slog.Attr, 2, 5)
 	attrs[0] = slog.String("target", m.Host)
 	attrs[1] = slog.Bool("up", m.Up)
+	if m.Reason != "" {
+		attrs = append(attrs, slog.String("reason", m.Reason))
+	}
 	if m.Code > 0 {
 		attrs = append(attrs, slog.String("code", strconv.Itoa(m.Code)))
+	}
+	if m.Code > 0 || m.Latency > 0 {
 		attrs = append(attrs, slog.Duration("latency", m.Latency))
 	}
 	if m.IsTLS {
 		attrs = append(attrs, slog.Duration("certExpiry", m.TLSExpiry))
+		if m.TLS.VerifyError != "" {
+			attrs = append(attrs, slog.String("certError", m.TLS.VerifyError))
+		}
+	}
+	if m.Phases != (Phases{}) {
+		attrs = append(attrs, slog.Any("phases", m.Phases))
+	}
+	if m.ExpectsBanner {
+		attrs = append(attrs, slog.Bool("bannerMatch", m.BannerMatch))
+	}
+	if m.ExpectsAnswer {
+		attrs = append(attrs, slog.Bool("answerMatch", m.AnswerMatch))
 	}
 	return slog.GroupValue(attrs...)
 }
+
+var _ slog.LogValuer = Phases{}
+
+// Phases holds the duration of each phase of an HTTP request. DNS, Connect and TLS are zero if the request reused an
+// existing connection.
+type Phases struct {
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	TTFB     time.Duration
+	Transfer time.Duration
+}
+
+func (p Phases) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Duration("dns", p.DNS),
+		slog.Duration("connect", p.Connect),
+		slog.Duration("tls", p.TLS),
+		slog.Duration("ttfb", p.TTFB),
+		slog.Duration("transfer", p.Transfer),
+	)
+}
@@ -2,9 +2,11 @@ package metrics
 
 import (
 	"bytes"
+	"github.com/clambin/uptime/internal/monitor/handlers"
 	"github.com/clambin/uptime/pkg/logtester"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -16,25 +18,164 @@ func TestHostMetrics_Observe(t *testing.T) {
 	metrics := NewHostMetrics("uptime", "monitor", nil)
 	assert.NoError(t, testutil.CollectAndCompare(metrics, strings.NewReader(``)))
 
-	metrics.Observe(HTTPMeasurement{
+	metrics.Observe(Measurement{
 		Host:      "localhost",
 		Up:        true,
 		Code:      http.StatusOK,
 		Latency:   time.Second,
 		IsTLS:     true,
 		TLSExpiry: time.Hour,
+		Phases:    Phases{DNS: 10 * time.Millisecond, Connect: 20 * time.Millisecond, TLS: 30 * time.Millisecond, TTFB: 100 * time.Millisecond, Transfer: 50 * time.Millisecond},
 	})
 
 	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
 # HELP uptime_monitor_certificate_expiry_days number of days before the certificate expires
 # TYPE uptime_monitor_certificate_expiry_days gauge
 uptime_monitor_certificate_expiry_days{host="localhost"} 0.041666666666666664
+# HELP uptime_monitor_http_phase_duration_seconds duration of each phase of the http request
+# TYPE uptime_monitor_http_phase_duration_seconds gauge
+uptime_monitor_http_phase_duration_seconds{host="localhost",phase="connect"} 0.02
+uptime_monitor_http_phase_duration_seconds{host="localhost",phase="dns"} 0.01
+uptime_monitor_http_phase_duration_seconds{host="localhost",phase="tls"} 0.03
+uptime_monitor_http_phase_duration_seconds{host="localhost",phase="transfer"} 0.05
+uptime_monitor_http_phase_duration_seconds{host="localhost",phase="ttfb"} 0.1
 # HELP uptime_monitor_up site is up/down
 # TYPE uptime_monitor_up gauge
 uptime_monitor_up{host="localhost"} 1
+`), "uptime_monitor_certificate_expiry_days", "uptime_monitor_http_phase_duration_seconds", "uptime_monitor_up"))
+}
+
+func TestHostMetrics_Observe_Maintenance(t *testing.T) {
+	metrics := NewHostMetrics("uptime", "monitor", nil)
+	metrics.Observe(Measurement{Host: "localhost", Up: true, Maintenance: true})
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_maintenance site is in a maintenance window (up reports the state from before the maintenance)
+# TYPE uptime_monitor_maintenance gauge
+uptime_monitor_maintenance{host="localhost"} 1
+# HELP uptime_monitor_up site is up/down
+# TYPE uptime_monitor_up gauge
+uptime_monitor_up{host="localhost"} 1
+`), "uptime_monitor_maintenance", "uptime_monitor_up"))
+}
+
+func TestHostMetrics_Observe_TCP(t *testing.T) {
+	metrics := NewHostMetrics("uptime", "monitor", nil)
+	metrics.Observe(Measurement{
+		Host:          "localhost:1883",
+		Type:          handlers.ProbeTCP,
+		Up:            true,
+		Latency:       10 * time.Millisecond,
+		ExpectsBanner: true,
+		BannerMatch:   true,
+	})
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_maintenance site is in a maintenance window (up reports the state from before the maintenance)
+# TYPE uptime_monitor_maintenance gauge
+uptime_monitor_maintenance{host="localhost:1883"} 0
+# HELP uptime_monitor_tcp_banner_match tcp response contains the expected banner
+# TYPE uptime_monitor_tcp_banner_match gauge
+uptime_monitor_tcp_banner_match{host="localhost:1883"} 1
+# HELP uptime_monitor_tcp_connect_latency_seconds time taken to establish a tcp connection
+# TYPE uptime_monitor_tcp_connect_latency_seconds gauge
+uptime_monitor_tcp_connect_latency_seconds{host="localhost:1883"} 0.01
+# HELP uptime_monitor_up site is up/down
+# TYPE uptime_monitor_up gauge
+uptime_monitor_up{host="localhost:1883"} 1
+`)))
+}
+
+func TestHostMetrics_Observe_DNS(t *testing.T) {
+	metrics := NewHostMetrics("uptime", "monitor", nil)
+	metrics.Observe(Measurement{
+		Host:          "example.com",
+		Type:          handlers.ProbeDNS,
+		Latency:       5 * time.Millisecond,
+		ExpectsAnswer: true,
+	})
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_dns_answer_match dns answer contains the expected records
+# TYPE uptime_monitor_dns_answer_match gauge
+uptime_monitor_dns_answer_match{host="example.com"} 0
+# HELP uptime_monitor_dns_resolution_latency_seconds time taken to resolve the dns name
+# TYPE uptime_monitor_dns_resolution_latency_seconds gauge
+uptime_monitor_dns_resolution_latency_seconds{host="example.com"} 0.005
+# HELP uptime_monitor_maintenance site is in a maintenance window (up reports the state from before the maintenance)
+# TYPE uptime_monitor_maintenance gauge
+uptime_monitor_maintenance{host="example.com"} 0
+# HELP uptime_monitor_up site is up/down
+# TYPE uptime_monitor_up gauge
+uptime_monitor_up{host="example.com"} 0
 `)))
 }
 
+func TestHostMetrics_Observe_Reason(t *testing.T) {
+	metrics := NewHostMetrics("uptime", "monitor", nil)
+	metrics.Observe(Measurement{Host: "localhost", Code: http.StatusOK, Reason: "body json path mismatch"})
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_down_reason reason why the site is down
+# TYPE uptime_monitor_down_reason gauge
+uptime_monitor_down_reason{host="localhost",reason="body json path mismatch"} 1
+# HELP uptime_monitor_up site is up/down
+# TYPE uptime_monitor_up gauge
+uptime_monitor_up{host="localhost"} 0
+`), "uptime_monitor_down_reason", "uptime_monitor_up"))
+
+	metrics.Observe(Measurement{Host: "localhost", Up: true, Code: http.StatusOK})
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_up site is up/down
+# TYPE uptime_monitor_up gauge
+uptime_monitor_up{host="localhost"} 1
+`), "uptime_monitor_down_reason", "uptime_monitor_up"))
+}
+
+func TestHostMetrics_Observe_Transitions(t *testing.T) {
+	metrics := NewHostMetrics("uptime", "monitor", nil)
+	metrics.Observe(Measurement{Host: "localhost", Up: true})
+	metrics.Observe(Measurement{Host: "localhost", Up: false, Transition: true})
+	metrics.Observe(Measurement{Host: "localhost", Up: true, Transition: true})
+	metrics.Observe(Measurement{Host: "localhost", Up: false, Transition: true})
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_state_transitions_total number of times the site changed state
+# TYPE uptime_monitor_state_transitions_total counter
+uptime_monitor_state_transitions_total{host="localhost",state="down"} 2
+uptime_monitor_state_transitions_total{host="localhost",state="up"} 1
+`), "uptime_monitor_state_transitions_total"))
+}
+
+func TestHostMetrics_Forget(t *testing.T) {
+	metrics := NewHostMetrics("uptime", "monitor", nil)
+	observe := func(host string) {
+		metrics.Observe(Measurement{
+			Host:       host,
+			Code:       http.StatusInternalServerError,
+			Reason:     "invalid status code",
+			Transition: true,
+			IsTLS:      true,
+			TLSExpiry:  time.Hour,
+			TLS:        TLSInfo{Subject: "CN=" + host, VerifyError: "x509: certificate has expired", Version: "TLS 1.3"},
+			Phases:     Phases{DNS: time.Millisecond, TTFB: time.Millisecond},
+			SLO:        0.99,
+			Uptime:     []handlers.Uptime{{Window: "24h", Checks: 1}},
+		})
+		metrics.ObserveOwners(host, []Owner{{Name: "cluster"}})
+	}
+	observe("example.com")
+	count := testutil.CollectAndCount(metrics)
+	require.NotZero(t, count)
+
+	observe("example.org")
+	metrics.ObserveExpiry("example.org")
+	metrics.Forget("example.org")
+	assert.Equal(t, count+1, testutil.CollectAndCount(metrics))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics, "uptime_monitor_expired_targets_total"))
+}
+
 func TestHTTPMetrics_Observe(t *testing.T) {
 	metrics := NewHTTPMetrics("uptime", "monitor", nil)
 	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(``)))
@@ -65,27 +206,47 @@ uptime_monitor_http_requests_total{code="200",host="localhost"} 1
 `)))
 }
 
-func TestHTTPMeasurement_LogValue(t *testing.T) {
+func TestMeasurement_LogValue(t *testing.T) {
 	tests := []struct {
 		name string
-		m    HTTPMeasurement
+		m    Measurement
 		want string
 	}{
 		{
 			name: "down",
-			m:    HTTPMeasurement{Host: "localhost"},
+			m:    Measurement{Host: "localhost"},
 			want: "level=INFO msg=measurement m.target=localhost m.up=false\n",
 		},
+		{
+			name: "reason",
+			m:    Measurement{Host: "localhost", Code: http.StatusOK, Latency: time.Millisecond, Reason: "body regex mismatch"},
+			want: "level=INFO msg=measurement m.target=localhost m.up=false m.reason=\"body regex mismatch\" m.code=200 m.latency=1ms\n",
+		},
 		{
 			name: "rejected",
-			m:    HTTPMeasurement{Host: "localhost", Code: http.StatusInternalServerError, Latency: time.Millisecond},
+			m:    Measurement{Host: "localhost", Code: http.StatusInternalServerError, Latency: time.Millisecond},
 			want: "level=INFO msg=measurement m.target=localhost m.up=false m.code=500 m.latency=1ms\n",
 		},
 		{
 			name: "up",
-			m:    HTTPMeasurement{Host: "localhost", Up: true, Code: http.StatusOK, Latency: time.Millisecond, IsTLS: true, TLSExpiry: time.Hour},
+			m:    Measurement{Host: "localhost", Up: true, Code: http.StatusOK, Latency: time.Millisecond, IsTLS: true, TLSExpiry: time.Hour},
 			want: "level=INFO msg=measurement m.target=localhost m.up=true m.code=200 m.latency=1ms m.certExpiry=1h0m0s\n",
 		},
+		{
+			name: "phases",
+			m:    Measurement{Host: "localhost", Up: true, Code: http.StatusOK, Latency: time.Millisecond, Phases: Phases{Connect: time.Millisecond, TTFB: 2 * time.Millisecond}},
+			want: "level=INFO msg=measurement m.target=localhost m.up=true m.code=200 m.latency=1ms m.phases.dns=0s m.phases.connect=1ms m.phases.tls=0s m.phases.ttfb=2ms m.phases.transfer=0s\n",
+		},
+		{
+			name: "tcp",
+			m:    Measurement{Host: "localhost:1883", Type: handlers.ProbeTCP, Up: true, Latency: time.Millisecond, ExpectsBanner: true, BannerMatch: true},
+			want: "level=INFO msg=measurement m.target=localhost:1883 m.up=true m.latency=1ms m.bannerMatch=true\n",
+		},
+		{
+			name: "dns",
+			m:    Measurement{Host: "example.com", Type: handlers.ProbeDNS, Latency: time.Millisecond, ExpectsAnswer: true},
+			want: "level=INFO msg=measurement m.target=example.com m.up=false m.latency=1ms m.answerMatch=false\n",
+		},
 	}
 
 	for _, tt := range tests {
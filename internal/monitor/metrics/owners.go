@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"fmt"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/prometheus/client_golang/prometheus"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Owner is an agent that registered a target. Metadata holds the kubernetes metadata of the resource that exposes
+// the target, as forwarded by the agent.
+type Owner struct {
+	Name     string
+	Metadata map[string]string
+}
+
+var (
+	infoLabels        = []string{"host", "owner", handlers.MetadataKind, handlers.MetadataNamespace, handlers.MetadataName}
+	invalidLabelRunes = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// metadataLabelName converts a kubernetes label or annotation key to a valid prometheus label name.
+// E.g. app.kubernetes.io/name becomes app_kubernetes_io_name.
+func metadataLabelName(key string) string {
+	name := invalidLabelRunes.ReplaceAllString(key, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func metadataLabelNames(keys []string) []string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = metadataLabelName(key)
+	}
+	return names
+}
+
+// ValidateMetadataKeys checks that the metadata keys can be added as labels to the info metric: the resulting label
+// names must be unique and not clash with the info metric's own labels.
+func ValidateMetadataKeys(keys []string) error {
+	seen := make(map[string]string, len(infoLabels)+len(keys))
+	for _, label := range infoLabels {
+		seen[label] = label
+	}
+	for _, key := range keys {
+		name := metadataLabelName(key)
+		if name == "" || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("metadata key %q: invalid label name %q", key, name)
+		}
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("metadata key %q: label %q already used by %q", key, name, other)
+		}
+		seen[name] = key
+	}
+	return nil
+}
+
+type ownerMetrics struct {
+	owners       *prometheus.GaugeVec
+	info         *prometheus.GaugeVec
+	metadataKeys []string
+}
+
+func newOwnerMetrics(namespace, subsystem string, labels map[string]string, metadataKeys []string) ownerMetrics {
+	return ownerMetrics{
+		owners: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "owner",
+			Help:        "agent that registered the site. join on host to add the owner to other metrics",
+			ConstLabels: labels,
+		}, []string{"host", "owner"}),
+		info: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "info",
+			Help:        "kubernetes metadata of the resource that exposes the site. join on host to route alerts",
+			ConstLabels: labels,
+		}, slices.Concat(infoLabels, metadataLabelNames(metadataKeys))),
+		metadataKeys: metadataKeys,
+	}
+}
+
+func (m ownerMetrics) observe(host string, owners []Owner) {
+	m.owners.DeletePartialMatch(prometheus.Labels{"host": host})
+	m.info.DeletePartialMatch(prometheus.Labels{"host": host})
+	for _, owner := range owners {
+		m.owners.WithLabelValues(host, owner.Name).Set(1)
+		if len(owner.Metadata) == 0 {
+			continue
+		}
+		values := []string{host, owner.Name, owner.Metadata[handlers.MetadataKind], owner.Metadata[handlers.MetadataNamespace], owner.Metadata[handlers.MetadataName]}
+		for _, key := range m.metadataKeys {
+			values = append(values, owner.Metadata[key])
+		}
+		m.info.WithLabelValues(values...).Set(1)
+	}
+}
+
+func (m ownerMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.owners.Describe(ch)
+	m.info.Describe(ch)
+}
+
+func (m ownerMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.owners.Collect(ch)
+	m.info.Collect(ch)
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHostMetrics_ObserveOwners(t *testing.T) {
+	metrics := NewHostMetricsWithMetadata("uptime", "monitor", nil, []string{"team", "app.kubernetes.io/name"})
+	metrics.ObserveOwners("localhost", []Owner{
+		{Name: "cluster-a", Metadata: map[string]string{"kind": "ingress", "namespace": "foo", "name": "bar", "team": "infra", "other": "ignored"}},
+		{Name: "cluster-b"},
+	})
+	metrics.ObserveOwners("example.com", []Owner{
+		{Name: "cluster-a", Metadata: map[string]string{"kind": "service", "namespace": "foo", "name": "snafu", "app.kubernetes.io/name": "snafu"}},
+	})
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_info kubernetes metadata of the resource that exposes the site. join on host to route alerts
+# TYPE uptime_monitor_info gauge
+uptime_monitor_info{app_kubernetes_io_name="",host="localhost",kind="ingress",name="bar",namespace="foo",owner="cluster-a",team="infra"} 1
+uptime_monitor_info{app_kubernetes_io_name="snafu",host="example.com",kind="service",name="snafu",namespace="foo",owner="cluster-a",team=""} 1
+# HELP uptime_monitor_owner agent that registered the site. join on host to add the owner to other metrics
+# TYPE uptime_monitor_owner gauge
+uptime_monitor_owner{host="example.com",owner="cluster-a"} 1
+uptime_monitor_owner{host="localhost",owner="cluster-a"} 1
+uptime_monitor_owner{host="localhost",owner="cluster-b"} 1
+`), "uptime_monitor_owner", "uptime_monitor_info"))
+
+	metrics.ObserveOwners("localhost", []Owner{{Name: "cluster-b"}})
+	metrics.ObserveOwners("example.com", nil)
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_owner agent that registered the site. join on host to add the owner to other metrics
+# TYPE uptime_monitor_owner gauge
+uptime_monitor_owner{host="localhost",owner="cluster-b"} 1
+`), "uptime_monitor_owner", "uptime_monitor_info"))
+}
+
+func TestValidateMetadataKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "empty", wantErr: assert.NoError},
+		{name: "valid", keys: []string{"team", "app.kubernetes.io/name", "1password"}, wantErr: assert.NoError},
+		{name: "reserved", keys: []string{"namespace"}, wantErr: assert.Error},
+		{name: "duplicate", keys: []string{"app.kubernetes.io/name", "app_kubernetes_io/name"}, wantErr: assert.Error},
+		{name: "invalid", keys: []string{"__meta"}, wantErr: assert.Error},
+		{name: "blank", keys: []string{""}, wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.wantErr(t, ValidateMetadataKeys(tt.keys))
+		})
+	}
+}
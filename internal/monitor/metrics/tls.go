@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"time"
+)
+
+var _ slog.LogValuer = TLSInfo{}
+
+// TLSInfo describes the TLS connection and the certificate chain presented by the server. VerifyError is set if the
+// chain does not verify against the trusted roots, even if the connection itself was made without verification.
+type TLSInfo struct {
+	ChainExpiry      time.Duration
+	Subject          string
+	Issuer           string
+	Serial           string
+	Version          string
+	CipherSuite      string
+	HostnameMismatch bool
+	SelfSigned       bool
+	VerifyError      string
+}
+
+func (t TLSInfo) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Duration("chainExpiry", t.ChainExpiry),
+		slog.String("subject", t.Subject),
+		slog.String("issuer", t.Issuer),
+		slog.String("version", t.Version),
+	}
+	if t.VerifyError != "" {
+		attrs = append(attrs, slog.String("verifyError", t.VerifyError))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+type tlsMetrics struct {
+	chainExpiry      *prometheus.GaugeVec
+	certificateInfo  *prometheus.GaugeVec
+	hostnameMismatch *prometheus.GaugeVec
+	selfSigned       *prometheus.GaugeVec
+	valid            *prometheus.GaugeVec
+	verifyError      *prometheus.GaugeVec
+	connectionInfo   *prometheus.GaugeVec
+}
+
+func newTLSMetrics(namespace, subsystem string, labels map[string]string) tlsMetrics {
+	return tlsMetrics{
+		chainExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "certificate_chain_expiry_days",
+			Help:        "number of days before the first certificate in the chain expires",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		certificateInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "certificate_info",
+			Help:        "subject, issuer and serial number of the certificate",
+			ConstLabels: labels,
+		}, []string{"host", "subject", "issuer", "serial"}),
+		hostnameMismatch: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "certificate_hostname_mismatch",
+			Help:        "certificate is not valid for the target's hostname",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		selfSigned: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "certificate_self_signed",
+			Help:        "certificate is self-signed",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		valid: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "certificate_valid",
+			Help:        "certificate chain verifies against the trusted roots",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		verifyError: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "certificate_verify_error",
+			Help:        "reason why the certificate chain does not verify",
+			ConstLabels: labels,
+		}, []string{"host", "error"}),
+		connectionInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "tls_info",
+			Help:        "tls version and cipher suite of the connection",
+			ConstLabels: labels,
+		}, []string{"host", "version", "cipher"}),
+	}
+}
+
+func (m tlsMetrics) observe(host string, info TLSInfo) {
+	m.chainExpiry.WithLabelValues(host).Set(info.ChainExpiry.Hours() / 24)
+	m.certificateInfo.DeletePartialMatch(prometheus.Labels{"host": host})
+	m.certificateInfo.WithLabelValues(host, info.Subject, info.Issuer, info.Serial).Set(1)
+	m.hostnameMismatch.WithLabelValues(host).Set(float64(bool2int[info.HostnameMismatch]))
+	m.selfSigned.WithLabelValues(host).Set(float64(bool2int[info.SelfSigned]))
+	m.valid.WithLabelValues(host).Set(float64(bool2int[info.VerifyError == ""]))
+	m.verifyError.DeletePartialMatch(prometheus.Labels{"host": host})
+	if info.VerifyError != "" {
+		m.verifyError.WithLabelValues(host, info.VerifyError).Set(1)
+	}
+	m.connectionInfo.DeletePartialMatch(prometheus.Labels{"host": host})
+	if info.Version != "" {
+		m.connectionInfo.WithLabelValues(host, info.Version, info.CipherSuite).Set(1)
+	}
+}
+
+func (m tlsMetrics) forget(host string) {
+	labels := prometheus.Labels{"host": host}
+	m.chainExpiry.DeletePartialMatch(labels)
+	m.certificateInfo.DeletePartialMatch(labels)
+	m.hostnameMismatch.DeletePartialMatch(labels)
+	m.selfSigned.DeletePartialMatch(labels)
+	m.valid.DeletePartialMatch(labels)
+	m.verifyError.DeletePartialMatch(labels)
+	m.connectionInfo.DeletePartialMatch(labels)
+}
+
+func (m tlsMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.chainExpiry.Describe(ch)
+	m.certificateInfo.Describe(ch)
+	m.hostnameMismatch.Describe(ch)
+	m.selfSigned.Describe(ch)
+	m.valid.Describe(ch)
+	m.verifyError.Describe(ch)
+	m.connectionInfo.Describe(ch)
+}
+
+func (m tlsMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.chainExpiry.Collect(ch)
+	m.certificateInfo.Collect(ch)
+	m.hostnameMismatch.Collect(ch)
+	m.selfSigned.Collect(ch)
+	m.valid.Collect(ch)
+	m.verifyError.Collect(ch)
+	m.connectionInfo.Collect(ch)
+}
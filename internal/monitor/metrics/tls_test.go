@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/clambin/uptime/pkg/logtester"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHostMetrics_Observe_TLS(t *testing.T) {
+	metrics := NewHostMetrics("uptime", "monitor", nil)
+	metrics.Observe(Measurement{
+		Host:      "localhost",
+		Up:        true,
+		Code:      http.StatusOK,
+		IsTLS:     true,
+		TLSExpiry: 48 * time.Hour,
+		TLS: TLSInfo{
+			ChainExpiry:      24 * time.Hour,
+			Subject:          "CN=localhost",
+			Issuer:           "CN=localhost",
+			Serial:           "1234",
+			Version:          "TLS 1.3",
+			CipherSuite:      "TLS_AES_128_GCM_SHA256",
+			HostnameMismatch: true,
+			SelfSigned:       true,
+			VerifyError:      "unknown authority",
+		},
+	})
+
+	want := `
+# HELP uptime_monitor_certificate_chain_expiry_days number of days before the first certificate in the chain expires
+# TYPE uptime_monitor_certificate_chain_expiry_days gauge
+uptime_monitor_certificate_chain_expiry_days{host="localhost"} 1
+# HELP uptime_monitor_certificate_hostname_mismatch certificate is not valid for the target's hostname
+# TYPE uptime_monitor_certificate_hostname_mismatch gauge
+uptime_monitor_certificate_hostname_mismatch{host="localhost"} 1
+# HELP uptime_monitor_certificate_info subject, issuer and serial number of the certificate
+# TYPE uptime_monitor_certificate_info gauge
+uptime_monitor_certificate_info{host="localhost",issuer="CN=localhost",serial="1234",subject="CN=localhost"} 1
+# HELP uptime_monitor_certificate_self_signed certificate is self-signed
+# TYPE uptime_monitor_certificate_self_signed gauge
+uptime_monitor_certificate_self_signed{host="localhost"} 1
+# HELP uptime_monitor_certificate_valid certificate chain verifies against the trusted roots
+# TYPE uptime_monitor_certificate_valid gauge
+uptime_monitor_certificate_valid{host="localhost"} 0
+# HELP uptime_monitor_certificate_verify_error reason why the certificate chain does not verify
+# TYPE uptime_monitor_certificate_verify_error gauge
+uptime_monitor_certificate_verify_error{error="unknown authority",host="localhost"} 1
+# HELP uptime_monitor_tls_info tls version and cipher suite of the connection
+# TYPE uptime_monitor_tls_info gauge
+uptime_monitor_tls_info{cipher="TLS_AES_128_GCM_SHA256",host="localhost",version="TLS 1.3"} 1
+`
+	names := []string{
+		"uptime_monitor_certificate_chain_expiry_days",
+		"uptime_monitor_certificate_hostname_mismatch",
+		"uptime_monitor_certificate_info",
+		"uptime_monitor_certificate_self_signed",
+		"uptime_monitor_certificate_valid",
+		"uptime_monitor_certificate_verify_error",
+		"uptime_monitor_tls_info",
+	}
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(want), names...))
+
+	// certificate is replaced by a valid one
+	metrics.Observe(Measurement{
+		Host:      "localhost",
+		Up:        true,
+		Code:      http.StatusOK,
+		IsTLS:     true,
+		TLSExpiry: 48 * time.Hour,
+		TLS: TLSInfo{
+			ChainExpiry: 48 * time.Hour,
+			Subject:     "CN=localhost",
+			Issuer:      "CN=CA",
+			Serial:      "5678",
+			Version:     "TLS 1.3",
+			CipherSuite: "TLS_AES_128_GCM_SHA256",
+		},
+	})
+
+	want = `
+# HELP uptime_monitor_certificate_info subject, issuer and serial number of the certificate
+# TYPE uptime_monitor_certificate_info gauge
+uptime_monitor_certificate_info{host="localhost",issuer="CN=CA",serial="5678",subject="CN=localhost"} 1
+# HELP uptime_monitor_certificate_valid certificate chain verifies against the trusted roots
+# TYPE uptime_monitor_certificate_valid gauge
+uptime_monitor_certificate_valid{host="localhost"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(want),
+		"uptime_monitor_certificate_info", "uptime_monitor_certificate_valid", "uptime_monitor_certificate_verify_error",
+	))
+}
+
+func TestTLSInfo_LogValue(t *testing.T) {
+	var output bytes.Buffer
+	l := logtester.New(&output, slog.LevelInfo)
+
+	l.Info("tls", "tls", TLSInfo{ChainExpiry: time.Hour, Subject: "CN=localhost", Issuer: "CN=CA", Version: "TLS 1.2", VerifyError: "expired"})
+	assert.Equal(t, "level=INFO msg=tls tls.chainExpiry=1h0m0s tls.subject=\"CN=localhost\" tls.issuer=\"CN=CA\" tls.version=\"TLS 1.2\" tls.verifyError=expired\n", output.String())
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type uptimeMetrics struct {
+	slo         *prometheus.GaugeVec
+	ratio       *prometheus.GaugeVec
+	errorBudget *prometheus.GaugeVec
+	meanLatency *prometheus.GaugeVec
+}
+
+func newUptimeMetrics(namespace, subsystem string, labels map[string]string) uptimeMetrics {
+	return uptimeMetrics{
+		slo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "slo_target_ratio",
+			Help:        "target uptime ratio of the site",
+			ConstLabels: labels,
+		}, []string{"host"}),
+		ratio: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "uptime_ratio",
+			Help:        "ratio of checks that found the site up, over a rolling window",
+			ConstLabels: labels,
+		}, []string{"host", "window"}),
+		errorBudget: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "error_budget_remaining_ratio",
+			Help:        "fraction of the error budget left over a rolling window. negative if the slo is missed",
+			ConstLabels: labels,
+		}, []string{"host", "window"}),
+		meanLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "mean_latency_seconds",
+			Help:        "mean latency of the checks over a rolling window",
+			ConstLabels: labels,
+		}, []string{"host", "window"}),
+	}
+}
+
+func (m uptimeMetrics) observe(host string, slo float64, windows []handlers.Uptime) {
+	if len(windows) == 0 {
+		return
+	}
+	m.slo.WithLabelValues(host).Set(slo)
+	for _, window := range windows {
+		m.ratio.WithLabelValues(host, window.Window).Set(window.Ratio)
+		m.errorBudget.WithLabelValues(host, window.Window).Set(window.ErrorBudgetRemaining)
+		m.meanLatency.WithLabelValues(host, window.Window).Set(window.MeanLatency.Seconds())
+	}
+}
+
+func (m uptimeMetrics) forget(host string) {
+	labels := prometheus.Labels{"host": host}
+	m.slo.DeletePartialMatch(labels)
+	m.ratio.DeletePartialMatch(labels)
+	m.errorBudget.DeletePartialMatch(labels)
+	m.meanLatency.DeletePartialMatch(labels)
+}
+
+func (m uptimeMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.slo.Describe(ch)
+	m.ratio.Describe(ch)
+	m.errorBudget.Describe(ch)
+	m.meanLatency.Describe(ch)
+}
+
+func (m uptimeMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.slo.Collect(ch)
+	m.ratio.Collect(ch)
+	m.errorBudget.Collect(ch)
+	m.meanLatency.Collect(ch)
+}
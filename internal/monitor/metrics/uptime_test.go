@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHostMetrics_Observe_Uptime(t *testing.T) {
+	metrics := NewHostMetrics("uptime", "monitor", nil)
+	metrics.Observe(Measurement{Host: "localhost", Up: true, SLO: 0.99, Uptime: []handlers.Uptime{
+		{Window: "24h", Checks: 10, Ratio: 1, ErrorBudgetRemaining: 1, MeanLatency: 100 * time.Millisecond},
+		{Window: "7d", Checks: 20, Ratio: 0.995, ErrorBudgetRemaining: 0.5, MeanLatency: 200 * time.Millisecond},
+	}})
+
+	assert.NoError(t, testutil.CollectAndCompare(metrics, bytes.NewBufferString(`
+# HELP uptime_monitor_error_budget_remaining_ratio fraction of the error budget left over a rolling window. negative if the slo is missed
+# TYPE uptime_monitor_error_budget_remaining_ratio gauge
+uptime_monitor_error_budget_remaining_ratio{host="localhost",window="24h"} 1
+uptime_monitor_error_budget_remaining_ratio{host="localhost",window="7d"} 0.5
+# HELP uptime_monitor_mean_latency_seconds mean latency of the checks over a rolling window
+# TYPE uptime_monitor_mean_latency_seconds gauge
+uptime_monitor_mean_latency_seconds{host="localhost",window="24h"} 0.1
+uptime_monitor_mean_latency_seconds{host="localhost",window="7d"} 0.2
+# HELP uptime_monitor_slo_target_ratio target uptime ratio of the site
+# TYPE uptime_monitor_slo_target_ratio gauge
+uptime_monitor_slo_target_ratio{host="localhost"} 0.99
+# HELP uptime_monitor_uptime_ratio ratio of checks that found the site up, over a rolling window
+# TYPE uptime_monitor_uptime_ratio gauge
+uptime_monitor_uptime_ratio{host="localhost",window="24h"} 1
+uptime_monitor_uptime_ratio{host="localhost",window="7d"} 0.995
+`), "uptime_monitor_error_budget_remaining_ratio", "uptime_monitor_mean_latency_seconds", "uptime_monitor_slo_target_ratio", "uptime_monitor_uptime_ratio"))
+}
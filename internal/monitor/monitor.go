@@ -1,17 +1,100 @@
 package monitor
 
 import (
+	"context"
 	"github.com/clambin/uptime/internal/monitor/handlers"
 	"github.com/clambin/uptime/internal/monitor/hostcheckers"
+	"github.com/clambin/uptime/internal/monitor/maintenance"
 	"github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/clambin/uptime/internal/monitor/notifier"
+	"github.com/clambin/uptime/internal/monitor/status"
+	"log/slog"
 	"net/http"
 	"time"
 )
 
 const DefaultClientTimeout = 10 * time.Second
 
-func New(metrics *metrics.HostMetrics, httpClient *http.Client) http.Handler {
+// DefaultLeaseTTL is the time after which a target expires if it is not registered again. It is three times
+// the interval at which the agent resends its targets.
+const DefaultLeaseTTL = 15 * time.Minute
+
+// DefaultStartJitter is the default time over which the first check of new targets is spread.
+const DefaultStartJitter = 30 * time.Second
+
+type Monitor struct {
+	http.Handler
+	checkers *hostcheckers.HostCheckers
+}
+
+// Option configures how the monitor schedules its checks.
+type Option func(*hostcheckers.HostCheckers)
+
+// WithWorkers sets the number of checks that can run at the same time.
+func WithWorkers(workers int) Option {
+	return func(h *hostcheckers.HostCheckers) { h.Workers = workers }
+}
+
+// WithMaxInFlightPerHost sets the number of checks of the same host that can run at the same time (0: no limit).
+func WithMaxInFlightPerHost(maxInFlight int) Option {
+	return func(h *hostcheckers.HostCheckers) { h.MaxInFlightPerHost = maxInFlight }
+}
+
+// WithStartJitter spreads the first check of new targets over up to jitter, so a restart does not check all
+// targets at once.
+func WithStartJitter(jitter time.Duration) Option {
+	return func(h *hostcheckers.HostCheckers) { h.StartJitter = jitter }
+}
+
+// WithSLO sets the target uptime ratio of targets that do not set their own SLO.
+func WithSLO(slo float64) Option {
+	return func(h *hostcheckers.HostCheckers) { h.SLO = slo }
+}
+
+// WithAlerter sends notifications of the measurements of all targets to alerter.
+func WithAlerter(alerter *notifier.Alerter) Option {
+	return func(h *hostcheckers.HostCheckers) { h.Alerts = alerter }
+}
+
+// WithMaintenance sets the maintenance windows of the targets. By default, the monitor starts without maintenance
+// windows. Windows can be changed through the /maintenance API.
+func WithMaintenance(windows *maintenance.Windows) Option {
+	return func(h *hostcheckers.HostCheckers) { h.Maintenance = windows }
+}
+
+// New returns the monitor. If store is not nil, registered targets are persisted in the store and the
+// stored targets are checked right away.
+func New(metrics *metrics.HostMetrics, httpClient *http.Client, store hostcheckers.TargetStore, logger *slog.Logger, options ...Option) *Monitor {
+	checkers := hostcheckers.New(metrics, httpClient)
+	checkers.Store = store
+	for _, option := range options {
+		option(checkers)
+	}
+	if checkers.Maintenance == nil {
+		checkers.Maintenance = maintenance.New()
+	}
+	if err := checkers.Restore(logger); err != nil {
+		logger.Error("failed to restore targets", "err", err)
+	}
+	targets := handlers.TargetsHandler{TargetLister: checkers}
 	h := http.NewServeMux()
-	h.Handle("/target", handlers.TargetHandler{TargetManager: hostcheckers.New(metrics, httpClient)})
-	return h
+	h.Handle("/target", handlers.TargetHandler{TargetManager: checkers})
+	h.Handle("GET /targets", targets)
+	h.Handle("GET /targets/{host...}", targets)
+	h.Handle("PUT /targets", handlers.ReconcileHandler{TargetReconciler: checkers})
+	windows := handlers.MaintenanceHandler{MaintenanceManager: checkers.Maintenance}
+	h.Handle("GET /maintenance", windows)
+	h.Handle("PUT /maintenance/{id}", windows)
+	h.Handle("DELETE /maintenance/{id}", windows)
+	return &Monitor{Handler: h, checkers: checkers}
+}
+
+// StatusPage returns the HTML status page of the targets. Unlike the monitor's API, the page is meant to be public.
+func (m *Monitor) StatusPage(cfg status.Config) http.Handler {
+	return status.NewPage(cfg, m.checkers)
+}
+
+// ExpireLeases removes any target that has not been registered again within ttl, until ctx is canceled.
+func (m *Monitor) ExpireLeases(ctx context.Context, ttl time.Duration, logger *slog.Logger) {
+	m.checkers.ExpireLeases(ctx, ttl, logger)
 }
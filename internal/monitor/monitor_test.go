@@ -2,14 +2,21 @@ package monitor_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/clambin/uptime/internal/monitor"
 	"github.com/clambin/uptime/internal/monitor/handlers"
 	"github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/clambin/uptime/internal/monitor/status"
+	"github.com/clambin/uptime/internal/monitor/store"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -22,7 +29,7 @@ func TestMonitor(t *testing.T) {
 	hm := metrics.NewHostMetrics("uptime", "monitor", nil)
 	assert.NoError(t, testutil.CollectAndCompare(hm, bytes.NewBufferString(``)))
 
-	mon := monitor.New(hm, http.DefaultClient)
+	mon := monitor.New(hm, http.DefaultClient, nil, slog.Default())
 
 	req := handlers.Request{Target: h.URL, Interval: 10 * time.Millisecond}
 	r, _ := http.NewRequest(http.MethodPost, "/target?"+req.Encode(), nil)
@@ -58,10 +65,139 @@ uptime_monitor_up{host="`+h.URL+`"} 0
 	mon.ServeHTTP(w, r)
 	require.Equal(t, http.StatusOK, w.Code)
 
-	// FIXME: deleted targets will continue to be reported on!
-	assert.NoError(t, testutil.CollectAndCompare(hm, bytes.NewBufferString(`
-# HELP uptime_monitor_up site is up/down
-# TYPE uptime_monitor_up gauge
-uptime_monitor_up{host="`+h.URL+`"} 0
-`), "uptime_monitor_up"))
+	// deleted targets are no longer reported
+	assert.Zero(t, testutil.CollectAndCount(hm, "uptime_monitor_up"))
+}
+
+func TestMonitor_Targets(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer h.Close()
+
+	mon := monitor.New(metrics.NewHostMetrics("uptime", "monitor", nil), http.DefaultClient, nil, slog.Default())
+
+	req := handlers.Request{Target: h.URL, Interval: time.Hour}
+	r, _ := http.NewRequest(http.MethodPost, "/target?"+req.Encode(), nil)
+	w := httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Eventually(t, func() bool {
+		r, _ = http.NewRequest(http.MethodGet, "/targets/"+url.PathEscape(h.URL), nil)
+		w = httptest.NewRecorder()
+		mon.ServeHTTP(w, r)
+		var status map[string]any
+		return w.Code == http.StatusOK && json.Unmarshal(w.Body.Bytes(), &status) == nil && status["last_check"] != nil
+	}, time.Second, 20*time.Millisecond)
+
+	var status map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, h.URL, status["request"].(map[string]any)["target"])
+	assert.Equal(t, true, status["up"])
+	assert.Equal(t, true, status["last_check"].(map[string]any)["up"])
+	assert.Equal(t, 0.0, status["consecutive_failures"])
+
+	r, _ = http.NewRequest(http.MethodGet, "/targets", nil)
+	w = httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var targets []map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &targets))
+	require.Len(t, targets, 1)
+	assert.Equal(t, h.URL, targets[0]["request"].(map[string]any)["target"])
+
+	r, _ = http.NewRequest(http.MethodGet, "/targets/"+url.PathEscape("http://localhost:1"), nil)
+	w = httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMonitor_Store(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	hm := metrics.NewHostMetrics("uptime", "monitor", nil)
+
+	mon := monitor.New(hm, http.DefaultClient, store.NewFile(path), slog.Default())
+	req := handlers.Request{Target: "http://localhost:1", Interval: time.Hour}
+	r, _ := http.NewRequest(http.MethodPost, "/target?"+req.Encode(), nil)
+	w := httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// targets are written shortly after they change
+	assert.Eventually(t, func() bool {
+		requests, err := store.NewFile(path).Load()
+		return err == nil && len(requests) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// a restarted monitor resumes checking the stored targets
+	mon = monitor.New(hm, http.DefaultClient, store.NewFile(path), slog.Default())
+	r, _ = http.NewRequest(http.MethodGet, "/targets/"+url.PathEscape(req.Target), nil)
+	w = httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMonitor_Reconcile(t *testing.T) {
+	mon := monitor.New(metrics.NewHostMetrics("uptime", "monitor", nil), http.DefaultClient, nil, slog.Default())
+
+	req := handlers.Request{Target: "http://localhost:1", Interval: time.Hour}
+	body, err := json.Marshal(handlers.NewReconcileRequest("cluster", []handlers.Request{req}))
+	require.NoError(t, err)
+	r, _ := http.NewRequest(http.MethodPut, "/targets", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"added":1,"updated":0,"removed":0}`+"\n", w.Body.String())
+
+	body, err = json.Marshal(handlers.NewReconcileRequest("cluster", nil))
+	require.NoError(t, err)
+	r, _ = http.NewRequest(http.MethodPut, "/targets", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"added":0,"updated":0,"removed":1}`+"\n", w.Body.String())
+}
+
+func TestMonitor_Maintenance(t *testing.T) {
+	mon := monitor.New(metrics.NewHostMetrics("uptime", "monitor", nil), http.DefaultClient, nil, slog.Default())
+
+	r, _ := http.NewRequest(http.MethodPut, "/maintenance/backups", bytes.NewBufferString(`{"schedule":"0 2 * * sun","duration":"2h"}`))
+	w := httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	r, _ = http.NewRequest(http.MethodGet, "/maintenance", nil)
+	w = httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var windows []handlers.MaintenanceWindow
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&windows))
+	assert.Equal(t, []handlers.MaintenanceWindow{{ID: "backups", Schedule: "0 2 * * sun", Duration: 2 * time.Hour}}, windows)
+
+	r, _ = http.NewRequest(http.MethodDelete, "/maintenance/backups", nil)
+	w = httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMonitor_StatusPage(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer h.Close()
+
+	mon := monitor.New(metrics.NewHostMetrics("uptime", "monitor", nil), http.DefaultClient, nil, slog.Default())
+	req := handlers.Request{Target: h.URL, Interval: 10 * time.Millisecond}
+	r, _ := http.NewRequest(http.MethodPost, "/target?"+req.Encode(), nil)
+	w := httptest.NewRecorder()
+	mon.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	page := mon.StatusPage(status.Config{Title: "Example", Groups: []status.Group{{Name: "Websites", Targets: []string{"http://*"}}}})
+	assert.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		page.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+		return w.Code == http.StatusOK && strings.Contains(w.Body.String(), `<span class="name">`+h.URL+`</span><span class="state up">up</span>`)
+	}, time.Second, 20*time.Millisecond)
 }
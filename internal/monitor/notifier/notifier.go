@@ -0,0 +1,239 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/clambin/uptime/pkg/retry"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// EventType is the reason for a notification.
+type EventType string
+
+const (
+	EventDown              EventType = "down"
+	EventUp                EventType = "up"
+	EventCertificateExpiry EventType = "certificate_expiry"
+)
+
+// Event is a change of a target that should be notified.
+type Event struct {
+	Type   EventType `json:"type"`
+	Target string    `json:"target"`
+	Time   time.Time `json:"time"`
+	// Code and Latency are those of the check that changed the state, if the target responded. Reason is set for
+	// EventDown. Downtime is the time that the target was down and is set for EventUp.
+	Reason   string        `json:"reason,omitempty"`
+	Code     int           `json:"code,omitempty"`
+	Latency  time.Duration `json:"-"`
+	Downtime time.Duration `json:"-"`
+	// Expiry and DaysLeft are set for EventCertificateExpiry.
+	Expiry   *time.Time `json:"expiry,omitempty"`
+	DaysLeft int        `json:"days_left,omitempty"`
+}
+
+// MarshalJSON encodes Latency and Downtime as strings.
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	return json.Marshal(struct {
+		event
+		Latency  string `json:"latency,omitempty"`
+		Downtime string `json:"downtime,omitempty"`
+	}{event: event(e), Latency: durationString(e.Latency), Downtime: durationString(e.Downtime)})
+}
+
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// Message returns a human-readable summary of the event.
+func (e Event) Message() string {
+	switch e.Type {
+	case EventDown:
+		if e.Reason != "" {
+			return fmt.Sprintf("%s is down: %s", e.Target, e.Reason)
+		}
+		return e.Target + " is down"
+	case EventUp:
+		if e.Downtime > 0 {
+			return fmt.Sprintf("%s is up after %s", e.Target, e.Downtime.Round(time.Second))
+		}
+		return e.Target + " is up"
+	case EventCertificateExpiry:
+		return fmt.Sprintf("certificate of %s expires in %d days", e.Target, e.DaysLeft)
+	default:
+		return fmt.Sprintf("%s: %s", e.Target, e.Type)
+	}
+}
+
+// Notifier delivers an event, e.g. to a webhook.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// queueSize is the number of events per notifier that can wait to be delivered. Further events are dropped.
+const queueSize = 100
+
+// Alerter turns measurements into events and delivers them to its notifiers. Targets that go down or come back up
+// are notified, as are certificates that expire within CertificateExpiryDays. Each notifier delivers its events
+// in the background, so a slow notifier does not delay the checks, or the other notifiers.
+type Alerter struct {
+	notifiers []Notifier
+	queues    []chan Event
+	// CertificateExpiryDays is the number of days before its expiry that a certificate is notified (0: disabled).
+	CertificateExpiryDays int
+	logger                *slog.Logger
+	lock                  sync.Mutex
+	// certificates holds the days left of each target's certificate that was last queued, so every check of the
+	// target does not queue the same event again.
+	certificates map[string]int
+}
+
+func NewAlerter(logger *slog.Logger, notifiers ...Notifier) *Alerter {
+	a := Alerter{
+		notifiers:    notifiers,
+		queues:       make([]chan Event, len(notifiers)),
+		logger:       logger,
+		certificates: make(map[string]int),
+	}
+	for i := range a.queues {
+		a.queues[i] = make(chan Event, queueSize)
+	}
+	return &a
+}
+
+// Observe queues the events of the measurement. Measurements made during maintenance are not notified.
+func (a *Alerter) Observe(m metrics.Measurement) {
+	if m.Maintenance {
+		return
+	}
+	now := time.Now()
+	if m.Transition {
+		event := Event{Type: EventUp, Target: m.Host, Time: now, Code: m.Code, Latency: m.Latency, Downtime: m.Downtime}
+		if !m.Up {
+			event.Type, event.Reason = EventDown, m.Reason
+		}
+		a.queue(event)
+	}
+	if m.IsTLS && a.CertificateExpiryDays > 0 {
+		a.observeCertificate(m, now)
+	}
+}
+
+// observeCertificate queues an event when the certificate of the target enters the expiry window, and again each
+// day it gets closer to its expiry.
+func (a *Alerter) observeCertificate(m metrics.Measurement, now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if m.TLSExpiry >= time.Duration(a.CertificateExpiryDays)*24*time.Hour {
+		delete(a.certificates, m.Host)
+		return
+	}
+	daysLeft := max(int(m.TLSExpiry.Hours()/24), 0)
+	if last, ok := a.certificates[m.Host]; ok && last == daysLeft {
+		return
+	}
+	a.certificates[m.Host] = daysLeft
+	expiry := now.Add(m.TLSExpiry).Truncate(time.Second)
+	a.queue(Event{
+		Type:     EventCertificateExpiry,
+		Target:   m.Host,
+		Time:     now,
+		Expiry:   &expiry,
+		DaysLeft: daysLeft,
+	})
+}
+
+func (a *Alerter) queue(event Event) {
+	for i := range a.queues {
+		select {
+		case a.queues[i] <- event:
+		default:
+			a.logger.Warn("notification queue full. dropping event", "target", event.Target, "type", event.Type)
+		}
+	}
+}
+
+// Run delivers the queued events until ctx is canceled.
+func (a *Alerter) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(len(a.notifiers))
+	for i := range a.notifiers {
+		go func(notifier Notifier, events <-chan Event) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-events:
+					if err := notifier.Notify(ctx, event); err != nil {
+						a.logger.Error("failed to send notification", "target", event.Target, "type", event.Type, "err", err)
+					}
+				}
+			}
+		}(a.notifiers[i], a.queues[i])
+	}
+	wg.Wait()
+}
+
+// deliver calls send until it succeeds, fails with an error that is not retryable, or has been called maxAttempts times.
+// The wait before the first retry is wait. It doubles with every retry.
+func deliver(ctx context.Context, maxAttempts int, wait time.Duration, send func() (retryable bool, err error)) error {
+	waiter := retry.MultiplyingWaiter{InitialWait: wait, MaxWait: 32 * wait, Factor: 2}
+	for attempt := 1; ; attempt++ {
+		retryable, err := send()
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= max(maxAttempts, 1) {
+			return err
+		}
+		if waiter.Wait(ctx) != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// deduper drops events that repeat the last event of the target. Up and down events share their history, so a target
+// that goes down again after it came back up is notified again.
+type deduper struct {
+	lock sync.Mutex
+	last map[string]sent
+}
+
+type sent struct {
+	eventType EventType
+	time      time.Time
+}
+
+func dedupeKey(event Event) string {
+	if event.Type == EventUp || event.Type == EventDown {
+		return event.Target + "/state"
+	}
+	return event.Target + "/" + string(event.Type)
+}
+
+// duplicate returns true if the event repeats the last event of the target sent within window.
+func (d *deduper) duplicate(event Event, window time.Duration) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	last, ok := d.last[dedupeKey(event)]
+	return ok && last.eventType == event.Type && event.Time.Sub(last.time) < window
+}
+
+// sent records that the event was delivered.
+func (d *deduper) sent(event Event) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.last == nil {
+		d.last = make(map[string]sent)
+	}
+	d.last[dedupeKey(event)] = sent{eventType: event.Type, time: event.Time}
+}
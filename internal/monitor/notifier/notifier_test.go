@@ -0,0 +1,160 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"github.com/clambin/uptime/internal/monitor/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAlerter_Observe(t *testing.T) {
+	tests := []struct {
+		name        string
+		measurement metrics.Measurement
+		want        []Event
+	}{
+		{
+			name:        "no change",
+			measurement: metrics.Measurement{Host: "example.com", Up: true},
+		},
+		{
+			name:        "down",
+			measurement: metrics.Measurement{Host: "example.com", Transition: true, Reason: "invalid status code", Code: 502},
+			want:        []Event{{Type: EventDown, Target: "example.com", Reason: "invalid status code", Code: 502}},
+		},
+		{
+			name:        "up",
+			measurement: metrics.Measurement{Host: "example.com", Up: true, Transition: true},
+			want:        []Event{{Type: EventUp, Target: "example.com"}},
+		},
+		{
+			name:        "maintenance",
+			measurement: metrics.Measurement{Host: "example.com", Up: true, Maintenance: true, IsTLS: true, TLSExpiry: time.Hour},
+		},
+		{
+			name:        "certificate valid",
+			measurement: metrics.Measurement{Host: "example.com", Up: true, IsTLS: true, TLSExpiry: 30 * 24 * time.Hour},
+		},
+		{
+			name:        "certificate expiring",
+			measurement: metrics.Measurement{Host: "example.com", Up: true, IsTLS: true, TLSExpiry: 5*24*time.Hour + time.Hour},
+			want:        []Event{{Type: EventCertificateExpiry, Target: "example.com", DaysLeft: 5}},
+		},
+		{
+			name:        "certificate expired",
+			measurement: metrics.Measurement{Host: "example.com", Transition: true, Reason: "certificate invalid", IsTLS: true, TLSExpiry: -time.Hour},
+			want: []Event{
+				{Type: EventDown, Target: "example.com", Reason: "certificate invalid"},
+				{Type: EventCertificateExpiry, Target: "example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var n recorder
+			a := NewAlerter(slog.Default(), &n)
+			a.CertificateExpiryDays = 14
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			go a.Run(ctx)
+
+			a.Observe(tt.measurement)
+			if len(tt.want) == 0 {
+				assert.Never(t, func() bool { return len(n.received()) > 0 }, 50*time.Millisecond, 10*time.Millisecond)
+				return
+			}
+			assert.Eventually(t, func() bool { return len(n.received()) == len(tt.want) }, time.Second, 10*time.Millisecond)
+			got := n.received()
+			for i := range got {
+				assert.False(t, got[i].Time.IsZero())
+				assert.Equal(t, got[i].Type == EventCertificateExpiry, got[i].Expiry != nil)
+				got[i].Time, got[i].Expiry = time.Time{}, nil
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAlerter_Observe_Disabled(t *testing.T) {
+	var n recorder
+	a := NewAlerter(slog.Default(), &n)
+	a.Observe(metrics.Measurement{Host: "example.com", Up: true, IsTLS: true, TLSExpiry: time.Hour})
+	assert.Empty(t, a.queues[0])
+}
+
+func TestAlerter_Observe_CertificateRepeats(t *testing.T) {
+	var n recorder
+	a := NewAlerter(slog.Default(), &n)
+	a.CertificateExpiryDays = 14
+	observe := func(host string, expiry time.Duration) {
+		a.Observe(metrics.Measurement{Host: host, Up: true, IsTLS: true, TLSExpiry: expiry})
+	}
+
+	// hosts sharing a certificate are each notified once
+	for range 10 {
+		for i := range 50 {
+			observe(fmt.Sprintf("%d.example.com", i), 5*24*time.Hour+time.Hour)
+		}
+	}
+	assert.Len(t, a.queues[0], 50)
+
+	// a new event is queued once the certificate is a day closer to its expiry
+	observe("0.example.com", 4*24*time.Hour+time.Hour)
+	observe("0.example.com", 4*24*time.Hour)
+	assert.Len(t, a.queues[0], 51)
+
+	// a renewed certificate is notified again once it enters the window again
+	observe("0.example.com", 90*24*time.Hour)
+	observe("0.example.com", 4*24*time.Hour)
+	assert.Len(t, a.queues[0], 52)
+
+	// state changes are not crowded out
+	a.Observe(metrics.Measurement{Host: "0.example.com", Transition: true, IsTLS: true, TLSExpiry: 4 * 24 * time.Hour})
+	require.Len(t, a.queues[0], 53)
+}
+
+func TestEvent_Message(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{event: Event{Type: EventDown, Target: "example.com"}, want: "example.com is down"},
+		{event: Event{Type: EventDown, Target: "example.com", Reason: "connection failed"}, want: "example.com is down: connection failed"},
+		{event: Event{Type: EventUp, Target: "example.com"}, want: "example.com is up"},
+		{event: Event{Type: EventCertificateExpiry, Target: "example.com", DaysLeft: 3}, want: "certificate of example.com expires in 3 days"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, tt.event.Message())
+		})
+	}
+}
+
+var _ Notifier = &recorder{}
+
+// recorder records the events it is notified of.
+type recorder struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Notify(_ context.Context, event Event) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recorder) received() []Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Event(nil), r.events...)
+}
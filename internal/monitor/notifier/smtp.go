@@ -0,0 +1,198 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Default templates of the subject and body of emails.
+const (
+	DefaultSubject = `[uptime] {{ .Message }}`
+	DefaultBody    = `{{ .Message }}
+
+Target:   {{ .Target }}
+Status:   {{ .Type }}
+{{ with .Code }}Code:     {{ . }}
+{{ end }}{{ with .Reason }}Reason:   {{ . }}
+{{ end }}{{ with .Latency }}Latency:  {{ . }}
+{{ end }}{{ with .Downtime }}Downtime: {{ . }}
+{{ end }}{{ with .Expiry }}Expiry:   {{ .Format "2006-01-02 15:04:05 MST" }}
+{{ end }}Time:     {{ .Time.Format "2006-01-02 15:04:05 MST" }}
+`
+)
+
+var _ Notifier = &SMTP{}
+
+// SMTP emails events. If the server supports STARTTLS, the connection is encrypted before authenticating. The
+// subject and body are templates, executed with the event.
+type SMTP struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	From string
+	To   []string
+	// Username and Password authenticate with the server. If Username is empty, no authentication is done.
+	Username string
+	Password string
+	// RequireTLS fails delivery if the server does not support STARTTLS. TLSConfig configures STARTTLS.
+	RequireTLS bool
+	TLSConfig  *tls.Config
+	Timeout    time.Duration
+	// MaxAttempts, RetryWait and DedupeWindow work as for Webhook.
+	MaxAttempts  int
+	RetryWait    time.Duration
+	DedupeWindow time.Duration
+	dedupe       deduper
+	subject      *template.Template
+	body         *template.Template
+}
+
+// NewSMTP returns a notifier that emails events through the server at addr. Empty templates use DefaultSubject
+// and DefaultBody.
+func NewSMTP(addr string, from string, to []string, subject string, body string) (*SMTP, error) {
+	if len(to) == 0 {
+		return nil, errors.New("smtp: no recipients")
+	}
+	s := SMTP{
+		Addr:         addr,
+		From:         from,
+		To:           to,
+		Timeout:      defaultTimeout,
+		MaxAttempts:  DefaultMaxAttempts,
+		RetryWait:    DefaultRetryWait,
+		DedupeWindow: DefaultDedupeWindow,
+	}
+	var err error
+	if s.subject, err = template.New("subject").Funcs(templateFuncs).Parse(defaultIfEmpty(subject, DefaultSubject)); err != nil {
+		return nil, fmt.Errorf("smtp subject: %w", err)
+	}
+	if s.body, err = template.New("body").Funcs(templateFuncs).Parse(defaultIfEmpty(body, DefaultBody)); err != nil {
+		return nil, fmt.Errorf("smtp body: %w", err)
+	}
+	return &s, nil
+}
+
+const defaultTimeout = 10 * time.Second
+
+func defaultIfEmpty(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// Notify emails the event. Failed deliveries are retried up to MaxAttempts, unless the server rejects the email.
+func (s *SMTP) Notify(ctx context.Context, event Event) error {
+	if s.dedupe.duplicate(event, s.DedupeWindow) {
+		return nil
+	}
+	msg, err := s.message(event)
+	if err != nil {
+		return err
+	}
+	if err = deliver(ctx, s.MaxAttempts, s.RetryWait, func() (bool, error) { return s.send(ctx, msg) }); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	s.dedupe.sent(event)
+	return nil
+}
+
+func (s *SMTP) message(event Event) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := s.subject.Execute(&subject, event); err != nil {
+		return nil, fmt.Errorf("smtp subject: %w", err)
+	}
+	if err := s.body.Execute(&body, event); err != nil {
+		return nil, fmt.Errorf("smtp body: %w", err)
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		// headers are a single line
+		value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+		msg.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", s.From)
+	header("To", strings.Join(s.To, ", "))
+	header("Subject", strings.TrimSpace(subject.String()))
+	header("Date", event.Time.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	msg.WriteString("\r\n")
+	// the body must use CRLF line endings
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body.String(), "\r\n", "\n"), "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
+
+// send emails the message. If it fails, send reports whether sending the message again may succeed.
+func (s *SMTP) send(ctx context.Context, msg []byte) (bool, error) {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return false, err
+	}
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return true, err
+	}
+	if s.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return retryable(err), err
+	}
+	defer func() { _ = c.Close() }()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		cfg := s.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: host}
+		}
+		if err = c.StartTLS(cfg); err != nil {
+			return retryable(err), fmt.Errorf("starttls: %w", err)
+		}
+	} else if s.RequireTLS {
+		return false, errors.New("server does not support STARTTLS")
+	}
+	if s.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return retryable(err), fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err = c.Mail(s.From); err != nil {
+		return retryable(err), err
+	}
+	for _, to := range s.To {
+		if err = c.Rcpt(to); err != nil {
+			return retryable(err), err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return retryable(err), err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return true, err
+	}
+	if err = w.Close(); err != nil {
+		return retryable(err), err
+	}
+	_ = c.Quit()
+	return false, nil
+}
+
+// retryable returns false if the server rejected the command permanently (5xx).
+func retryable(err error) bool {
+	var protoErr *textproto.Error
+	return !errors.As(err, &protoErr) || protoErr.Code < 500
+}
@@ -0,0 +1,283 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSMTP_Notify(t *testing.T) {
+	eventTime := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		startTLS    bool
+		auth        bool
+		requireTLS  bool
+		subject     string
+		event       Event
+		wantErr     assert.ErrorAssertionFunc
+		wantSubject string
+		wantBody    []string
+	}{
+		{
+			name:        "down",
+			event:       Event{Type: EventDown, Target: "https://example.com", Time: eventTime, Code: 502, Reason: "invalid status code", Latency: 150 * time.Millisecond},
+			wantErr:     assert.NoError,
+			wantSubject: "[uptime] https://example.com is down: invalid status code",
+			wantBody:    []string{"Status:   down", "Code:     502", "Reason:   invalid status code", "Latency:  150ms", "Time:     2024-03-01 12:00:00 UTC"},
+		},
+		{
+			name:        "up",
+			event:       Event{Type: EventUp, Target: "https://example.com", Time: eventTime, Code: 200, Downtime: 5 * time.Minute},
+			wantErr:     assert.NoError,
+			wantSubject: "[uptime] https://example.com is up after 5m0s",
+			wantBody:    []string{"Status:   up", "Downtime: 5m0s"},
+		},
+		{
+			name:        "starttls and auth",
+			startTLS:    true,
+			auth:        true,
+			requireTLS:  true,
+			event:       Event{Type: EventUp, Target: "https://example.com", Time: eventTime},
+			wantErr:     assert.NoError,
+			wantSubject: "[uptime] https://example.com is up",
+		},
+		{
+			name:        "custom subject",
+			subject:     "{{ .Target }} {{ .Type }}\n",
+			event:       Event{Type: EventDown, Target: "example.com", Time: eventTime},
+			wantErr:     assert.NoError,
+			wantSubject: "example.com down",
+		},
+		{
+			name:       "tls required",
+			requireTLS: true,
+			event:      Event{Type: EventUp, Target: "example.com", Time: eventTime},
+			wantErr:    assert.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := newSMTPServer(t, tt.startTLS)
+			n, err := NewSMTP(s.addr(), "uptime@example.com", []string{"ops@example.com", "oncall@example.com"}, tt.subject, "")
+			require.NoError(t, err)
+			n.RequireTLS = tt.requireTLS
+			n.TLSConfig = s.clientTLSConfig()
+			n.RetryWait = time.Millisecond
+			if tt.auth {
+				n.Username, n.Password = "user", "secret"
+			}
+
+			tt.wantErr(t, n.Notify(context.Background(), tt.event))
+			if tt.wantSubject == "" {
+				assert.Empty(t, s.messages())
+				return
+			}
+			require.Len(t, s.messages(), 1)
+			msg := s.messages()[0]
+			assert.Equal(t, "uptime@example.com", msg.from)
+			assert.Equal(t, []string{"ops@example.com", "oncall@example.com"}, msg.to)
+			assert.Equal(t, tt.startTLS, msg.tls)
+			if tt.auth {
+				assert.Equal(t, "\x00user\x00secret", msg.auth)
+			}
+			assert.Contains(t, msg.data, "\r\nSubject: "+tt.wantSubject+"\r\n")
+			for _, line := range tt.wantBody {
+				assert.Contains(t, msg.data, "\r\n"+line+"\r\n")
+			}
+		})
+	}
+}
+
+func TestSMTP_Notify_Retry(t *testing.T) {
+	s := newSMTPServer(t, false)
+	s.failures = 1
+	n, err := NewSMTP(s.addr(), "uptime@example.com", []string{"ops@example.com"}, "", "")
+	require.NoError(t, err)
+	n.RetryWait = time.Millisecond
+
+	require.NoError(t, n.Notify(context.Background(), Event{Type: EventDown, Target: "example.com", Time: time.Now()}))
+	assert.Len(t, s.messages(), 1)
+}
+
+func TestNewSMTP(t *testing.T) {
+	_, err := NewSMTP("localhost:25", "uptime@example.com", nil, "", "")
+	assert.Error(t, err)
+	_, err = NewSMTP("localhost:25", "uptime@example.com", []string{"ops@example.com"}, "{{ .Target", "")
+	assert.Error(t, err)
+	_, err = NewSMTP("localhost:25", "uptime@example.com", []string{"ops@example.com"}, "", "{{ .Target")
+	assert.Error(t, err)
+}
+
+// smtpServer is a minimal SMTP server that records the emails it receives. It rejects the first failures emails
+// with a temporary error.
+type smtpServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	cert      *x509.Certificate
+	failures  int
+	lock      sync.Mutex
+	received  []smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	auth string
+	tls  bool
+	data string
+}
+
+func newSMTPServer(t *testing.T, startTLS bool) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := smtpServer{listener: l}
+	if startTLS {
+		s.tlsConfig, s.cert = selfSignedTLS(t)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return &s
+}
+
+func (s *smtpServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *smtpServer) clientTLSConfig() *tls.Config {
+	if s.cert == nil {
+		return nil
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(s.cert)
+	return &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+func (s *smtpServer) messages() []smtpMessage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.received
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	var msg smtpMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost")
+			if s.tlsConfig != nil && !msg.tls {
+				_ = tp.PrintfLine("250-STARTTLS")
+			}
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			msg.tls = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			msg.auth = string(credentials)
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := readData(tp.R)
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			if s.failures > 0 {
+				s.failures--
+				_ = tp.PrintfLine("451 try again later")
+			} else {
+				msg.data = data
+				s.received = append(s.received, msg)
+				_ = tp.PrintfLine("250 OK")
+			}
+			s.lock.Unlock()
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// readData reads the message up to the terminating line, keeping the CRLF line endings.
+func readData(r *bufio.Reader) (string, error) {
+	var data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" {
+			return data.String(), nil
+		}
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+func selfSignedTLS(t *testing.T) (*tls.Config, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, cert
+}
@@ -0,0 +1,123 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// Default webhook settings.
+const (
+	DefaultMaxAttempts  = 3
+	DefaultRetryWait    = time.Second
+	DefaultDedupeWindow = 24 * time.Hour
+)
+
+var _ Notifier = &Webhook{}
+
+// Webhook posts events as JSON to a URL. By default, the payload is the JSON encoding of the event. If a payload
+// template is set, the template is executed with the event and must produce valid JSON. Besides the fields of the
+// event, templates can use .Message and the json function, which encodes a value as JSON, e.g.
+//
+//	{"text": {{ json .Message }}}
+type Webhook struct {
+	URL        string
+	Headers    http.Header
+	HTTPClient *http.Client
+	// MaxAttempts is the number of times an event is sent before it is dropped. RetryWait is the time to wait
+	// before the first retry. It doubles with every retry.
+	MaxAttempts int
+	RetryWait   time.Duration
+	// DedupeWindow is the time during which an event that repeats the last event of the target is not sent again.
+	DedupeWindow time.Duration
+	dedupe       deduper
+	template     *template.Template
+}
+
+// NewWebhook returns a webhook that posts events to url. If payload is not empty, it is the template of the payload.
+func NewWebhook(url string, payload string) (*Webhook, error) {
+	w := Webhook{
+		URL:          url,
+		HTTPClient:   http.DefaultClient,
+		MaxAttempts:  DefaultMaxAttempts,
+		RetryWait:    DefaultRetryWait,
+		DedupeWindow: DefaultDedupeWindow,
+	}
+	if payload != "" {
+		var err error
+		if w.template, err = template.New("payload").Funcs(templateFuncs).Parse(payload); err != nil {
+			return nil, fmt.Errorf("payload: %w", err)
+		}
+	}
+	return &w, nil
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Notify posts the event. Failed deliveries are retried up to MaxAttempts, unless the receiver rejects the event.
+func (w *Webhook) Notify(ctx context.Context, event Event) error {
+	if w.dedupe.duplicate(event, w.DedupeWindow) {
+		return nil
+	}
+	payload, err := w.payload(event)
+	if err != nil {
+		return err
+	}
+
+	if err = deliver(ctx, w.MaxAttempts, w.RetryWait, func() (bool, error) { return w.post(ctx, payload) }); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	w.dedupe.sent(event)
+	return nil
+}
+
+func (w *Webhook) payload(event Event) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(event)
+	}
+	var b bytes.Buffer
+	if err := w.template.Execute(&b, event); err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	if !json.Valid(b.Bytes()) {
+		return nil, errors.New("payload: invalid json")
+	}
+	return b.Bytes(), nil
+}
+
+// post sends the payload. If it fails, post reports whether sending the payload again may succeed.
+func (w *Webhook) post(ctx context.Context, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range w.Headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, errors.New(resp.Status)
+	default:
+		return false, errors.New(resp.Status)
+	}
+}
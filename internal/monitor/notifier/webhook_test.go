@@ -0,0 +1,172 @@
+package notifier
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	eventTime := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		payload  string
+		event    Event
+		want     string
+		wantErr  assert.ErrorAssertionFunc
+		wantSent int
+	}{
+		{
+			name:     "default",
+			event:    Event{Type: EventDown, Target: "https://example.com", Time: eventTime, Reason: "invalid status code", Code: http.StatusBadGateway, Latency: 150 * time.Millisecond},
+			want:     `{"type":"down","target":"https://example.com","time":"2024-03-01T12:00:00Z","reason":"invalid status code","code":502,"latency":"150ms"}`,
+			wantErr:  assert.NoError,
+			wantSent: 1,
+		},
+		{
+			name:     "template",
+			payload:  `{"text":{{ json .Message }},"up":{{ eq .Type "up" }}}`,
+			event:    Event{Type: EventUp, Target: "https://example.com", Time: eventTime},
+			want:     `{"text":"https://example.com is up","up":true}`,
+			wantErr:  assert.NoError,
+			wantSent: 1,
+		},
+		{
+			name:    "invalid json",
+			payload: `{"text":{{ .Message }}}`,
+			event:   Event{Type: EventUp, Target: "https://example.com", Time: eventTime},
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var r receiver
+			s := httptest.NewServer(&r)
+			t.Cleanup(s.Close)
+
+			w, err := NewWebhook(s.URL, tt.payload)
+			require.NoError(t, err)
+			tt.wantErr(t, w.Notify(context.Background(), tt.event))
+			assert.Len(t, r.payloads(), tt.wantSent)
+			if tt.want != "" {
+				assert.JSONEq(t, tt.want, r.payloads()[0])
+			}
+		})
+	}
+}
+
+func TestNewWebhook_InvalidTemplate(t *testing.T) {
+	_, err := NewWebhook("http://localhost", `{{ .Message `)
+	assert.Error(t, err)
+}
+
+func TestWebhook_Notify_Retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		status    int
+		wantErr   assert.ErrorAssertionFunc
+		wantCalls int
+	}{
+		{name: "recovers", failures: 2, status: http.StatusServiceUnavailable, wantErr: assert.NoError, wantCalls: 3},
+		{name: "gives up", failures: 5, status: http.StatusServiceUnavailable, wantErr: assert.Error, wantCalls: 3},
+		{name: "rate limited", failures: 1, status: http.StatusTooManyRequests, wantErr: assert.NoError, wantCalls: 2},
+		{name: "rejected", failures: 1, status: http.StatusBadRequest, wantErr: assert.Error, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := receiver{failures: tt.failures, status: tt.status}
+			s := httptest.NewServer(&r)
+			t.Cleanup(s.Close)
+
+			w, err := NewWebhook(s.URL, "")
+			require.NoError(t, err)
+			w.RetryWait = time.Millisecond
+			tt.wantErr(t, w.Notify(context.Background(), Event{Type: EventDown, Target: "example.com", Time: time.Now()}))
+			assert.Equal(t, tt.wantCalls, r.callCount())
+		})
+	}
+}
+
+func TestWebhook_Notify_Dedupe(t *testing.T) {
+	var r receiver
+	s := httptest.NewServer(&r)
+	t.Cleanup(s.Close)
+
+	w, err := NewWebhook(s.URL, `{"type":{{ json .Type }}}`)
+	require.NoError(t, err)
+	w.DedupeWindow = time.Hour
+
+	now := time.Now()
+	for i, eventType := range []EventType{EventDown, EventDown, EventUp, EventDown, EventCertificateExpiry, EventCertificateExpiry} {
+		require.NoError(t, w.Notify(context.Background(), Event{Type: eventType, Target: "example.com", Time: now.Add(time.Duration(i) * time.Minute)}))
+	}
+	// outside the window, a repeated event is sent again
+	require.NoError(t, w.Notify(context.Background(), Event{Type: EventCertificateExpiry, Target: "example.com", Time: now.Add(2 * time.Hour)}))
+	// events of other targets are not duplicates
+	require.NoError(t, w.Notify(context.Background(), Event{Type: EventDown, Target: "example.org", Time: now}))
+
+	want := []string{`{"type":"down"}`, `{"type":"up"}`, `{"type":"down"}`, `{"type":"certificate_expiry"}`, `{"type":"certificate_expiry"}`, `{"type":"down"}`}
+	assert.Equal(t, want, r.payloads())
+}
+
+func TestWebhook_Notify_Headers(t *testing.T) {
+	var r receiver
+	s := httptest.NewServer(&r)
+	t.Cleanup(s.Close)
+
+	w, err := NewWebhook(s.URL, "")
+	require.NoError(t, err)
+	w.Headers = http.Header{"Authorization": []string{"Bearer secret"}}
+	require.NoError(t, w.Notify(context.Background(), Event{Type: EventUp, Target: "example.com", Time: time.Now()}))
+
+	assert.Equal(t, "Bearer secret", r.lastHeader.Get("Authorization"))
+	assert.Equal(t, "application/json", r.lastHeader.Get("Content-Type"))
+}
+
+var _ http.Handler = &receiver{}
+
+// receiver records the payloads it receives. It fails the first failures calls with status.
+type receiver struct {
+	failures   int
+	status     int
+	lock       sync.Mutex
+	calls      int
+	received   []string
+	lastHeader http.Header
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls++
+	if r.calls <= r.failures {
+		w.WriteHeader(r.status)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	r.received = append(r.received, string(body))
+	r.lastHeader = req.Header.Clone()
+}
+
+func (r *receiver) payloads() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.received
+}
+
+func (r *receiver) callCount() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.calls
+}
@@ -0,0 +1,262 @@
+package status
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/clambin/uptime/internal/monitor/glob"
+	"github.com/clambin/uptime/pkg/logger"
+	"gopkg.in/yaml.v3"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Days is the number of days of uptime shown for each target.
+const Days = 90
+
+// maxIncidents is the number of recent incidents shown on the page.
+const maxIncidents = 10
+
+// Config configures the status page. Each target is shown in the first group with a matching pattern. Targets that
+// do not match any group are not shown, so the page only shows the targets that are explicitly listed.
+type Config struct {
+	Title  string  `yaml:"title"`
+	Groups []Group `yaml:"groups"`
+}
+
+// Group is a named group of targets. Targets holds glob patterns of the targets in the group.
+type Group struct {
+	Name    string   `yaml:"name"`
+	Targets []string `yaml:"targets"`
+}
+
+// LoadConfig reads the configuration of the status page from a YAML file. The configuration needs at least one group.
+func LoadConfig(r io.Reader) (Config, error) {
+	var cfg Config
+	if err := yaml.NewDecoder(r).Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("decode: %w", err)
+	}
+	if len(cfg.Groups) == 0 {
+		return Config{}, errors.New("no groups: the status page would not show any targets")
+	}
+	for _, group := range cfg.Groups {
+		if group.Name == "" {
+			return Config{}, errors.New("group without name")
+		}
+	}
+	return cfg, nil
+}
+
+func LoadConfigFromFile(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer func() { _ = f.Close() }()
+	return LoadConfig(f)
+}
+
+//go:embed status.html
+var pageTemplate string
+
+var tmpl = template.Must(template.New("status").Parse(pageTemplate))
+
+var _ http.Handler = &Page{}
+
+// Page serves an HTML page with the current state, the uptime per day and the recent incidents of the targets.
+// The page is self-contained: it does not load any external assets.
+type Page struct {
+	TargetSource
+	title  string
+	groups []group
+}
+
+type group struct {
+	name     string
+	patterns []*regexp.Regexp
+}
+
+func NewPage(cfg Config, source TargetSource) *Page {
+	p := Page{TargetSource: source, title: cfg.Title}
+	if p.title == "" {
+		p.title = "Status"
+	}
+	for _, g := range cfg.Groups {
+		compiled := group{name: g.Name}
+		for _, pattern := range g.Targets {
+			compiled.patterns = append(compiled.patterns, glob.Compile(pattern))
+		}
+		p.groups = append(p.groups, compiled)
+	}
+	return &p
+}
+
+func (p *Page) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, p.data(p.StatusTargets(), time.Now())); err != nil {
+		logger.Logger(req).Error("failed to render status page", "err", err)
+		http.Error(w, "failed to render status page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(body.Bytes())
+}
+
+type pageData struct {
+	Title       string
+	Updated     string
+	Down        int
+	Maintenance int
+	Groups      []groupData
+	Incidents   []incidentData
+}
+
+type groupData struct {
+	Name    string
+	Targets []targetData
+}
+
+type targetData struct {
+	Name   string
+	State  string
+	Uptime string
+	Bars   []barData
+}
+
+type barData struct {
+	Class string
+	Title string
+}
+
+type incidentData struct {
+	start    time.Time
+	Target   string
+	Start    string
+	Duration string
+	Ongoing  bool
+	Reason   string
+}
+
+func (p *Page) data(targets []Target, now time.Time) pageData {
+	data := pageData{Title: p.title, Updated: now.UTC().Format(timeFormat)}
+	groups := make([]groupData, len(p.groups))
+	var incidents []incidentData
+	for _, target := range targets {
+		i := slices.IndexFunc(p.groups, func(g group) bool { return g.matches(target.Target) })
+		if i < 0 {
+			continue
+		}
+		t := newTargetData(target, now)
+		switch t.State {
+		case stateDown:
+			data.Down++
+		case stateMaintenance:
+			data.Maintenance++
+		}
+		groups[i].Targets = append(groups[i].Targets, t)
+		for _, incident := range target.Incidents {
+			incidents = append(incidents, newIncidentData(target.Target, incident, now))
+		}
+	}
+	for i := range p.groups {
+		if len(groups[i].Targets) > 0 {
+			groups[i].Name = p.groups[i].name
+			data.Groups = append(data.Groups, groups[i])
+		}
+	}
+
+	// most recent incidents first
+	slices.SortStableFunc(incidents, func(a, b incidentData) int { return b.start.Compare(a.start) })
+	data.Incidents = incidents[:min(len(incidents), maxIncidents)]
+	return data
+}
+
+func (g group) matches(target string) bool {
+	return slices.ContainsFunc(g.patterns, func(pattern *regexp.Regexp) bool { return pattern.MatchString(target) })
+}
+
+const (
+	dateFormat = "2006-01-02"
+	timeFormat = "2006-01-02 15:04 MST"
+)
+
+const (
+	stateUp          = "up"
+	stateDown        = "down"
+	stateMaintenance = "maintenance"
+	stateUnknown     = "unknown"
+)
+
+func newTargetData(target Target, now time.Time) targetData {
+	t := targetData{Name: target.Target, State: stateUnknown, Uptime: "no data"}
+	switch {
+	case target.Maintenance:
+		t.State = stateMaintenance
+	case target.Up != nil && *target.Up:
+		t.State = stateUp
+	case target.Up != nil:
+		t.State = stateDown
+	}
+
+	days := make(map[string]Day, len(target.Days))
+	var checks, up int
+	for _, day := range target.Days {
+		days[day.Date.UTC().Format(dateFormat)] = day
+		checks += day.Checks
+		up += day.Up
+	}
+	if checks > 0 {
+		t.Uptime = formatRatio(up, checks)
+	}
+	today := now.UTC().Truncate(24 * time.Hour)
+	t.Bars = make([]barData, Days)
+	for i := range t.Bars {
+		date := today.AddDate(0, 0, i+1-Days)
+		t.Bars[i] = newBarData(date, days[date.Format(dateFormat)])
+	}
+	return t
+}
+
+func newBarData(date time.Time, day Day) barData {
+	bar := barData{Class: "none", Title: date.Format(dateFormat) + ": no data"}
+	if day.Checks == 0 {
+		return bar
+	}
+	switch ratio := float64(day.Up) / float64(day.Checks); {
+	case ratio == 1:
+		bar.Class = "up"
+	case ratio >= 0.99:
+		bar.Class = "degraded"
+	default:
+		bar.Class = "down"
+	}
+	bar.Title = date.Format(dateFormat) + ": " + formatRatio(day.Up, day.Checks)
+	return bar
+}
+
+func formatRatio(up, checks int) string {
+	return strconv.FormatFloat(100*float64(up)/float64(checks), 'f', 2, 64) + "%"
+}
+
+func newIncidentData(target string, incident Incident, now time.Time) incidentData {
+	end := incident.End
+	if end.IsZero() {
+		end = now
+	}
+	return incidentData{
+		start:    incident.Start,
+		Target:   target,
+		Start:    incident.Start.UTC().Format(timeFormat),
+		Duration: end.Sub(incident.Start).Round(time.Second).String(),
+		Ongoing:  incident.End.IsZero(),
+		Reason:   incident.Reason,
+	}
+}
@@ -0,0 +1,200 @@
+package status
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Config
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name: "valid",
+			input: `
+title: Example status
+groups:
+  - name: Websites
+    targets: [ "https://*.example.com" ]
+  - name: DNS
+    targets: [ "ns1.example.com:53", "ns2.example.com:53" ]
+`,
+			want: Config{Title: "Example status", Groups: []Group{
+				{Name: "Websites", Targets: []string{"https://*.example.com"}},
+				{Name: "DNS", Targets: []string{"ns1.example.com:53", "ns2.example.com:53"}},
+			}},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "empty",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "no groups",
+			input:   "title: Example status",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "group without name",
+			input:   "groups: [ { targets: [ '*' ] } ]",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "invalid yaml",
+			input:   "groups: {",
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg, err := LoadConfig(strings.NewReader(tt.input))
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, cfg)
+		})
+	}
+}
+
+type targets []Target
+
+func (t targets) StatusTargets() []Target {
+	return t
+}
+
+func TestPage_ServeHTTP(t *testing.T) {
+	up, down := true, false
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	source := targets{
+		{Target: "https://www.example.com", Up: &up, Days: []Day{{Date: today, Checks: 100, Up: 100}}},
+		{Target: "https://api.example.com", Up: &down, Incidents: []Incident{{Start: time.Now().Add(-time.Minute), Reason: "connection failed"}}},
+		{Target: "ns1.example.com:53", Maintenance: true},
+		{Target: "<script>alert(1)</script>"},
+	}
+
+	all := Config{Groups: []Group{{Name: "All", Targets: []string{"*"}}}}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		source  targets
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "no groups",
+			source:  source,
+			want:    []string{"No targets to show.", "All systems operational"},
+			notWant: []string{"example.com", "connection failed"},
+		},
+		{
+			name:   "all targets",
+			cfg:    all,
+			source: source,
+			want: []string{
+				"<title>Status</title>",
+				"1 target is down",
+				`<span class="name">https://www.example.com</span><span class="state up">up</span>`,
+				`<span class="name">https://api.example.com</span><span class="state down">down</span>`,
+				`<span class="name">ns1.example.com:53</span><span class="state maintenance">maintenance</span>`,
+				"&lt;script&gt;alert(1)&lt;/script&gt;",
+				`<span class="up" title="` + today.Format(dateFormat) + `: 100.00%"></span>`,
+				"100.00% uptime",
+				"no data uptime",
+				"connection failed",
+				"(ongoing)",
+			},
+			notWant: []string{"<script>alert(1)</script>", "No targets to show."},
+		},
+		{
+			name: "groups",
+			cfg: Config{Title: "Example", Groups: []Group{
+				{Name: "DNS", Targets: []string{"*:53"}},
+				{Name: "Websites", Targets: []string{"https://*.example.com"}},
+				{Name: "Empty", Targets: []string{"https://example.org"}},
+			}},
+			source: source,
+			want: []string{
+				"<title>Example</title>",
+				"<h2>DNS</h2>",
+				"<h2>Websites</h2>",
+				"https://www.example.com",
+			},
+			notWant: []string{"<h2>Empty</h2>", "alert(1)"},
+		},
+		{
+			name:   "maintenance",
+			cfg:    all,
+			source: source[2:3],
+			want:   []string{"1 target is in maintenance", "No incidents in the last 90 days."},
+		},
+		{
+			name:   "all up",
+			cfg:    all,
+			source: source[:1],
+			want:   []string{"All systems operational"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := NewPage(tt.cfg, tt.source)
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			body := w.Body.String()
+			for _, want := range tt.want {
+				assert.Contains(t, body, want)
+			}
+			for _, notWant := range tt.notWant {
+				assert.NotContains(t, body, notWant)
+			}
+		})
+	}
+}
+
+func TestPage_Data(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 12, 30, 0, 0, time.UTC)
+	up := true
+	var incidents []Incident
+	for i := range maxIncidents + 5 {
+		start := now.Add(-time.Duration(i) * time.Hour)
+		incidents = append([]Incident{{Start: start, End: start.Add(time.Minute), Reason: "invalid status code"}}, incidents...)
+	}
+	target := Target{
+		Target: "https://example.com",
+		Up:     &up,
+		Days: []Day{
+			{Date: now.AddDate(0, 0, -100).Truncate(24 * time.Hour), Checks: 10},
+			{Date: now.AddDate(0, 0, -89).Truncate(24 * time.Hour), Checks: 1000, Up: 995},
+			{Date: now.AddDate(0, 0, -1).Truncate(24 * time.Hour), Checks: 100, Up: 50},
+			{Date: now.Truncate(24 * time.Hour), Checks: 10, Up: 10},
+		},
+		Incidents: incidents,
+	}
+
+	data := NewPage(Config{Groups: []Group{{Name: "All", Targets: []string{"*"}}}}, nil).data([]Target{target}, now)
+	require.Len(t, data.Groups, 1)
+	require.Len(t, data.Groups[0].Targets, 1)
+	bars := data.Groups[0].Targets[0].Bars
+	require.Len(t, bars, Days)
+	assert.Equal(t, barData{Class: "degraded", Title: "2024-01-02: 99.50%"}, bars[0])
+	assert.Equal(t, barData{Class: "none", Title: "2024-01-03: no data"}, bars[1])
+	assert.Equal(t, barData{Class: "down", Title: "2024-03-30: 50.00%"}, bars[Days-2])
+	assert.Equal(t, barData{Class: "up", Title: "2024-03-31: 100.00%"}, bars[Days-1])
+
+	require.Len(t, data.Incidents, maxIncidents)
+	assert.Equal(t, "2024-03-31 12:30 UTC", data.Incidents[0].Start)
+	assert.Equal(t, "2024-03-31 03:30 UTC", data.Incidents[maxIncidents-1].Start)
+	assert.Equal(t, "1m0s", data.Incidents[0].Duration)
+	assert.False(t, data.Incidents[0].Ongoing)
+}
@@ -0,0 +1,33 @@
+package status
+
+import "time"
+
+// Target is the status of a target, as shown on the status page.
+type Target struct {
+	Target      string
+	Up          *bool
+	Maintenance bool
+	// Days holds the checks of each day with checks, oldest first. Days start at midnight UTC.
+	Days []Day
+	// Incidents holds the recent periods that the target was down, oldest first.
+	Incidents []Incident
+}
+
+// Day counts the checks of a target during one day.
+type Day struct {
+	Date   time.Time
+	Checks int
+	Up     int
+}
+
+// Incident is a period that a target was down. End is zero if the target is still down.
+type Incident struct {
+	Start  time.Time
+	End    time.Time
+	Reason string
+}
+
+// TargetSource returns the status of the targets.
+type TargetSource interface {
+	StatusTargets() []Target
+}
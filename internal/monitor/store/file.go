@@ -0,0 +1,150 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Target is a stored target: the request it is checked with and the agents that registered it.
+type Target struct {
+	Request handlers.Request
+	Owners  []string
+}
+
+// File stores targets in a JSON file. Each target is stored as its encoded request, so the file holds the same
+// information as the registration made by the agent, and its owners. Save and Delete only update the targets in
+// memory: Flush rewrites the file if any target changed.
+type File struct {
+	path      string
+	lock      sync.Mutex
+	targets   map[string]storedTarget
+	dirty     bool
+	writeLock sync.Mutex
+}
+
+type storedTarget struct {
+	Request string   `json:"request"`
+	Owners  []string `json:"owners,omitempty"`
+}
+
+// UnmarshalJSON also accepts a target stored as only its encoded request, as written by earlier versions.
+func (s *storedTarget) UnmarshalJSON(body []byte) error {
+	if err := json.Unmarshal(body, &s.Request); err == nil {
+		return nil
+	}
+	type plain storedTarget
+	return json.Unmarshal(body, (*plain)(s))
+}
+
+type fileContents struct {
+	Targets map[string]storedTarget `json:"targets"`
+}
+
+func NewFile(path string) *File {
+	return &File{path: path, targets: make(map[string]storedTarget)}
+}
+
+// Load returns the stored targets. A missing file is treated as an empty store.
+func (f *File) Load() ([]Target, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	body, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	var contents fileContents
+	if err = json.Unmarshal(body, &contents); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	targets := make([]Target, 0, len(contents.Targets))
+	for target, stored := range contents.Targets {
+		request, err := handlers.DecodeRequest(stored.Request)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", target, err)
+		}
+		targets = append(targets, Target{Request: request, Owners: stored.Owners})
+		f.targets[target] = stored
+	}
+	slices.SortFunc(targets, func(a, b Target) int {
+		return strings.Compare(a.Request.Target, b.Request.Target)
+	})
+	return targets, nil
+}
+
+func (f *File) Save(target Target) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.targets[target.Request.Target] = storedTarget{Request: target.Request.Encode(), Owners: slices.Clone(target.Owners)}
+	f.dirty = true
+	return nil
+}
+
+func (f *File) Delete(target string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.targets[target]; !ok {
+		return nil
+	}
+	delete(f.targets, target)
+	f.dirty = true
+	return nil
+}
+
+// Flush writes the targets to the file if they changed since the last write. Save and Delete can proceed while the
+// file is being written.
+func (f *File) Flush() error {
+	// writeLock keeps concurrent flushes in order, so an older copy of the targets never overwrites a newer one
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	f.lock.Lock()
+	if !f.dirty {
+		f.lock.Unlock()
+		return nil
+	}
+	targets := maps.Clone(f.targets)
+	f.dirty = false
+	f.lock.Unlock()
+
+	err := f.write(targets)
+	if err != nil {
+		f.lock.Lock()
+		f.dirty = true
+		f.lock.Unlock()
+	}
+	return err
+}
+
+// write replaces the file atomically, so a crash never leaves a partially written file behind.
+func (f *File) write(targets map[string]storedTarget) error {
+	body, err := json.MarshalIndent(fileContents{Targets: targets}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,100 @@
+package store_test
+
+import (
+	"github.com/clambin/go-common/set"
+	"github.com/clambin/uptime/internal/monitor/handlers"
+	"github.com/clambin/uptime/internal/monitor/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+
+	f := store.NewFile(path)
+	targets, err := f.Load()
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	httpRequest := handlers.Request{
+		Target:     "https://example.com",
+		Type:       handlers.ProbeHTTP,
+		Method:     http.MethodGet,
+		ValidCodes: set.New(http.StatusOK),
+		Interval:   time.Minute,
+		Headers:    http.Header{"Accept": []string{"application/json"}},
+	}
+	tcpRequest := handlers.Request{
+		Target:     "example.com:1883",
+		Type:       handlers.ProbeTCP,
+		Method:     http.MethodGet,
+		ValidCodes: set.New(http.StatusOK),
+		Interval:   time.Hour,
+		Expect:     "READY",
+	}
+	require.NoError(t, f.Save(store.Target{Request: httpRequest, Owners: []string{"cluster-a", "cluster-b"}}))
+	require.NoError(t, f.Save(store.Target{Request: tcpRequest}))
+
+	// changes are only written by Flush
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, f.Flush())
+
+	// a new store reads the targets back from the file
+	targets, err = store.NewFile(path).Load()
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+	assert.True(t, tcpRequest.Equals(targets[0].Request))
+	assert.Empty(t, targets[0].Owners)
+	assert.True(t, httpRequest.Equals(targets[1].Request))
+	assert.Equal(t, []string{"cluster-a", "cluster-b"}, targets[1].Owners)
+
+	require.NoError(t, f.Delete(tcpRequest.Target))
+	require.NoError(t, f.Delete("unknown"))
+	require.NoError(t, f.Flush())
+	targets, err = store.NewFile(path).Load()
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	assert.True(t, httpRequest.Equals(targets[0].Request))
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFile_Load_RequestOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"targets":{"example.com:53":"target=example.com%3A53&type=tcp&interval=1m0s"}}`), 0o600))
+	targets, err := store.NewFile(path).Load()
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	assert.Equal(t, "example.com:53", targets[0].Request.Target)
+	assert.Equal(t, handlers.ProbeTCP, targets[0].Request.Type)
+	assert.Empty(t, targets[0].Owners)
+}
+
+func TestFile_Load_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{name: "invalid json", contents: `{`},
+		{name: "invalid request", contents: `{"targets":{"example.com":{"request":"target=example.com&type=udp"}}}`},
+		{name: "invalid target", contents: `{"targets":{"example.com":1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "targets.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.contents), 0o600))
+			_, err := store.NewFile(path).Load()
+			assert.Error(t, err)
+		})
+	}
+}